@@ -0,0 +1,76 @@
+// Command reencrypt seals every encrypted field under the active data key.
+// Run it after adding a new key to the front of DATA_ENCRYPTION_KEYS; once it
+// reports no changes the retired keys can be removed. It also encrypts rows
+// written before field encryption was enabled.
+//
+//	go run ./cmd/reencrypt [-dry-run] [-collection users]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only count the documents that would be re-encrypted")
+	collection := flag.String("collection", "", "re-encrypt a single collection")
+	flag.Parse()
+
+	if err := run(*collection, *dryRun); err != nil {
+		slog.Error("re-encryption failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(only string, dryRun bool) error {
+	err := common.LoadEnv()
+	if err != nil {
+		return err
+	}
+	common.InitLogger()
+	err = utils.LoadDataKeys()
+	if err != nil {
+		return err
+	}
+	err = common.InitDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := common.CloseDB(ctx); err != nil {
+			slog.Error("error closing db", "error", err)
+		}
+	}()
+
+	collections := make([]string, 0, len(handlers.EncryptedModels))
+	for name := range handlers.EncryptedModels {
+		collections = append(collections, name)
+	}
+	sort.Strings(collections)
+	if only != "" {
+		if _, ok := handlers.EncryptedModels[only]; !ok {
+			return fmt.Errorf("collection %q has no encrypted fields", only)
+		}
+		collections = []string{only}
+	}
+
+	for _, name := range collections {
+		updated, err := handlers.ReencryptCollection(context.Background(), name, dryRun)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		slog.Info("collection re-encrypted", "collection", name, "documents", updated, "dryRun", dryRun)
+	}
+	return nil
+}
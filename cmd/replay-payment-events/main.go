@@ -0,0 +1,77 @@
+// Command replay-payment-events processes stored payment webhook events again,
+// for events that failed after the gateway stopped retrying or to repair state
+// after a fix. Events are applied oldest first and replaying is safe.
+//
+//	go run ./cmd/replay-payment-events [-status failed] [-provider stripe] [-event evt_123] [-since 48h]
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+func main() {
+	status := flag.String("status", "failed", "replay events with this status, empty for all")
+	provider := flag.String("provider", "", "replay events of one payment provider")
+	event := flag.String("event", "", "replay a single event by its provider event id")
+	since := flag.Duration("since", 0, "replay events received within this long, 0 for all")
+	flag.Parse()
+
+	filter := bson.M{}
+	if *status != "" && *event == "" {
+		filter["status"] = *status
+	}
+	if *provider != "" {
+		filter["provider"] = *provider
+	}
+	if *event != "" {
+		filter["eventId"] = *event
+	}
+	if *since > 0 {
+		filter["receivedAt"] = bson.M{"$gte": time.Now().Add(-*since)}
+	}
+
+	if err := run(filter); err != nil {
+		slog.Error("replay failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(filter bson.M) error {
+	err := common.LoadEnv()
+	if err != nil {
+		return err
+	}
+	common.InitLogger()
+	err = utils.LoadDataKeys()
+	if err != nil {
+		return err
+	}
+	err = common.InitDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := common.CloseDB(ctx); err != nil {
+			slog.Error("error closing db", "error", err)
+		}
+	}()
+
+	replayed, failed, err := handlers.ReplayPaymentEvents(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+	slog.Info("payment events replayed", "events", replayed, "failed", failed)
+	return nil
+}
@@ -5,8 +5,11 @@ import (
 	"errors"
 	"os"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 var db *mongo.Database
@@ -22,7 +25,9 @@ func InitDB() error {
 			"you must set your 'MONGODB_URI' environmental variable. See\n\t https://www.mongodb.com/docs/drivers/go/current/usage-examples/#environment-variable",
 		)
 	}
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	// every command gets a span, nested under the request span when ctx carries one
+	opts := options.Client().ApplyURI(uri).SetMonitor(otelmongo.NewMonitor())
+	client, err := mongo.Connect(context.Background(), opts)
 	if err != nil {
 		return err
 	}
@@ -32,6 +37,52 @@ func InitDB() error {
 	return nil
 }
 
-func CloseDB() error {
-	return db.Client().Disconnect(context.Background())
+func CloseDB(ctx context.Context) error {
+	return db.Client().Disconnect(ctx)
+}
+
+// PingDB checks that the primary is reachable, it backs the readiness probe.
+func PingDB(ctx context.Context) error {
+	if db == nil {
+		return errors.New("database is not initialised")
+	}
+	return db.Client().Ping(ctx, readpref.Primary())
+}
+
+// CheckTransactions makes sure the deployment supports multi-document
+// transactions, which bookings need to claim rooms: a replica set, a
+// single-node one will do, or a sharded cluster. main calls it at startup so a
+// standalone server is reported there instead of on the first booking.
+func CheckTransactions(ctx context.Context) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := db.Client().Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return err
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return errors.New("MongoDB is a standalone server, bookings use transactions and need a replica set (a single node is enough, see README)")
+	}
+	return nil
+}
+
+// WithTransaction runs fn in a multi-document transaction, retried by the driver
+// on transient errors, so fn must be safe to run more than once. Operations join
+// the transaction by using the ctx fn is given, and so does a WithTransaction
+// called with it. Transactions need a replica set.
+func WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
 }
@@ -1,12 +1,15 @@
 package common
 
 import (
-	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// LoadEnv reads .env outside production, the getters below only read the environment.
 func LoadEnv() error {
 	prod := os.Getenv("PROD")
 	if prod != "true" {
@@ -19,89 +22,226 @@ func LoadEnv() error {
 }
 
 func EnvJWTSecret() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("JWT_SECRET")
 }
 
 func SenderEmail() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("SENDER_EMAIL")
 }
 
 func BrevoAPIKey() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("BREVO_API_KEY")
 }
 
 func FrontendUrl() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("FRONTEND_URL")
 }
 
 func GoogleClientID() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("GOOGLE_CLIENT_ID")
 }
 
 func GoogleClientSecret() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("GOOGLE_CLIENT_SECRET")
 }
 
 func GoogleRedirectURI() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("GOOGLE_REDIRECT_URL")
 }
 
 func CloudinaryCloudName() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("CLOUDINARY_CLOUD_NAME")
 }
 
 func CloudinaryAPIKey() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("CLOUDINARY_API_KEY")
 }
 
 func CloudinaryAPISecret() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("CLOUDINARY_API_SECRET")
 }
 
 func CloudinaryUploadFolder() string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
 	return os.Getenv("CLOUDINARY_UPLOAD_FOLDER")
 }
+
+// BaseCurrency is the ISO 4217 currency the property keeps its books in,
+// BASE_CURRENCY defaults to USD.
+func BaseCurrency() string {
+	if currency := os.Getenv("BASE_CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return "USD"
+}
+
+// MediaConfigured reports whether every setting needed to upload media is present.
+func MediaConfigured() bool {
+	return os.Getenv("CLOUDINARY_CLOUD_NAME") != "" &&
+		os.Getenv("CLOUDINARY_API_KEY") != "" &&
+		os.Getenv("CLOUDINARY_API_SECRET") != ""
+}
+
+// DataEncryptionKey is the single key used before key rotation was introduced,
+// it is still read under the key id "v1".
+func DataEncryptionKey() string {
+	return os.Getenv("DATA_ENCRYPTION_KEY")
+}
+
+// DataEncryptionKeys lists "id:base64key" pairs separated by commas, the first
+// one encrypts new data and the others only decrypt.
+func DataEncryptionKeys() string {
+	return os.Getenv("DATA_ENCRYPTION_KEYS")
+}
+
+// IDDocumentRetention is how long identity documents are kept after capture,
+// ID_DOCUMENT_RETENTION_DAYS defaults to 90 days.
+func IDDocumentRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ID_DOCUMENT_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = 90
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PaymentProvider names the gateway new payments go through: stripe, paystack
+// or fake, the local gateway that approves everything. PAYMENT_PROVIDER has no
+// default, the server refuses to start without it.
+func PaymentProvider() string {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("PAYMENT_PROVIDER")))
+}
+
+// FakePaymentsEnabled allows the fake gateway, for local development only:
+// ALLOW_FAKE_PAYMENTS=true.
+func FakePaymentsEnabled() bool {
+	return os.Getenv("ALLOW_FAKE_PAYMENTS") == "true"
+}
+
+func StripeSecretKey() string {
+	return os.Getenv("STRIPE_SECRET_KEY")
+}
+
+func PaystackSecretKey() string {
+	return os.Getenv("PAYSTACK_SECRET_KEY")
+}
+
+// DepositPercent is the share of a booking's total taken as a deposit,
+// PAYMENT_DEPOSIT_PERCENT defaults to 30.
+func DepositPercent() float64 {
+	percent, err := strconv.ParseFloat(os.Getenv("PAYMENT_DEPOSIT_PERCENT"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		percent = 30
+	}
+	return percent
+}
+
+// StripeWebhookSecret signs the events Stripe posts to /webhooks/payments/stripe.
+func StripeWebhookSecret() string {
+	return os.Getenv("STRIPE_WEBHOOK_SECRET")
+}
+
+// FakeWebhookSecret signs events for the fake gateway, without it they are refused.
+func FakeWebhookSecret() string {
+	return os.Getenv("FAKE_WEBHOOK_SECRET")
+}
+
+// BookingHold is how long a new booking keeps its room while the guest pays,
+// BOOKING_HOLD_MINUTES defaults to 15 minutes.
+func BookingHold() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("BOOKING_HOLD_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// ArrivalReminderDays is how many days before check-in guests are reminded of
+// their stay, BOOKING_REMINDER_DAYS defaults to 3.
+func ArrivalReminderDays() int {
+	days, err := strconv.Atoi(os.Getenv("BOOKING_REMINDER_DAYS"))
+	if err != nil || days <= 0 {
+		days = 3
+	}
+	return days
+}
+
+// IdempotencyTTL is how long a response is kept for replay under its
+// Idempotency-Key, IDEMPOTENCY_TTL_HOURS defaults to 24 hours.
+func IdempotencyTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_TTL_HOURS"))
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// IdempotencyLease is how long a request holds its Idempotency-Key while it
+// runs. A retry after that takes the key over, so a request that crashed or
+// timed out doesn't block its key until the TTL. IDEMPOTENCY_LEASE_SECONDS
+// defaults to 60 seconds.
+func IdempotencyLease() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_LEASE_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = 60
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// MailTransport names how email leaves the service: brevo, smtp, file, which
+// writes each message to MAIL_SINK_DIR, or memory, which keeps them in the
+// process. MAIL_TRANSPORT defaults to brevo.
+func MailTransport() string {
+	if transport := os.Getenv("MAIL_TRANSPORT"); transport != "" {
+		return strings.ToLower(transport)
+	}
+	return "brevo"
+}
+
+func SMTPHost() string {
+	return os.Getenv("SMTP_HOST")
+}
+
+// SMTPPort defaults to 587, the submission port.
+func SMTPPort() int {
+	port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if err != nil || port <= 0 {
+		port = 587
+	}
+	return port
+}
+
+func SMTPUsername() string {
+	return os.Getenv("SMTP_USERNAME")
+}
+
+func SMTPPassword() string {
+	return os.Getenv("SMTP_PASSWORD")
+}
+
+// MailSinkDir is where the file transport writes messages, MAIL_SINK_DIR
+// defaults to mail-sink in the working directory.
+func MailSinkDir() string {
+	if dir := os.Getenv("MAIL_SINK_DIR"); dir != "" {
+		return dir
+	}
+	return "mail-sink"
+}
+
+// OutboxWorkers is how many goroutines deliver queued messages,
+// OUTBOX_WORKERS defaults to 2.
+func OutboxWorkers() int {
+	workers, err := strconv.Atoi(os.Getenv("OUTBOX_WORKERS"))
+	if err != nil || workers <= 0 {
+		workers = 2
+	}
+	return workers
+}
+
+// OutboxMaxAttempts is how often a message is tried before it is dead-lettered,
+// OUTBOX_MAX_ATTEMPTS defaults to 8.
+func OutboxMaxAttempts() int {
+	attempts, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS"))
+	if err != nil || attempts <= 0 {
+		attempts = 8
+	}
+	return attempts
+}
@@ -0,0 +1,24 @@
+package common
+
+import (
+	"context"
+	"time"
+)
+
+// RunEvery calls job every interval until ctx is cancelled. Failures are logged
+// and the job is retried on the next tick.
+func RunEvery(ctx context.Context, interval time.Duration, name string, job func(context.Context) error) {
+	logger := Logger(ctx).With("job", name)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := job(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("job failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "hotel_booking"
+
+// request metrics, labelled by the matched route pattern rather than the raw path
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// business metrics
+var (
+	BookingsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "bookings_created_total",
+		Help:      "Bookings created.",
+	})
+
+	BookingsCancelled = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "bookings_cancelled_total",
+		Help:      "Bookings cancelled.",
+	})
+
+	BookingHoldsExpired = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "booking_holds_expired_total",
+		Help:      "Booking holds released unpaid.",
+	})
+
+	OutboxDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "outbox_deliveries_total",
+		Help:      "Outbox delivery attempts by kind and outcome (sent, retry, dead).",
+	}, []string{"kind", "outcome"})
+
+	EmailsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "emails_sent_total",
+		Help:      "Emails handed to the mail provider, by template and result.",
+	}, []string{"template", "result"})
+
+	MediaUploads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "media_uploads_total",
+		Help:      "Media uploads by source (file, remote) and result.",
+	}, []string{"source", "result"})
+
+	PaymentOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "payment_operations_total",
+		Help:      "Calls to the payment gateway by provider, operation and result.",
+	}, []string{"provider", "operation", "result"})
+)
+
+// RegisterOccupancyGauge exposes the share of rooms occupied right now, computed
+// by occupancy on every scrape.
+func RegisterOccupancyGauge(occupancy func() float64) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "room_occupancy_ratio",
+		Help:      "Rooms with a stay in progress divided by all rooms.",
+	}, occupancy))
+}
+
+// ResultLabel turns an error into the "result" label used by the counters above.
+func ResultLabel(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "success"
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+type AuditQueryDTO struct {
+	Entity   string    `query:"entity"`
+	EntityID string    `query:"entityId"`
+	ActorID  string    `query:"actorId"`
+	Action   string    `query:"action"`
+	From     time.Time `query:"from"`
+	To       time.Time `query:"to"`
+	Limit    int64     `query:"limit" validate:"omitempty,min=1,max=500"`
+	Page     int64     `query:"page"  validate:"omitempty,min=1"`
+}
+
+// GetAuditLogs lets admins browse the audit trail by entity, actor, action and time, newest first.
+func GetAuditLogs(c *fiber.Ctx) error {
+	auditCollection := common.GetDBCollection(utils.AUDIT_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var q AuditQueryDTO
+	if err := c.QueryParser(&q); err != nil {
+		return responses.BadRequest("Invalid query parameters")
+	}
+	if err := validateStruct(&q); err != nil {
+		return err
+	}
+	if q.Limit == 0 {
+		q.Limit = 50
+	}
+	if q.Page == 0 {
+		q.Page = 1
+	}
+
+	filter := bson.M{}
+	if q.Entity != "" {
+		filter["entity"] = q.Entity
+	}
+	if q.EntityID != "" {
+		filter["entityId"] = q.EntityID
+	}
+	if q.ActorID != "" {
+		filter["actorId"] = q.ActorID
+	}
+	if q.Action != "" {
+		filter["action"] = q.Action
+	}
+	createdAt := bson.M{}
+	if !q.From.IsZero() {
+		createdAt["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		createdAt["$lte"] = q.To
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip((q.Page - 1) * q.Limit).
+		SetLimit(q.Limit)
+	cursor, err := auditCollection.Find(c.UserContext(), filter, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	entries := make([]models.AuditEntry, 0)
+	if err := cursor.All(c.UserContext(), &entries); err != nil {
+		return responses.Internal(err)
+	}
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Audit logs fetched successfully", Data: &fiber.Map{"auditLogs": entries, "page": q.Page, "limit": q.Limit}})
+}
@@ -3,14 +3,12 @@ package handlers
 import (
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 
@@ -21,14 +19,15 @@ import (
 )
 
 type createUserDTO struct {
-	Email       string `json:"email,omitempty"    bson:"email"       validate:"required"`
+	Email       string `json:"email,omitempty"    bson:"email"       validate:"required" encrypt:"lookup"`
 	Password    string `json:"password,omitempty" bson:"password"    validate:"required"`
 	Role        string `json:"role"               bson:"role"`
 	FirstName   string `json:"firstName"          bson:"firstName"`
 	LastName    string `json:"lastName"           bson:"lastName"`
-	PhoneNumber int64  `json:"phoneNumber"        bson:"phoneNumber"`
-	Location    string `json:"location"           bson:"location"`
-	DateOfBirth string `json:"dateOfBirth"        bson:"dateOfBirth"`
+	PhoneNumber string `json:"phoneNumber"        bson:"phoneNumber" encrypt:"lookup"`
+	Location    string `json:"location"           bson:"location"    encrypt:"random"`
+	DateOfBirth string `json:"dateOfBirth"        bson:"dateOfBirth" encrypt:"random"`
+	Locale      string `json:"locale"             bson:"locale"      validate:"omitempty,bcp47_language_tag"`
 	IsVerified  bool   `json:"isVerified"         bson:"isVerified"`
 	IsAdmin     bool   `json:"isAdmin"            bson:"isAdmin"`
 }
@@ -40,18 +39,17 @@ type forgotPasswordDTO struct {
 	Email string `json:"email,omitempty" validate:"required"`
 }
 type resetPasswordDTO struct {
-	Email      string `json:"email,omitempty"    validate:"required"`
+	Email      string `json:"email,omitempty"    validate:"required"                 encrypt:"lookup"`
 	Password   string `json:"password,omitempty" validate:"required"`
 	IsVerified bool   `json:"isVerified"                             bson:"isVerified"`
 }
 
 type verifyUserDTO struct {
-	Email      string `json:"email,omitempty" validate:"required"`
+	Email      string `json:"email,omitempty" validate:"required"                 encrypt:"lookup"`
 	IsVerified bool   `json:"isVerified"                          bson:"isVerified"`
 }
 
 var (
-	validate     = validator.New()
 	ssoOAuth     *oauth2.Config
 	RandomString = "random-text"
 )
@@ -59,45 +57,45 @@ var (
 func RegisterUser(c *fiber.Ctx) error {
 	userCollection := common.GetDBCollection(USERS_MODEL)
 	var u createUserDTO
+	// set is verified to true for newly registered user
 	u.IsVerified = true
-	u.Role = "GUEST"
-	if err := c.BodyParser(&u); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": "Please provide request body"}})
+	if err := parseBody(c, &u); err != nil {
+		return err
 	}
-	// set is verified to true for newly registered user
 
-	if validationErr := validate.Struct(&u); validationErr != nil {
-		for _, err := range validationErr.(validator.ValidationErrors) {
-			return c.Status(http.StatusBadRequest).
-				JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": err.Field() + " is required"}})
-		}
+	filter, err := emailFilter(u.Email)
+	if err != nil {
+		return err
 	}
-
 	var r models.User
-	err := userCollection.FindOne(context.Background(), bson.M{"email": u.Email}).Decode(&r)
+	err = userCollection.FindOne(c.UserContext(), filter).Decode(&r)
 	if err == nil {
-		return c.Status(http.StatusConflict).
-			JSON(responses.APIResponse{Status: http.StatusConflict, Message: "Already Exist", Data: &fiber.Map{"error": "User with this Email already exist"}})
+		return responses.Conflict("User with this Email already exist")
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return responses.Internal(err)
 	}
 
-	pass, hashErr := utils.HashPassword(u.Password)
-	if hashErr != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Failed to hash password", Data: &fiber.Map{"error": hashErr.Error()}})
+	pass, err := utils.HashPassword(u.Password)
+	if err != nil {
+		return responses.Internal(err)
 	}
 	u.Password = pass
+	u.Email = normalizeEmail(u.Email)
+	// roles are granted by admins, never chosen at sign up
+	u.Role = models.RoleGuest
 	u.IsAdmin = false
-	result, err := userCollection.InsertOne(c.Context(), u)
+	if err := sealFields(&u); err != nil {
+		return err
+	}
+	result, err := userCollection.InsertOne(c.UserContext(), u)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.FromDB(err, "User")
 	}
-	// convert interface to string
-	jwt, err := utils.GenerateJWT(fmt.Sprint(result.InsertedID), u.IsAdmin)
+	utils.Audit(c, USERS_MODEL, hexID(result.InsertedID), nil, u)
+	jwt, err := utils.GenerateJWT(hexID(result.InsertedID), u.Role, u.IsAdmin)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Failed to generate jwt", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
 
 	return c.Status(http.StatusCreated).
@@ -107,40 +105,34 @@ func RegisterUser(c *fiber.Ctx) error {
 func LoginUser(c *fiber.Ctx) error {
 	userCollection := common.GetDBCollection(USERS_MODEL)
 	var l loginDTO
-
-	if err := c.BodyParser(&l); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid Body", Data: &fiber.Map{"error": err.Error()}})
+	if err := parseBody(c, &l); err != nil {
+		return err
 	}
 
-	if validationErr := validate.Struct(&l); validationErr != nil {
-		for _, err := range validationErr.(validator.ValidationErrors) {
-			return c.Status(http.StatusBadRequest).
-				JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": err.Field() + " is required"}})
-		}
+	filter, err := emailFilter(l.Email)
+	if err != nil {
+		return err
 	}
-
 	var result models.User
-	err := userCollection.FindOne(context.Background(), bson.M{"email": l.Email}).Decode(&result)
+	err = userCollection.FindOne(c.UserContext(), filter).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return responses.Unauthorized("Invalid Email or Password")
+	}
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "User not found", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
 
 	if err := utils.CheckPasswordHash(result.Password, l.Password); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid credentials", Data: &fiber.Map{"error": "Invalid Email or Password"}})
+		return responses.Unauthorized("Invalid Email or Password")
 	}
 
 	if !result.IsVerified {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Not Verified", Data: &fiber.Map{"error": "User is not Verified"}})
+		return responses.Forbidden("User is not Verified")
 	}
 
-	jwt, err := utils.GenerateJWT(result.ID, result.IsAdmin)
+	jwt, err := utils.GenerateJWT(result.ID, result.Role, result.IsAdmin)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Failed to generate jwt", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
 	return c.Status(http.StatusOK).
 		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Login successful", Data: &fiber.Map{"token": jwt}})
@@ -149,29 +141,27 @@ func LoginUser(c *fiber.Ctx) error {
 func ForgetPassword(c *fiber.Ctx) error {
 	userCollection := common.GetDBCollection(USERS_MODEL)
 	var f forgotPasswordDTO
-	if err := c.BodyParser(&f); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid body", Data: &fiber.Map{"error": err.Error()}})
-	}
-	if validationErr := validate.Struct(&f); validationErr != nil {
-		for _, err := range validationErr.(validator.ValidationErrors) {
-			return c.Status(http.StatusBadRequest).
-				JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": err.Field() + " is required"}})
-		}
+	if err := parseBody(c, &f); err != nil {
+		return err
 	}
 
+	filter, err := emailFilter(f.Email)
+	if err != nil {
+		return err
+	}
 	var result models.User
-	err := userCollection.FindOne(context.Background(), bson.M{"email": f.Email}).Decode(&result)
+	err = userCollection.FindOne(c.UserContext(), filter).Decode(&result)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "User not found", Data: &fiber.Map{"error": "User with this email not found"}})
+		return responses.FromDB(err, "User")
+	}
+	if err := openFields(&result); err != nil {
+		return err
 	}
 
-	// send email
-	err = utils.SendMailService(result, "templates/forget-password.html", "Forget Password")
+	// queue email
+	err = utils.EnqueueEmail(c.UserContext(), accountEmail(result, "forget-password", "Forget Password"))
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Error sending mail", Data: &fiber.Map{"error": "Something went wrong, error sending mail"}})
+		return responses.Internal(err)
 	}
 
 	return c.Status(http.StatusOK).
@@ -181,47 +171,47 @@ func ForgetPassword(c *fiber.Ctx) error {
 func ResetPassword(c *fiber.Ctx) error {
 	userCollection := common.GetDBCollection(USERS_MODEL)
 	var r resetPasswordDTO
-	if err := c.BodyParser(&r); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid body", Data: &fiber.Map{"error": err.Error()}})
-	}
-	if validationErr := validate.Struct(&r); validationErr != nil {
-		for _, err := range validationErr.(validator.ValidationErrors) {
-			return c.Status(http.StatusBadRequest).
-				JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": err.Field() + " is required"}})
-		}
+	if err := parseBody(c, &r); err != nil {
+		return err
+	}
+	filter, err := emailFilter(r.Email)
+	if err != nil {
+		return err
 	}
 	var result models.User
-	err := userCollection.FindOne(context.Background(), bson.M{"email": r.Email}).Decode(&result)
+	err = userCollection.FindOne(c.UserContext(), filter).Decode(&result)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "User not found", Data: &fiber.Map{"error": "User not found"}})
+		return responses.FromDB(err, "User")
 	}
 
-	objectId, err := primitive.ObjectIDFromHex(result.ID)
+	objectId, err := parseObjectID(result.ID)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
 	// set it to false so that the user must use the verify link to change it back to true before he/she can login
 	r.IsVerified = false
-	updateReq, err := userCollection.UpdateOne(
-		c.Context(),
-		bson.M{"_id": objectId},
-		bson.M{"$set": r},
-	)
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Failed to update user", Data: &fiber.Map{"error": err.Error()}})
-	}
-
-	// send passowrd changed email
-	err = utils.SendMailService(result, "templates/password-changed.html", "Password Changed")
+	r.Email = normalizeEmail(r.Email)
+	if err := openFields(&result); err != nil {
+		return err
+	}
+	if err := sealFields(&r); err != nil {
+		return err
+	}
+	// the password changed email is queued with the change, so neither happens without the other
+	var updateReq *mongo.UpdateResult
+	err = common.WithTransaction(c.UserContext(), func(ctx context.Context) error {
+		var err error
+		updateReq, err = userCollection.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{"$set": r})
+		if err != nil {
+			return err
+		}
+		return utils.EnqueueEmail(ctx, accountEmail(result, "password-changed", "Password Changed"))
+	})
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Error sending mail", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
+	utils.AuditAction(c, "reset-password", USERS_MODEL, result.ID, result, r)
 
 	return c.Status(http.StatusOK).
 		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Password reset was successful", Data: &fiber.Map{"user": updateReq}})
@@ -230,34 +220,38 @@ func ResetPassword(c *fiber.Ctx) error {
 func VerifyAccount(c *fiber.Ctx) error {
 	userCollection := common.GetDBCollection(USERS_MODEL)
 	var v verifyUserDTO
-
-	if err := c.BodyParser(&v); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid body", Data: &fiber.Map{"error": err.Error()}})
+	if err := parseBody(c, &v); err != nil {
+		return err
+	}
+	filter, err := emailFilter(v.Email)
+	if err != nil {
+		return err
 	}
 	var result models.User
-	err := userCollection.FindOne(context.Background(), bson.M{"email": v.Email}).Decode(&result)
+	err = userCollection.FindOne(c.UserContext(), filter).Decode(&result)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "User not found", Data: &fiber.Map{"error": err.Error()}})
+		return responses.FromDB(err, "User")
 	}
 
-	objectId, err := primitive.ObjectIDFromHex(result.ID)
+	objectId, err := parseObjectID(result.ID)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
 	v.IsVerified = true
+	v.Email = normalizeEmail(v.Email)
+	if err := sealFields(&v); err != nil {
+		return err
+	}
 	updateReq, err := userCollection.UpdateOne(
-		c.Context(),
+		c.UserContext(),
 		bson.M{"_id": objectId},
 		bson.M{"$set": v},
 	)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Failed to update user", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
+	utils.AuditAction(c, "verify", USERS_MODEL, result.ID, result, v)
 
 	return c.Status(http.StatusOK).
 		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Your account has been verified", Data: &fiber.Map{"user": updateReq}})
@@ -273,28 +267,25 @@ func SignInWithGoogle(c *fiber.Ctx) error {
 	}
 
 	url := ssoOAuth.AuthCodeURL(RandomString)
-	fmt.Println(url)
 	return c.Redirect(url, 302)
 }
 
 func GoogleCallback(c *fiber.Ctx) error {
 	state := c.Params("state")
 	code := c.Params("code")
-	data, err := getUserData(state, code)
+	data, err := getUserData(c.UserContext(), state, code)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Error getting User data", Data: &fiber.Map{"error": "Something went wrong, getting User data"}})
+		return responses.Upstream("Error getting User data", err)
 	}
-	fmt.Println(data, "data")
+	common.Logger(c.UserContext()).Debug("google user data received", "bytes", len(data))
 	return nil
 }
 
-func getUserData(state, code string) ([]byte, error) {
+func getUserData(ctx context.Context, state, code string) ([]byte, error) {
 	if state != RandomString {
-		fmt.Println("Invalid state")
 		return nil, errors.New("invalid state")
 	}
-	token, err := ssoOAuth.Exchange(context.Background(), code)
+	token, err := ssoOAuth.Exchange(ctx, code)
 	if err != nil {
 		return nil, err
 	}
@@ -304,7 +295,6 @@ func getUserData(state, code string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(response)
 	defer response.Body.Close()
 	data, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -312,3 +302,20 @@ func getUserData(state, code string) ([]byte, error) {
 	}
 	return data, nil
 }
+
+// accountEmail is a message about a user's account, its template links back to
+// the frontend for the user's email.
+func accountEmail(user models.User, template, subject string) utils.Email {
+	return utils.Email{
+		To:       []utils.Recipient{utils.UserRecipient(user)},
+		Subject:  subject,
+		Template: template,
+		Locale:   user.Locale,
+		Data: map[string]string{
+			"Email":       user.Email,
+			"FirstName":   user.FirstName,
+			"LastName":    user.LastName,
+			"FrontendUrl": common.FrontendUrl(),
+		},
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+)
+
+// blockingBookings matches the bookings that keep a room taken on any night from
+// checkIn to checkOut: all of them except expired holds and holds that have run
+// out but were not swept yet, and cancelled bookings.
+func blockingBookings(roomID string, checkIn, checkOut time.Time, now time.Time) bson.M {
+	return bson.M{
+		"roomId":   roomID,
+		"checkIn":  bson.M{"$lt": checkOut},
+		"checkOut": bson.M{"$gt": checkIn},
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$nin": bson.A{models.BookingHeld, models.BookingExpired, models.BookingCancelled}}},
+			bson.M{"status": models.BookingHeld, "holdExpiresAt": bson.M{"$gt": now}},
+		},
+	}
+}
+
+// claimRoom checks that a room is free from checkIn to checkOut, leaving out the
+// booking excludeID when one is being moved. It must run in a transaction with
+// the write that takes the room: bumping the room's counter makes concurrent
+// transactions for the same room conflict, so the one that retries sees the
+// booking the other made.
+func claimRoom(ctx context.Context, roomID string, checkIn, checkOut time.Time, excludeID string) error {
+	_, err := common.GetDBCollection(COUNTER_MODEL).UpdateOne(ctx,
+		bson.M{"_id": "room-" + roomID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+	filter := blockingBookings(roomID, checkIn, checkOut, time.Now())
+	if excludeID != "" {
+		objectId, err := primitive.ObjectIDFromHex(excludeID)
+		if err != nil {
+			return err
+		}
+		filter["_id"] = bson.M{"$ne": objectId}
+	}
+	taken, err := common.GetDBCollection(BOOKING_MODEL).CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return responses.Conflict("Room is not available for the selected dates")
+	}
+	return nil
+}
+
+// ExpireBookingHolds releases the rooms of holds that ran out unpaid, along with
+// the promotion uses they took. It runs as a background job.
+func ExpireBookingHolds(ctx context.Context) error {
+	bookingCollection := common.GetDBCollection(BOOKING_MODEL)
+	now := time.Now()
+	cursor, err := bookingCollection.Find(ctx, bson.M{"status": models.BookingHeld, "holdExpiresAt": bson.M{"$lte": now}})
+	if err != nil {
+		return err
+	}
+	bookings := make([]GetBookingDTO, 0)
+	if err := cursor.All(ctx, &bookings); err != nil {
+		return err
+	}
+
+	expired := 0
+	for _, booking := range bookings {
+		objectId, err := primitive.ObjectIDFromHex(booking.ID)
+		if err != nil {
+			continue
+		}
+		// a payment may confirm the booking between the find and this update
+		result, err := bookingCollection.UpdateOne(ctx,
+			bson.M{"_id": objectId, "status": models.BookingHeld, "holdExpiresAt": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"status": models.BookingExpired, "bookingUpdatedDate": now}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		if booking.Promotion != nil {
+			if err := releasePromotion(ctx, booking.Promotion, booking.ID); err != nil {
+				common.Logger(ctx).Error("failed to release promotion", "bookingId", booking.ID, "error", err)
+			}
+		}
+		common.BookingHoldsExpired.Inc()
+		expired++
+	}
+	if expired > 0 {
+		common.Logger(ctx).Info("expired booking holds", "count", expired)
+	}
+	return nil
+}
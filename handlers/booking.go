@@ -3,121 +3,261 @@ package handlers
 import (
 	"context"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/chiboycalix/hotel-booking-system-backend/common"
 	"github.com/chiboycalix/hotel-booking-system-backend/models"
 	"github.com/chiboycalix/hotel-booking-system-backend/responses"
 	"github.com/chiboycalix/hotel-booking-system-backend/utils"
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var BOOKING_MODEL = "bookings"
 
 type CreateBookingDTO struct {
-	RoomID             string    `json:"roomId" bson:"roomId" validate:"required"`
-	GuestID            string    `json:"guestId" bson:"guestId"`
-	CheckIn            time.Time `json:"checkIn" bson:"checkIn" validate:"required"`
-	CheckOut           time.Time `json:"checkOut" bson:"checkOut" validate:"required"`
-	BookingDate        time.Time `json:"bookingDate" bson:"bookingDate"`
-	BookingUpdatedDate time.Time `json:"bookingUpdatedDate" bson:"bookingUpdatedDate"`
+	RoomID             string                   `json:"roomId" bson:"roomId" validate:"required"`
+	GroupID            string                   `json:"-" bson:"groupId,omitempty"`
+	GuestID            string                   `json:"guestId" bson:"guestId"`
+	CheckIn            time.Time                `json:"checkIn" bson:"checkIn" validate:"required"`
+	CheckOut           time.Time                `json:"checkOut" bson:"checkOut" validate:"required,gtfield=CheckIn"`
+	Guests             []models.BookingGuest    `json:"guests" bson:"guests" validate:"omitempty,dive"`
+	RatePlanID         string                   `json:"ratePlanId" bson:"-"`
+	Currency           string                   `json:"currency" bson:"-" validate:"omitempty,iso4217"`
+	PromoCode          string                   `json:"promoCode" bson:"-"`
+	Promotion          *models.AppliedPromotion `json:"-" bson:"promotion,omitempty"`
+	Quote              models.PriceQuote        `json:"-" bson:"quote"`
+	Status             string                   `json:"-" bson:"status"`
+	HoldExpiresAt      *time.Time               `json:"-" bson:"holdExpiresAt"`
+	BookingDate        time.Time                `json:"bookingDate" bson:"bookingDate"`
+	BookingUpdatedDate time.Time                `json:"bookingUpdatedDate" bson:"bookingUpdatedDate"`
 }
 
+// UpdateBookingDTO is a modification of a booking, fields left out keep their
+// current value.
 type UpdateBookingDTO struct {
-	RoomID             string    `json:"roomId" bson:"roomId" validate:"required"`
-	CheckIn            time.Time `json:"checkIn" bson:"checkIn" validate:"required"`
-	CheckOut           time.Time `json:"checkOut" bson:"checkOut" validate:"required"`
-	BookingDate        time.Time `json:"bookingDate" bson:"bookingDate" validate:"required"`
-	BookingUpdatedDate time.Time `json:"bookingUpdatedDate" bson:"bookingUpdatedDate"`
+	RoomID     string                `json:"roomId"`
+	CheckIn    time.Time             `json:"checkIn"`
+	CheckOut   time.Time             `json:"checkOut"`
+	Guests     []models.BookingGuest `json:"guests" validate:"omitempty,dive"`
+	RatePlanID string                `json:"ratePlanId"`
+}
+
+type UpdateBookingGuestsDTO struct {
+	Guests []models.BookingGuest `json:"guests" bson:"guests" validate:"required,min=1,dive"`
 }
 
 type GetBookingDTO struct {
-	ID                 string    `json:"id" bson:"_id"`
-	RoomID             string    `json:"roomId" bson:"roomId"`
-	GuestID            string    `json:"guestId" bson:"guestId"`
-	CheckIn            time.Time `json:"checkIn" bson:"checkIn"`
-	CheckOut           time.Time `json:"checkOut" bson:"checkOut"`
-	BookingDate        time.Time `json:"bookingDate" bson:"bookingDate"`
-	BookingUpdatedDate time.Time `json:"bookingUpdatedDate" bson:"bookingUpdatedDate"`
+	ID                 string                   `json:"id" bson:"_id"`
+	RoomID             string                   `json:"roomId" bson:"roomId"`
+	GroupID            string                   `json:"groupId" bson:"groupId,omitempty"`
+	GuestID            string                   `json:"guestId" bson:"guestId"`
+	CheckIn            time.Time                `json:"checkIn" bson:"checkIn"`
+	CheckOut           time.Time                `json:"checkOut" bson:"checkOut"`
+	Guests             []models.BookingGuest    `json:"guests" bson:"guests"`
+	Quote              models.PriceQuote        `json:"quote" bson:"quote"`
+	Promotion          *models.AppliedPromotion `json:"promotion" bson:"promotion,omitempty"`
+	Status             string                   `json:"status" bson:"status"`
+	HoldExpiresAt      *time.Time               `json:"holdExpiresAt" bson:"holdExpiresAt"`
+	ConfirmedAt        *time.Time               `json:"confirmedAt" bson:"confirmedAt"`
+	CancelledAt        *time.Time               `json:"cancelledAt" bson:"cancelledAt"`
+	CheckedInAt        *time.Time               `json:"checkedInAt" bson:"checkedInAt"`
+	CheckedInBy        string                   `json:"checkedInBy" bson:"checkedInBy"`
+	CheckedOutAt       *time.Time               `json:"checkedOutAt" bson:"checkedOutAt"`
+	CheckedOutBy       string                   `json:"checkedOutBy" bson:"checkedOutBy"`
+	Changes            []models.BookingChange   `json:"changes" bson:"changes"`
+	ReminderSentAt     *time.Time               `json:"reminderSentAt" bson:"reminderSentAt"`
+	ThankYouSentAt     *time.Time               `json:"thankYouSentAt" bson:"thankYouSentAt"`
+	BookingDate        time.Time                `json:"bookingDate" bson:"bookingDate"`
+	BookingUpdatedDate time.Time                `json:"bookingUpdatedDate" bson:"bookingUpdatedDate"`
 }
 
 func CreateBooking(c *fiber.Ctx) error {
 	bookingCollection := common.GetDBCollection(BOOKING_MODEL)
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
 	var createBookingDTO CreateBookingDTO
-	var header = c.Get("Authorization")
-	tokenString := strings.Split(header, " ")[1]
+	if err := parseBody(c, &createBookingDTO); err != nil {
+		return err
+	}
 
-	if err := c.BodyParser(&createBookingDTO); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": "Please provide request body"}})
+	// front desk staff may book on behalf of a registered user
+	if createBookingDTO.GuestID == "" || !claims.IsStaff() {
+		createBookingDTO.GuestID = claims.ID
+	}
+	if _, err := findUser(c, createBookingDTO.GuestID); err != nil {
+		return err
+	}
+	if err := validateBookingGuests(c, claims, createBookingDTO.Guests); err != nil {
+		return err
 	}
 
-	if validationErr := validate.Struct(&createBookingDTO); validationErr != nil {
-		for _, err := range validationErr.(validator.ValidationErrors) {
-			return c.Status(http.StatusBadRequest).
-				JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": err.Field() + " is required"}})
+	// the price is fixed when the booking is made
+	room, err := findRoom(c, createBookingDTO.RoomID)
+	if err != nil {
+		return err
+	}
+	plan, err := ratePlanForRoom(c, room, createBookingDTO.RatePlanID)
+	if err != nil {
+		return err
+	}
+	var promotion *models.Promotion
+	if createBookingDTO.PromoCode != "" {
+		if promotion, err = findPromotionByCode(c, createBookingDTO.PromoCode); err != nil {
+			return err
 		}
 	}
-
-	userId, err := utils.GetUserID(tokenString, common.EnvJWTSecret(), c)
+	createBookingDTO.Quote, err = quoteStay(c, stay{
+		Room: room, Plan: plan, CheckIn: createBookingDTO.CheckIn, CheckOut: createBookingDTO.CheckOut,
+		Guests: len(createBookingDTO.Guests), Currency: createBookingDTO.Currency, Promotion: promotion,
+	})
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return err
 	}
-
-	createBookingDTO.GuestID = userId
-	createBookingDTO.BookingDate = time.Now()
-	createBookingDTO.BookingUpdatedDate = time.Now()
-	result, err := bookingCollection.InsertOne(c.Context(), createBookingDTO)
+	if promotion != nil {
+		createBookingDTO.Promotion = appliedPromotion(promotion, createBookingDTO.Quote)
+	}
+	// the room is held while the guest pays and confirmed once paid, see
+	// CreateBookingPayment; unpaid holds are released by ExpireBookingHolds
+	now := time.Now()
+	holdExpiresAt := now.Add(common.BookingHold())
+	createBookingDTO.Status = models.BookingHeld
+	createBookingDTO.HoldExpiresAt = &holdExpiresAt
+	createBookingDTO.BookingDate = now
+	createBookingDTO.BookingUpdatedDate = now
+	var result *mongo.InsertOneResult
+	err = common.WithTransaction(c.UserContext(), func(ctx context.Context) error {
+		if err := claimRoom(ctx, createBookingDTO.RoomID, createBookingDTO.CheckIn, createBookingDTO.CheckOut, ""); err != nil {
+			return err
+		}
+		if result, err = bookingCollection.InsertOne(ctx, createBookingDTO); err != nil {
+			return err
+		}
+		if promotion == nil {
+			return nil
+		}
+		return redeemPromotion(ctx, promotion, models.Redemption{
+			PromotionID: createBookingDTO.Promotion.PromotionID,
+			Code:        createBookingDTO.Promotion.Code,
+			UserID:      createBookingDTO.GuestID,
+			BookingID:   hexID(result.InsertedID),
+			Discount:    createBookingDTO.Promotion.Discount,
+			RedeemedAt:  now,
+		})
+	})
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.FromDB(err, "Booking")
 	}
+	common.BookingsCreated.Inc()
+	utils.Audit(c, BOOKING_MODEL, hexID(result.InsertedID), nil, createBookingDTO)
 
 	return c.Status(http.StatusCreated).
-		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Bookings created successfully", Data: &fiber.Map{"booking": result}})
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Bookings created successfully", Data: &fiber.Map{"booking": result, "quote": createBookingDTO.Quote, "holdExpiresAt": holdExpiresAt}})
 }
 
+// GetAllBookings lists bookings with their room and guest, all of them for staff
+// and only their own for guests. Staff may filter by status, guestId and roomId.
 func GetAllBookings(c *fiber.Ctx) error {
-	bookingCollection := common.GetDBCollection(BOOKING_MODEL)
-	bookings := make([]GetBookingDTO, 0)
-	cursor, err := bookingCollection.Find(c.Context(), bson.M{})
+	claims, err := utils.ClaimsFromRequest(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return err
 	}
-
-	// iterate over the cursor
-	for cursor.Next(c.Context()) {
-		booking := GetBookingDTO{}
-		err := cursor.Decode(&booking)
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).
-				JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+	filter := bson.M{}
+	for _, field := range []string{"status", "guestId", "roomId"} {
+		if value := c.Query(field); value != "" {
+			filter[field] = value
 		}
-		bookings = append(bookings, booking)
 	}
+	if !claims.IsStaff() {
+		filter["guestId"] = claims.ID
+	}
+	return listBookings(c, filter)
+}
 
-	// Iterate through bookings and populate user and room information
+// GetMyBookings lists the caller's own bookings, upcoming=true leaves out stays
+// that are over.
+func GetMyBookings(c *fiber.Ctx) error {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"guestId": claims.ID}
+	if c.QueryBool("upcoming") {
+		filter["checkOut"] = bson.M{"$gt": time.Now()}
+		filter["checkedOutAt"] = nil
+	}
+	return listBookings(c, filter)
+}
+
+// GetBooking returns a booking with its room and guest, for its guest or staff.
+func GetBooking(c *fiber.Ctx) error {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	if !claims.IsStaff() && booking.GuestID != claims.ID {
+		return responses.Forbidden("You can only view your own bookings")
+	}
+	populated, err := populateBookings(c, []GetBookingDTO{booking})
+	if err != nil {
+		return err
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Booking fetched successfully", Data: &fiber.Map{"booking": populated[0]}})
+}
+
+func listBookings(c *fiber.Ctx, filter bson.M) error {
+	opts := options.Find().SetSort(bson.D{{Key: "checkIn", Value: -1}}).SetLimit(200)
+	cursor, err := common.GetDBCollection(BOOKING_MODEL).Find(c.UserContext(), filter, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	bookings := make([]GetBookingDTO, 0)
+	if err := cursor.All(c.UserContext(), &bookings); err != nil {
+		return responses.Internal(err)
+	}
+	populatedBooking, err := populateBookings(c, bookings)
+	if err != nil {
+		return err
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "bookings fetched successfully", Data: &fiber.Map{"bookings": populatedBooking}})
+}
+
+// populateBookings pairs each booking with its room and guest, the guest as the
+// public UsersDTO.
+func populateBookings(c *fiber.Ctx, bookings []GetBookingDTO) ([]map[string]interface{}, error) {
 	populatedBooking := []map[string]interface{}{}
 
 	for _, booking := range bookings {
 		roomObjectId, _ := primitive.ObjectIDFromHex(booking.RoomID)
 		guestObjectId, _ := primitive.ObjectIDFromHex(booking.GuestID)
 		room := models.Room{}
-		guest := models.User{}
-		if err := common.GetDBCollection("rooms").FindOne(context.Background(), bson.M{"_id": roomObjectId}).Decode(&room); err != nil {
-			return c.Status(http.StatusInternalServerError).
-				JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		guest := UsersDTO{}
+		if err := common.GetDBCollection(ROOM_MODEL).FindOne(c.UserContext(), bson.M{"_id": roomObjectId}).Decode(&room); err != nil {
+			return nil, responses.FromDB(err, "Room")
 		}
 
-		if err := common.GetDBCollection("users").FindOne(context.Background(), bson.M{"_id": guestObjectId}).Decode(&guest); err != nil {
-			return c.Status(http.StatusInternalServerError).
-				JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		// guests read their own bookings, never hand out the password hash
+		userOpts := options.FindOne().SetProjection(bson.M{"password": 0})
+		if err := common.GetDBCollection(USERS_MODEL).FindOne(c.UserContext(), bson.M{"_id": guestObjectId}, userOpts).Decode(&guest); err != nil {
+			return nil, responses.FromDB(err, "User")
+		}
+		if err := openFields(&guest); err != nil {
+			return nil, err
 		}
 
 		// Combine booking, room and user information
@@ -129,86 +269,367 @@ func GetAllBookings(c *fiber.Ctx) error {
 
 		populatedBooking = append(populatedBooking, booking)
 	}
+	return populatedBooking, nil
+}
+
+// UpdateBooking modifies the room, dates, guests or rate plan of a booking, see
+// modifyBooking. Staff may modify any booking and guests only their own.
+func UpdateBooking(c *fiber.Ctx) error {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	var b UpdateBookingDTO
+	if err := parseBody(c, &b); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	if err := guestMayModify(claims, booking); err != nil {
+		return err
+	}
+
+	updated, change, err := modifyBooking(c, booking, b, claims)
+	if err != nil {
+		return err
+	}
+	utils.AuditAction(c, "modify", BOOKING_MODEL, booking.ID, booking, updated)
 
 	return c.Status(http.StatusOK).
-		JSON(responses.APIResponse{Status: http.StatusOK, Message: "bookings fetched successfully", Data: &fiber.Map{"bookings": populatedBooking}})
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Booking update was successful", Data: &fiber.Map{"booking": updated, "change": change}})
 }
 
-func UpdateBooking(c *fiber.Ctx) error {
+// UpdateBookingGuests replaces the adults and children staying under a booking,
+// staff may edit any booking and guests only their own. The stay is re-priced
+// when the number of guests changes.
+func UpdateBookingGuests(c *fiber.Ctx) error {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	var b UpdateBookingGuestsDTO
+	if err := parseBody(c, &b); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	if err := guestMayModify(claims, booking); err != nil {
+		return err
+	}
+
+	updated, change, err := modifyBooking(c, booking, UpdateBookingDTO{Guests: b.Guests}, claims)
+	if err != nil {
+		return err
+	}
+	utils.AuditAction(c, "update-guests", BOOKING_MODEL, booking.ID, booking, updated)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Booking guests updated", Data: &fiber.Map{"booking": updated, "change": change}})
+}
+
+// ConfirmBooking turns a held booking into a confirmed one without an online
+// payment, for guests who settle at the front desk.
+func ConfirmBooking(c *fiber.Ctx) error {
+	if _, err := utils.RequireStaff(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	switch booking.Status {
+	case models.BookingHeld, models.BookingExpired, models.BookingPendingPayment:
+	case models.BookingCancelled:
+		return responses.Conflict("Booking is cancelled")
+	default:
+		return responses.Conflict("Booking is already confirmed")
+	}
+	if err := confirmBooking(c.UserContext(), booking.ID); err != nil {
+		return responses.Internal(err)
+	}
+	confirmed, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	if confirmed.Status != models.BookingConfirmed {
+		return responses.Conflict("Room is no longer available for the booked dates")
+	}
+	utils.AuditAction(c, "confirm", BOOKING_MODEL, booking.ID, booking, confirmed)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Booking confirmed", Data: &fiber.Map{"booking": confirmed}})
+}
+
+// CancelBooking cancels a booking and frees its room, guests may cancel their
+// own upcoming bookings. Payments are refunded separately through
+// POST /payments/:id/refund.
+func CancelBooking(c *fiber.Ctx) error {
 	bookingCollection := common.GetDBCollection(BOOKING_MODEL)
-	var b UpdateBookingDTO
-	if err := c.BodyParser(&b); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	if err := guestMayModify(claims, booking); err != nil {
+		return err
+	}
+	switch {
+	case booking.Status == models.BookingCancelled:
+		return responses.Conflict("Booking is already cancelled")
+	case booking.Status == models.BookingExpired:
+		return responses.Conflict("Booking hold has expired")
+	case booking.CheckedInAt != nil:
+		return responses.Conflict("Booking is already checked in")
 	}
 
-	id := c.Params("id")
-	if id == "" {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Id is required"}})
+	now := time.Now()
+	update := bson.M{"status": models.BookingCancelled, "cancelledAt": now, "bookingUpdatedDate": now}
+	result, err := bookingCollection.UpdateOne(c.UserContext(),
+		bson.M{"_id": objectId, "status": bson.M{"$nin": bson.A{models.BookingCancelled, models.BookingExpired}}, "checkedInAt": nil},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	if result.ModifiedCount == 0 {
+		return responses.Conflict("Booking was changed in the meantime, please try again")
 	}
-	if validationErr := validate.Struct(&b); validationErr != nil {
-		for _, err := range validationErr.(validator.ValidationErrors) {
-			return c.Status(http.StatusBadRequest).
-				JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": err.Field() + " is required"}})
+	if booking.Promotion != nil {
+		if err := releasePromotion(c.UserContext(), booking.Promotion, booking.ID); err != nil {
+			common.Logger(c.UserContext()).Error("failed to release promotion", "bookingId", booking.ID, "error", err)
 		}
 	}
+	common.BookingsCancelled.Inc()
+	utils.AuditAction(c, "cancel", BOOKING_MODEL, booking.ID, booking, update)
+	if err := notifyBooking(c.UserContext(), mailBookingCancelled, "Your booking is cancelled", booking, nil); err != nil {
+		return err
+	}
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Booking cancelled", Data: &fiber.Map{"bookingId": booking.ID}})
+}
 
-	objectId, err := primitive.ObjectIDFromHex(id)
+// CheckInBooking marks the start of a stay. Every adult on the booking must have an
+// unexpired identity document on file, captured through POST /guests/:id/documents.
+func CheckInBooking(c *fiber.Ctx) error {
+	bookingCollection := common.GetDBCollection(BOOKING_MODEL)
+	claims, err := utils.RequireStaff(c)
+	if err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
 	booking := GetBookingDTO{}
+	if err := bookingCollection.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&booking); err != nil {
+		return responses.FromDB(err, "Booking")
+	}
+	if booking.CheckedInAt != nil {
+		return responses.Conflict("Booking is already checked in")
+	}
+	switch booking.Status {
+	case models.BookingHeld, models.BookingPendingPayment:
+		return responses.Conflict("Booking is not paid yet")
+	case models.BookingExpired:
+		return responses.Conflict("Booking hold has expired")
+	case models.BookingCancelled:
+		return responses.Conflict("Booking is cancelled")
+	}
+	if len(booking.Guests) == 0 {
+		return responses.BadRequest("Add the guests staying under the booking before check-in")
+	}
 
-	err = bookingCollection.FindOne(c.Context(), bson.M{"_id": objectId}).Decode(&booking)
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+	now := time.Now()
+	for _, g := range booking.Guests {
+		if g.AgeGroup != models.AgeGroupAdult {
+			continue
+		}
+		guestObjectId, err := parseObjectID(g.GuestID)
+		if err != nil {
+			return err
+		}
+		guest, err := findGuest(c, guestObjectId)
+		if err != nil {
+			return err
+		}
+		if !hasValidDocument(guest, now) {
+			return responses.BadRequest("Guest " + guest.FirstName + " " + guest.LastName + " has no valid identity document")
+		}
 	}
 
-	b.BookingUpdatedDate = time.Now()
-	b.BookingDate = booking.BookingDate
-	result, err := bookingCollection.UpdateOne(c.Context(), bson.M{"_id": objectId}, bson.M{"$set": b})
+	update := bson.M{"checkedInAt": now, "checkedInBy": claims.ID, "bookingUpdatedDate": now}
+	result, err := bookingCollection.UpdateOne(c.UserContext(), bson.M{"_id": objectId}, bson.M{"$set": update})
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Failed to update booking", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
+	utils.AuditAction(c, "check-in", BOOKING_MODEL, booking.ID, booking, update)
 
 	return c.Status(http.StatusOK).
-		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Booking update was successful", Data: &fiber.Map{"booking": result}})
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Guest checked in", Data: &fiber.Map{"booking": result}})
 }
 
-func DeleteBooking(c *fiber.Ctx) error {
-	id := c.Params("id")
+// CheckOutBooking ends a stay, closes its folio and issues the invoice, and a
+// receipt as well when nothing is left to pay. The check-out and its documents
+// commit together, a failed invoice leaves the booking checked in to retry.
+func CheckOutBooking(c *fiber.Ctx) error {
 	bookingCollection := common.GetDBCollection(BOOKING_MODEL)
-	var header = c.Get("Authorization")
-	tokenString := strings.Split(header, " ")[1]
-	isAdmin, err := utils.IsAdmin(tokenString, common.EnvJWTSecret(), c)
+	claims, err := utils.RequireStaff(c)
+	if err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return err
 	}
-	if !isAdmin {
-		return c.Status(http.StatusUnauthorized).
-			JSON(responses.APIResponse{Status: http.StatusUnauthorized, Message: "Unauthorized", Data: &fiber.Map{"error": "Unauthorized"}})
+	if booking.CheckedInAt == nil {
+		return responses.Conflict("Booking is not checked in")
 	}
-	if id == "" {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Id is required"}})
+	if booking.CheckedOutAt != nil {
+		return responses.Conflict("Booking is already checked out")
 	}
-	objectId, err := primitive.ObjectIDFromHex(id)
+
+	now := time.Now()
+	update := bson.M{"checkedOutAt": now, "checkedOutBy": claims.ID, "bookingUpdatedDate": now}
+	var issued []models.Invoice
+	err = common.WithTransaction(c.UserContext(), func(ctx context.Context) error {
+		issued = nil
+		result, err := bookingCollection.UpdateOne(ctx, bson.M{"_id": objectId, "checkedOutAt": nil}, bson.M{"$set": update})
+		if err != nil {
+			return responses.Internal(err)
+		}
+		if result.ModifiedCount == 0 {
+			return responses.Conflict("Booking is already checked out")
+		}
+		invoice, err := issueInvoice(ctx, booking, models.KindInvoice, claims.ID)
+		if err != nil {
+			return err
+		}
+		issued = append(issued, invoice)
+		if invoice.Folio.Balance <= 0 {
+			receipt, err := issueInvoice(ctx, booking, models.KindReceipt, claims.ID)
+			if err != nil {
+				return err
+			}
+			issued = append(issued, receipt)
+		}
+		return nil
+	})
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return responses.FromDB(err, "Booking")
 	}
+	utils.AuditAction(c, "check-out", BOOKING_MODEL, booking.ID, booking, update)
+
+	documents := fiber.Map{}
+	for _, invoice := range issued {
+		auditInvoice(c, invoice)
+		documents[invoice.Kind] = invoice
+	}
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Guest checked out", Data: &documents})
+}
 
-	result, err := bookingCollection.DeleteOne(c.Context(), bson.M{"_id": objectId})
+func DeleteBooking(c *fiber.Ctx) error {
+	bookingCollection := common.GetDBCollection(BOOKING_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Fail to delete booking"}})
+		return err
 	}
+
+	// the deleted document is the one whose status decides the release below,
+	// a cancel landing between a read and the delete can't release twice
+	booking := GetBookingDTO{}
+	if err := bookingCollection.FindOneAndDelete(c.UserContext(), bson.M{"_id": objectId}).Decode(&booking); err != nil {
+		return responses.FromDB(err, "Booking")
+	}
+	result := &mongo.DeleteResult{DeletedCount: 1}
+	// cancelling and expiring a booking already gave its promotion use back
+	if booking.Status != models.BookingCancelled && booking.Status != models.BookingExpired {
+		if booking.Promotion != nil {
+			if err := releasePromotion(c.UserContext(), booking.Promotion, booking.ID); err != nil {
+				common.Logger(c.UserContext()).Error("failed to release promotion", "bookingId", booking.ID, "error", err)
+			}
+		}
+		common.BookingsCancelled.Inc()
+	}
+	utils.Audit(c, BOOKING_MODEL, booking.ID, booking, nil)
 	return c.Status(http.StatusOK).
 		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Booking deleted successfully", Data: &fiber.Map{"data": result}})
 }
+
+// RoomOccupancy is the share of rooms with a stay in progress, it backs the occupancy gauge.
+func RoomOccupancy() float64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rooms, err := common.GetDBCollection(ROOM_MODEL).CountDocuments(ctx, bson.M{})
+	if err != nil || rooms == 0 {
+		return 0
+	}
+	now := time.Now()
+	occupied, err := common.GetDBCollection(BOOKING_MODEL).Distinct(ctx, "roomId", bson.M{
+		"checkIn":  bson.M{"$lte": now},
+		"checkOut": bson.M{"$gt": now},
+		"status":   bson.M{"$nin": bson.A{models.BookingExpired, models.BookingCancelled}},
+	})
+	if err != nil {
+		return 0
+	}
+	return float64(len(occupied)) / float64(rooms)
+}
+
+// guestMayModify lets guests change only their own bookings and only before the
+// stay starts, staff may change any booking.
+func guestMayModify(claims utils.JWTClaim, booking GetBookingDTO) error {
+	if claims.IsStaff() {
+		return nil
+	}
+	if booking.GuestID != claims.ID {
+		return responses.Forbidden("You can only change your own bookings")
+	}
+	if booking.CheckedInAt != nil || !booking.CheckIn.After(time.Now()) {
+		return responses.Forbidden("Only upcoming bookings can be changed, please contact the front desk")
+	}
+	return nil
+}
+
+func findBooking(c *fiber.Ctx, objectId primitive.ObjectID) (GetBookingDTO, error) {
+	var booking GetBookingDTO
+	err := common.GetDBCollection(BOOKING_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&booking)
+	if err != nil {
+		return GetBookingDTO{}, responses.FromDB(err, "Booking")
+	}
+	return booking, nil
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+// modifyBooking moves a booking to another room, other dates or another number
+// of guests. The new room must be free for the new dates, and the stay is priced
+// again under the current rate plans, keeping the booking's currency and
+// promotion. A higher total is left owing and paid through
+// POST /bookings/:id/payments; when the new total is below what was paid, the
+// difference is refunded. Every modification is kept on the booking in Changes.
+func modifyBooking(c *fiber.Ctx, booking GetBookingDTO, dto UpdateBookingDTO, claims utils.JWTClaim) (GetBookingDTO, models.BookingChange, error) {
+	switch {
+	case booking.Status == models.BookingExpired,
+		booking.Status == models.BookingHeld && booking.HoldExpiresAt != nil && booking.HoldExpiresAt.Before(time.Now()):
+		return GetBookingDTO{}, models.BookingChange{}, responses.Conflict("Booking hold has expired")
+	case booking.Status == models.BookingCancelled:
+		return GetBookingDTO{}, models.BookingChange{}, responses.Conflict("Booking is cancelled")
+	case booking.CheckedOutAt != nil:
+		return GetBookingDTO{}, models.BookingChange{}, responses.Conflict("Booking is checked out")
+	}
+
+	before := bookingTerms(booking)
+	after := before
+	if dto.RoomID != "" {
+		after.RoomID = dto.RoomID
+	}
+	if !dto.CheckIn.IsZero() {
+		after.CheckIn = dto.CheckIn
+	}
+	if !dto.CheckOut.IsZero() {
+		after.CheckOut = dto.CheckOut
+	}
+	guests := booking.Guests
+	if dto.Guests != nil {
+		if err := validateBookingGuests(c, claims, dto.Guests); err != nil {
+			return GetBookingDTO{}, models.BookingChange{}, err
+		}
+		guests = dto.Guests
+		after.Guests = len(guests)
+	}
+	if !after.CheckOut.After(after.CheckIn) {
+		return GetBookingDTO{}, models.BookingChange{}, responses.BadRequest("checkOut must be after checkIn")
+	}
+	moved := after.RoomID != before.RoomID || !after.CheckIn.Equal(before.CheckIn) || !after.CheckOut.Equal(before.CheckOut)
+	if booking.CheckedInAt != nil && (after.RoomID != before.RoomID || !after.CheckIn.Equal(before.CheckIn)) {
+		return GetBookingDTO{}, models.BookingChange{}, responses.Conflict("Booking is checked in, only the check-out date and guests can change")
+	}
+
+	// the plan is kept unless another is asked for or the room changes
+	room, err := findRoom(c, after.RoomID)
+	if err != nil {
+		return GetBookingDTO{}, models.BookingChange{}, err
+	}
+	planID := dto.RatePlanID
+	if planID == "" && after.RoomID == before.RoomID {
+		planID = before.RatePlanID
+	}
+	plan, err := ratePlanForRoom(c, room, planID)
+	if err != nil {
+		return GetBookingDTO{}, models.BookingChange{}, err
+	}
+	var promotion *models.Promotion
+	if booking.Promotion != nil {
+		objectId, err := parseObjectID(booking.Promotion.PromotionID)
+		if err != nil {
+			return GetBookingDTO{}, models.BookingChange{}, err
+		}
+		// a promotion deleted since the booking was made no longer applies
+		if p, err := findPromotion(c, objectId); err == nil {
+			promotion = &p
+		}
+	}
+	quote, err := quoteStay(c, stay{
+		Room: room, Plan: plan, CheckIn: after.CheckIn, CheckOut: after.CheckOut,
+		Guests: len(guests), Currency: booking.Quote.Currency, Promotion: promotion,
+	})
+	if err != nil {
+		return GetBookingDTO{}, models.BookingChange{}, err
+	}
+	after.RatePlanID = quote.RatePlanID
+	after.Total = quote.Total
+	if after == before && reflect.DeepEqual(guests, booking.Guests) {
+		return GetBookingDTO{}, models.BookingChange{}, responses.BadRequest("Nothing to change")
+	}
+
+	now := time.Now()
+	change := models.BookingChange{
+		Before:     before,
+		After:      after,
+		Difference: after.Total - before.Total,
+		Currency:   quote.Currency,
+		ChangedBy:  claims.ID,
+		ChangedAt:  now,
+	}
+	var applied *models.AppliedPromotion
+	if promotion != nil {
+		applied = appliedPromotion(promotion, quote)
+	}
+	objectId, err := parseObjectID(booking.ID)
+	if err != nil {
+		return GetBookingDTO{}, models.BookingChange{}, err
+	}
+	err = common.WithTransaction(c.UserContext(), func(ctx context.Context) error {
+		if moved {
+			if err := claimRoom(ctx, after.RoomID, after.CheckIn, after.CheckOut, booking.ID); err != nil {
+				return err
+			}
+		}
+		// a booking changed by someone else since it was read is not overwritten
+		result, err := common.GetDBCollection(BOOKING_MODEL).UpdateOne(ctx,
+			bson.M{"_id": objectId, "bookingUpdatedDate": booking.BookingUpdatedDate},
+			bson.M{
+				"$set": bson.M{
+					"roomId": after.RoomID, "checkIn": after.CheckIn, "checkOut": after.CheckOut, "guests": guests,
+					"quote": quote, "promotion": applied, "bookingUpdatedDate": now,
+				},
+				"$push": bson.M{"changes": change},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return responses.Conflict("Booking was changed in the meantime, please try again")
+		}
+		return nil
+	})
+	if err != nil {
+		return GetBookingDTO{}, models.BookingChange{}, responses.FromDB(err, "Booking")
+	}
+
+	refunded, err := refundOverpayment(c.UserContext(), booking.ID, after.Total, claims.ID)
+	if err != nil {
+		// the booking is changed either way, staff refund what is left from the payments
+		common.Logger(c.UserContext()).Error("failed to refund booking overpayment", "bookingId", booking.ID, "error", err)
+	}
+	if refunded > 0 {
+		change.Refunded = refunded
+		field := fmt.Sprintf("changes.%d.refunded", len(booking.Changes))
+		if _, err := common.GetDBCollection(BOOKING_MODEL).UpdateOne(c.UserContext(), bson.M{"_id": objectId}, bson.M{"$set": bson.M{field: refunded}}); err != nil {
+			common.Logger(c.UserContext()).Error("failed to record booking refund", "bookingId", booking.ID, "error", err)
+		}
+	}
+
+	updated, err := findBooking(c, objectId)
+	if err != nil {
+		return GetBookingDTO{}, models.BookingChange{}, err
+	}
+	err = notifyBooking(c.UserContext(), mailBookingModified, "Your booking has changed", updated, func(m *bookingMail) {
+		m.Difference = formatAmount(change.Difference, change.Currency) + " " + change.Currency
+		m.Refunded = formatAmount(change.Refunded, change.Currency) + " " + change.Currency
+	})
+	return updated, change, err
+}
+
+// refundOverpayment pays back what was captured for a booking beyond its total,
+// newest payment first, and returns the amount refunded.
+func refundOverpayment(ctx context.Context, bookingID string, total int64, refundedBy string) (int64, error) {
+	payments, err := bookingPayments(ctx, bookingID)
+	if err != nil {
+		return 0, err
+	}
+	var paid int64
+	for _, p := range payments {
+		paid += p.Balance()
+	}
+	excess := paid - total
+	if excess <= 0 {
+		return 0, nil
+	}
+
+	sort.SliceStable(payments, func(i, j int) bool { return payments[i].CreatedAt.After(payments[j].CreatedAt) })
+	var refunded int64
+	var errs []error
+	for _, payment := range payments {
+		if excess <= 0 {
+			break
+		}
+		amount := payment.Captured - payment.Refunded
+		if !settled(payment.Status) || amount <= 0 {
+			continue
+		}
+		if amount > excess {
+			amount = excess
+		}
+		_, refund, err := refundPayment(ctx, payment, amount, "booking modified", refundedBy)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if refund.Status != "failed" {
+			refunded += amount
+			excess -= amount
+		}
+	}
+	return refunded, errors.Join(errs...)
+}
+
+func bookingTerms(booking GetBookingDTO) models.BookingTerms {
+	return models.BookingTerms{
+		RoomID:     booking.RoomID,
+		CheckIn:    booking.CheckIn,
+		CheckOut:   booking.CheckOut,
+		Guests:     len(booking.Guests),
+		RatePlanID: booking.Quote.RatePlanID,
+		Total:      booking.Quote.Total,
+	}
+}
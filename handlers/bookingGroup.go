@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var BOOKING_GROUP_MODEL = "booking_groups"
+
+type BookingLineDTO struct {
+	RoomID     string                `json:"roomId"     validate:"required"`
+	CheckIn    time.Time             `json:"checkIn"    validate:"required"`
+	CheckOut   time.Time             `json:"checkOut"   validate:"required,gtfield=CheckIn"`
+	Guests     []models.BookingGuest `json:"guests"     validate:"omitempty,dive"`
+	RatePlanID string                `json:"ratePlanId"`
+}
+
+type CreateBookingGroupDTO struct {
+	Name     string           `json:"name"     validate:"required,max=200"`
+	LeaderID string           `json:"leaderId"`
+	Currency string           `json:"currency" validate:"omitempty,iso4217"`
+	Lines    []BookingLineDTO `json:"lines"    validate:"required,min=1,max=100,dive"`
+}
+
+// CreateBookingGroup books several rooms at once, each line with its own dates
+// and guests. Either every room is free and all lines are booked, or nothing is.
+// The lines are held until paid like any booking and are owned by the group
+// leader, the caller unless staff books for a registered user.
+func CreateBookingGroup(c *fiber.Ctx) error {
+	bookingCollection := common.GetDBCollection(BOOKING_MODEL)
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	var dto CreateBookingGroupDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	if dto.LeaderID == "" || !claims.IsStaff() {
+		dto.LeaderID = claims.ID
+	}
+	if _, err := findUser(c, dto.LeaderID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	holdExpiresAt := now.Add(common.BookingHold())
+	bookings := make([]CreateBookingDTO, len(dto.Lines))
+	for i, line := range dto.Lines {
+		if err := validateBookingGuests(c, claims, line.Guests); err != nil {
+			return err
+		}
+		room, err := findRoom(c, line.RoomID)
+		if err != nil {
+			return err
+		}
+		plan, err := ratePlanForRoom(c, room, line.RatePlanID)
+		if err != nil {
+			return err
+		}
+		quote, err := quoteStay(c, stay{
+			Room: room, Plan: plan, CheckIn: line.CheckIn, CheckOut: line.CheckOut,
+			Guests: len(line.Guests), Currency: dto.Currency,
+		})
+		if err != nil {
+			return err
+		}
+		// one invoice covers the group, so all lines are priced in one currency
+		if dto.Currency == "" {
+			dto.Currency = quote.Currency
+		} else if quote.Currency != dto.Currency {
+			return responses.BadRequest("All rooms of a group must be priced in the same currency, set currency")
+		}
+		bookings[i] = CreateBookingDTO{
+			RoomID:             line.RoomID,
+			GuestID:            dto.LeaderID,
+			CheckIn:            line.CheckIn,
+			CheckOut:           line.CheckOut,
+			Guests:             line.Guests,
+			Quote:              quote,
+			Status:             models.BookingHeld,
+			HoldExpiresAt:      &holdExpiresAt,
+			BookingDate:        now,
+			BookingUpdatedDate: now,
+		}
+	}
+
+	group := models.BookingGroup{
+		Name:      dto.Name,
+		LeaderID:  dto.LeaderID,
+		Currency:  dto.Currency,
+		Status:    models.GroupActive,
+		CreatedBy: claims.ID,
+		CreatedAt: now,
+	}
+	err = common.WithTransaction(c.UserContext(), func(ctx context.Context) error {
+		groupCollection := common.GetDBCollection(BOOKING_GROUP_MODEL)
+		group.ID, group.BookingIDs = "", make([]string, 0, len(bookings))
+		inserted, err := groupCollection.InsertOne(ctx, group)
+		if err != nil {
+			return err
+		}
+		group.ID = hexID(inserted.InsertedID)
+		for i, booking := range bookings {
+			// lines booked earlier in the transaction count, so two lines can't share a room either
+			if err := claimRoom(ctx, booking.RoomID, booking.CheckIn, booking.CheckOut, ""); err != nil {
+				var appErr *responses.AppError
+				if errors.As(err, &appErr) {
+					return responses.Conflict(fmt.Sprintf("Room of line %d is not available for the selected dates", i+1))
+				}
+				return err
+			}
+			booking.GroupID = group.ID
+			result, err := bookingCollection.InsertOne(ctx, booking)
+			if err != nil {
+				return err
+			}
+			group.BookingIDs = append(group.BookingIDs, hexID(result.InsertedID))
+		}
+		_, err = groupCollection.UpdateOne(ctx, bson.M{"_id": inserted.InsertedID}, bson.M{"$set": bson.M{"bookingIds": group.BookingIDs}})
+		return err
+	})
+	if err != nil {
+		return responses.FromDB(err, "Booking group")
+	}
+	common.BookingsCreated.Add(float64(len(bookings)))
+	utils.Audit(c, BOOKING_GROUP_MODEL, group.ID, nil, group)
+
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Group booked successfully", Data: &fiber.Map{"group": group, "holdExpiresAt": holdExpiresAt}})
+}
+
+// GetBookingGroup returns a group with its bookings, for its leader or staff.
+func GetBookingGroup(c *fiber.Ctx) error {
+	group, err := bookingGroupForCaller(c)
+	if err != nil {
+		return err
+	}
+	bookings, err := groupBookings(c.UserContext(), group)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Booking group fetched successfully", Data: &fiber.Map{"group": group, "bookings": bookings}})
+}
+
+// CancelBookingGroup cancels every booking of a group and frees their rooms. It
+// is refused once any guest of the group has checked in. Payments are refunded
+// separately through POST /payments/:id/refund.
+func CancelBookingGroup(c *fiber.Ctx) error {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	group, err := bookingGroupForCaller(c)
+	if err != nil {
+		return err
+	}
+	if group.Status == models.GroupCancelled {
+		return responses.Conflict("Booking group is already cancelled")
+	}
+	bookings, err := groupBookings(c.UserContext(), group)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	for _, booking := range bookings {
+		if booking.CheckedInAt != nil {
+			return responses.Conflict("Guests of the group have already checked in")
+		}
+		if booking.Status == models.BookingCancelled {
+			continue
+		}
+		// the leader owns every booking of the group, so it is held to the same
+		// upcoming-stay rule as a single booking
+		if err := guestMayModify(claims, booking); err != nil {
+			return err
+		}
+	}
+
+	groupObjectId, err := parseObjectID(group.ID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = common.WithTransaction(c.UserContext(), func(ctx context.Context) error {
+		_, err := common.GetDBCollection(BOOKING_MODEL).UpdateMany(ctx,
+			bson.M{"groupId": group.ID, "checkedInAt": nil, "status": bson.M{"$ne": models.BookingCancelled}},
+			bson.M{"$set": bson.M{"status": models.BookingCancelled, "cancelledAt": now, "bookingUpdatedDate": now}},
+		)
+		if err != nil {
+			return err
+		}
+		result, err := common.GetDBCollection(BOOKING_GROUP_MODEL).UpdateOne(ctx,
+			bson.M{"_id": groupObjectId, "status": models.GroupActive},
+			bson.M{"$set": bson.M{"status": models.GroupCancelled, "cancelledAt": now, "cancelledBy": claims.ID}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return responses.Conflict("Booking group is already cancelled")
+		}
+		return nil
+	})
+	if err != nil {
+		return responses.FromDB(err, "Booking group")
+	}
+	common.BookingsCancelled.Add(float64(len(bookings)))
+	if err := sendBookingMail(c.UserContext(), mailBookingCancelled, "Your group booking is cancelled", group.Name, bookings, nil); err != nil {
+		common.Logger(c.UserContext()).Error("booking email not sent", "groupId", group.ID, "template", mailBookingCancelled, "error", err)
+	}
+	utils.AuditAction(c, "cancel", BOOKING_GROUP_MODEL, group.ID, group, bson.M{"status": models.GroupCancelled, "cancelledBy": claims.ID})
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Booking group cancelled", Data: &fiber.Map{"groupId": group.ID}})
+}
+
+// IssueGroupInvoice issues one invoice or receipt for all bookings of a group,
+// billed to the group leader.
+func IssueGroupInvoice(c *fiber.Ctx) error {
+	claims, err := utils.RequireStaff(c)
+	if err != nil {
+		return err
+	}
+	var dto IssueInvoiceDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	group, err := bookingGroupForCaller(c)
+	if err != nil {
+		return err
+	}
+	bookings, err := groupBookings(c.UserContext(), group)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	folio, err := buildGroupFolio(c, group, bookings)
+	if err != nil {
+		return err
+	}
+	leader, err := findUser(c, group.LeaderID)
+	if err != nil {
+		return err
+	}
+	invoice, err := saveInvoice(c.UserContext(), models.Invoice{
+		Kind:     dto.Kind,
+		GroupID:  group.ID,
+		UserID:   group.LeaderID,
+		BilledTo: strings.TrimSpace(leader.FirstName + " " + leader.LastName),
+		Folio:    folio,
+		IssuedBy: claims.ID,
+	})
+	if err != nil {
+		return err
+	}
+	auditInvoice(c, invoice)
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Invoice issued successfully", Data: &fiber.Map{"invoice": invoice}})
+}
+
+// GetGroupInvoices lists the invoices and receipts issued for a group.
+func GetGroupInvoices(c *fiber.Ctx) error {
+	group, err := bookingGroupForCaller(c)
+	if err != nil {
+		return err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "issuedAt", Value: 1}})
+	cursor, err := common.GetDBCollection(INVOICE_MODEL).Find(c.UserContext(), bson.M{"groupId": group.ID}, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	invoices := make([]models.Invoice, 0)
+	if err := cursor.All(c.UserContext(), &invoices); err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Invoices fetched successfully", Data: &fiber.Map{"invoices": invoices}})
+}
+
+// buildGroupFolio merges the folios of a group's bookings, cancelled ones left
+// out, each line labelled with its room.
+func buildGroupFolio(c *fiber.Ctx, group models.BookingGroup, bookings []GetBookingDTO) (models.Folio, error) {
+	folio := models.Folio{
+		Currency:      group.Currency,
+		Lines:         make([]models.FolioLine, 0),
+		IncludedTaxes: make([]models.TaxLine, 0),
+	}
+	for _, booking := range bookings {
+		if booking.Status == models.BookingCancelled {
+			continue
+		}
+		room, err := findRoom(c, booking.RoomID)
+		if err != nil {
+			return models.Folio{}, err
+		}
+		bookingFolio, err := buildFolio(c.UserContext(), booking)
+		if err != nil {
+			return models.Folio{}, responses.Internal(err)
+		}
+		for _, line := range bookingFolio.Lines {
+			line.Description = fmt.Sprintf("Room %d - %s", room.RoomNumber, line.Description)
+			folio.Lines = append(folio.Lines, line)
+		}
+		folio.IncludedTaxes = append(folio.IncludedTaxes, bookingFolio.IncludedTaxes...)
+	}
+
+	sort.SliceStable(folio.Lines, func(i, j int) bool { return folio.Lines[i].Date.Before(folio.Lines[j].Date) })
+	for i, line := range folio.Lines {
+		folio.Balance += line.Amount
+		folio.Lines[i].Balance = folio.Balance
+		switch line.Type {
+		case models.FolioPayment, models.FolioRefund:
+			folio.Paid -= line.Amount
+		default:
+			folio.Charges += line.Amount
+		}
+	}
+	return folio, nil
+}
+
+// bookingGroupForCaller loads the group in the path if the caller leads it or is staff.
+func bookingGroupForCaller(c *fiber.Ctx) (models.BookingGroup, error) {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return models.BookingGroup{}, err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return models.BookingGroup{}, err
+	}
+	var group models.BookingGroup
+	if err := common.GetDBCollection(BOOKING_GROUP_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&group); err != nil {
+		return models.BookingGroup{}, responses.FromDB(err, "Booking group")
+	}
+	if !claims.IsStaff() && group.LeaderID != claims.ID {
+		return models.BookingGroup{}, responses.Forbidden("You can only view your own bookings")
+	}
+	return group, nil
+}
+
+func groupBookings(ctx context.Context, group models.BookingGroup) ([]GetBookingDTO, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "checkIn", Value: 1}})
+	cursor, err := common.GetDBCollection(BOOKING_MODEL).Find(ctx, bson.M{"groupId": group.ID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	bookings := make([]GetBookingDTO, 0)
+	if err := cursor.All(ctx, &bookings); err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+// booking email templates
+const (
+	mailBookingConfirmed = "booking-confirmed"
+	mailBookingModified  = "booking-modified"
+	mailBookingCancelled = "booking-cancelled"
+	mailArrivalReminder  = "booking-reminder"
+	mailThankYou         = "booking-thank-you"
+)
+
+// thankYouWindow bounds how long after check-out a thank-you is still sent, so
+// stays that ended before these emails existed are left alone.
+const thankYouWindow = 7 * 24 * time.Hour
+
+type stayMail struct {
+	Room     string
+	CheckIn  string
+	CheckOut string
+	Nights   int
+	Guests   int
+}
+
+// bookingMail is the data booking templates are rendered with.
+type bookingMail struct {
+	FirstName   string
+	Reference   string
+	Stays       []stayMail
+	Total       string
+	Difference  string // modifications only
+	Refunded    string // modifications only
+	FrontendUrl string
+}
+
+// sendBookingMail queues an email to the guest of one or more bookings, several
+// for a group, under reference. Booking emails are a courtesy: failures are
+// logged and never fail the change that caused them.
+func sendBookingMail(ctx context.Context, template, subject, reference string, bookings []GetBookingDTO, extra func(*bookingMail)) error {
+	if len(bookings) == 0 {
+		return nil
+	}
+	user, err := loadUser(ctx, bookings[0].GuestID)
+	if err != nil {
+		return err
+	}
+	data := bookingMail{FirstName: user.FirstName, Reference: reference, FrontendUrl: common.FrontendUrl()}
+	var total int64
+	for _, booking := range bookings {
+		stay := stayMail{
+			CheckIn:  booking.CheckIn.Format("Mon 2 Jan 2006"),
+			CheckOut: booking.CheckOut.Format("Mon 2 Jan 2006"),
+			Nights:   len(booking.Quote.Nights),
+			Guests:   len(booking.Guests),
+		}
+		if room, err := loadRoom(ctx, booking.RoomID); err == nil {
+			stay.Room = fmt.Sprintf("%s %d", room.RoomName, room.RoomNumber)
+		}
+		data.Stays = append(data.Stays, stay)
+		total += booking.Quote.Total
+	}
+	data.Total = formatAmount(total, bookings[0].Quote.Currency) + " " + bookings[0].Quote.Currency
+	if extra != nil {
+		extra(&data)
+	}
+	return utils.EnqueueEmail(ctx, utils.Email{
+		To:       []utils.Recipient{utils.UserRecipient(user)},
+		Subject:  subject,
+		Template: template,
+		Locale:   user.Locale,
+		Data:     data,
+	})
+}
+
+// notifyBooking sends a booking email. Outside a transaction a failure is only
+// logged. Within one it is returned: the failed write has aborted the
+// transaction, and swallowing it would surface later as a puzzling commit error.
+func notifyBooking(ctx context.Context, template, subject string, booking GetBookingDTO, extra func(*bookingMail)) error {
+	err := sendBookingMail(ctx, template, subject, booking.ID, []GetBookingDTO{booking}, extra)
+	if err == nil {
+		return nil
+	}
+	if mongo.SessionFromContext(ctx) != nil {
+		return err
+	}
+	common.Logger(ctx).Error("booking email not sent", "bookingId", booking.ID, "template", template, "error", err)
+	return nil
+}
+
+// SendArrivalReminders reminds guests of confirmed stays starting within
+// BOOKING_REMINDER_DAYS. Each booking is reminded once. It runs as a background job.
+func SendArrivalReminders(ctx context.Context) error {
+	now := time.Now()
+	filter := bson.M{
+		"checkIn":        bson.M{"$gt": now, "$lte": now.AddDate(0, 0, common.ArrivalReminderDays())},
+		"status":         bson.M{"$nin": bson.A{models.BookingHeld, models.BookingExpired, models.BookingPendingPayment, models.BookingCancelled}},
+		"checkedInAt":    nil,
+		"reminderSentAt": nil,
+	}
+	sent, err := sendOnce(ctx, filter, "reminderSentAt", func(booking GetBookingDTO) error {
+		return sendBookingMail(ctx, mailArrivalReminder, "Your stay is coming up", booking.ID, []GetBookingDTO{booking}, nil)
+	})
+	if sent > 0 {
+		common.Logger(ctx).Info("sent arrival reminders", "count", sent)
+	}
+	return err
+}
+
+// SendThankYouEmails thanks guests who checked out recently. It runs as a
+// background job.
+func SendThankYouEmails(ctx context.Context) error {
+	now := time.Now()
+	filter := bson.M{
+		"checkedOutAt":   bson.M{"$lte": now, "$gt": now.Add(-thankYouWindow)},
+		"thankYouSentAt": nil,
+	}
+	sent, err := sendOnce(ctx, filter, "thankYouSentAt", func(booking GetBookingDTO) error {
+		return sendBookingMail(ctx, mailThankYou, "Thank you for staying with us", booking.ID, []GetBookingDTO{booking}, nil)
+	})
+	if sent > 0 {
+		common.Logger(ctx).Info("sent thank-you emails", "count", sent)
+	}
+	return err
+}
+
+// sendOnce sends an email for each booking matching filter, marking it in
+// sentField first so that concurrent runs don't send twice. A failed email is
+// unmarked to be tried again on the next run.
+func sendOnce(ctx context.Context, filter bson.M, sentField string, send func(GetBookingDTO) error) (int, error) {
+	bookingCollection := common.GetDBCollection(BOOKING_MODEL)
+	cursor, err := bookingCollection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	bookings := make([]GetBookingDTO, 0)
+	if err := cursor.All(ctx, &bookings); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, booking := range bookings {
+		objectId, err := primitive.ObjectIDFromHex(booking.ID)
+		if err != nil {
+			continue
+		}
+		result, err := bookingCollection.UpdateOne(ctx,
+			bson.M{"_id": objectId, sentField: nil},
+			bson.M{"$set": bson.M{sentField: time.Now()}},
+		)
+		if err != nil {
+			return sent, err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		if err := send(booking); err != nil {
+			common.Logger(ctx).Error("booking email not sent", "bookingId", booking.ID, "field", sentField, "error", err)
+			if _, err := bookingCollection.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{"$set": bson.M{sentField: nil}}); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
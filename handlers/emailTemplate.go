@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+// SaveEmailTemplateDTO replaces the subject, HTML or text of a template in one
+// locale, empty fields keep what the template has. Subject and bodies are Go
+// templates rendered with the same data as the embedded template.
+type SaveEmailTemplateDTO struct {
+	Locale  string `json:"locale"  validate:"omitempty,bcp47_language_tag"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+type emailTemplateInfo struct {
+	Name    string   `json:"name"`
+	Locales []string `json:"locales"`
+}
+
+// GetEmailTemplates lists the built-in email templates with the locales they
+// come in, and the overrides admins have saved.
+func GetEmailTemplates(c *fiber.Ctx) error {
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	locales, err := utils.EmailTemplateLocales()
+	if err != nil {
+		return responses.Internal(err)
+	}
+	templates := make([]emailTemplateInfo, 0, len(locales))
+	for name, l := range locales {
+		sort.Strings(l)
+		templates = append(templates, emailTemplateInfo{Name: name, Locales: l})
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "locale", Value: 1}})
+	cursor, err := common.GetDBCollection(utils.EMAIL_TEMPLATE_MODEL).Find(c.UserContext(), bson.M{}, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	overrides := make([]models.EmailTemplate, 0)
+	if err := cursor.All(c.UserContext(), &overrides); err != nil {
+		return responses.Internal(err)
+	}
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Email templates fetched successfully", Data: &fiber.Map{"templates": templates, "overrides": overrides}})
+}
+
+// SaveEmailTemplate overrides a template's subject or bodies for a locale,
+// replacing an earlier override of the same template and locale.
+func SaveEmailTemplate(c *fiber.Ctx) error {
+	claims, err := utils.RequireAdmin(c)
+	if err != nil {
+		return err
+	}
+	var dto SaveEmailTemplateDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	if dto.Subject == "" && dto.HTML == "" && dto.Text == "" {
+		return responses.BadRequest("Nothing to override, set a subject, html or text")
+	}
+	override := models.EmailTemplate{
+		Name:      c.Params("name"),
+		Locale:    utils.NormalizeLocale(dto.Locale),
+		Subject:   dto.Subject,
+		HTML:      dto.HTML,
+		Text:      dto.Text,
+		UpdatedBy: claims.ID,
+		UpdatedAt: time.Now(),
+	}
+	if err := utils.ValidateEmailTemplate(override); err != nil {
+		return responses.BadRequest(err.Error())
+	}
+
+	filter := bson.M{"name": override.Name, "locale": override.Locale}
+	err = common.GetDBCollection(utils.EMAIL_TEMPLATE_MODEL).FindOneAndReplace(c.UserContext(), filter, override,
+		options.FindOneAndReplace().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&override)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.AuditAction(c, "override", utils.EMAIL_TEMPLATE_MODEL, override.ID, nil, override)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Email template saved", Data: &fiber.Map{"override": override}})
+}
+
+// DeleteEmailTemplate removes an override, ?locale= picks the locale, so the
+// template goes back to what is built in.
+func DeleteEmailTemplate(c *fiber.Ctx) error {
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var override models.EmailTemplate
+	filter := bson.M{"name": c.Params("name"), "locale": utils.NormalizeLocale(c.Query("locale"))}
+	err := common.GetDBCollection(utils.EMAIL_TEMPLATE_MODEL).FindOneAndDelete(c.UserContext(), filter).Decode(&override)
+	if err != nil {
+		return responses.FromDB(err, "Email template override")
+	}
+	utils.AuditAction(c, "delete", utils.EMAIL_TEMPLATE_MODEL, override.ID, override, nil)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Email template override deleted"})
+}
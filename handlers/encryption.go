@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+// EncryptedModels maps each collection holding encrypted fields to the model
+// whose `encrypt` tags describe them, the re-encryption command walks it.
+var EncryptedModels = map[string]interface{}{
+	USERS_MODEL: models.User{},
+	GUEST_MODEL: models.Guest{},
+}
+
+// normalizeEmail is the form emails are stored and looked up in. Lookup
+// encryption matches exact values, so every path writing or matching an email
+// must go through it.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// emailFilter matches a user's email in its normal form, and as typed for rows
+// the re-encryption run has not normalized yet.
+func emailFilter(email string) (bson.M, error) {
+	normalized, err := utils.LookupValues(normalizeEmail(email))
+	if err != nil {
+		return nil, responses.Internal(err)
+	}
+	asTyped, err := utils.LookupValues(strings.TrimSpace(email))
+	if err != nil {
+		return nil, responses.Internal(err)
+	}
+	return bson.M{"email": bson.M{"$in": append(normalized, asTyped...)}}, nil
+}
+
+// lookupFilter matches field, stored with `encrypt:"lookup"`, against value.
+func lookupFilter(field, value string) (bson.M, error) {
+	in, err := utils.LookupFilter(value)
+	if err != nil {
+		return nil, responses.Internal(err)
+	}
+	return bson.M{field: in}, nil
+}
+
+func sealFields(v interface{}) error {
+	if err := utils.SealFields(v); err != nil {
+		return responses.Internal(err)
+	}
+	return nil
+}
+
+func openFields(v interface{}) error {
+	if err := utils.OpenFields(v); err != nil {
+		return responses.Internal(err)
+	}
+	return nil
+}
+
+// MigrateLegacyPhoneNumbers seals the phone numbers users stored as numbers
+// before phoneNumber became an encrypted string. Those documents no longer
+// decode into models.User, so main runs it at startup, before the server takes
+// requests. Documents already migrated are not matched, a second run changes nothing.
+func MigrateLegacyPhoneNumbers(ctx context.Context) (int, error) {
+	coll := common.GetDBCollection(USERS_MODEL)
+	cursor, err := coll.Find(ctx,
+		bson.M{"phoneNumber": bson.M{"$type": "number"}},
+		options.Find().SetProjection(bson.M{"phoneNumber": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return migrated, err
+		}
+		plain, ok := utils.LegacyNumber(doc["phoneNumber"])
+		if !ok {
+			continue
+		}
+		sealed, err := utils.EncryptLookup(plain)
+		if err != nil {
+			return migrated, err
+		}
+		// a user who changed their number meanwhile keeps the new one
+		_, err = coll.UpdateOne(ctx,
+			bson.M{"_id": doc["_id"], "phoneNumber": doc["phoneNumber"]},
+			bson.M{"$set": bson.M{"phoneNumber": sealed}},
+		)
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, cursor.Err()
+}
+
+// ReencryptCollection seals every encrypted field of a collection under the
+// active key, covering rows written before encryption or under a retired key,
+// and normalizes emails stored before they were lowercased. With dryRun it
+// only counts the documents that would change.
+func ReencryptCollection(ctx context.Context, collection string, dryRun bool) (int, error) {
+	model := EncryptedModels[collection]
+	coll := common.GetDBCollection(collection)
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return updated, err
+		}
+		if err := normalizeStoredEmail(doc); err != nil {
+			return updated, err
+		}
+		changed, err := utils.ResealDocument(doc, model)
+		if err != nil {
+			return updated, err
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		if !dryRun {
+			if _, err := coll.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, bson.M{"$set": changed}); err != nil {
+				return updated, err
+			}
+		}
+		updated++
+	}
+	return updated, cursor.Err()
+}
+
+// normalizeStoredEmail replaces a document's email by its plaintext normal form
+// when the stored one differs, ResealDocument then seals it again.
+func normalizeStoredEmail(doc bson.M) error {
+	stored, ok := doc["email"].(string)
+	if !ok || stored == "" {
+		return nil
+	}
+	email, err := utils.DecryptString(stored)
+	if err != nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	if normalized := normalizeEmail(email); normalized != email {
+		doc["email"] = normalized
+	}
+	return nil
+}
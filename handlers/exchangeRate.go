@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var EXCHANGE_RATE_MODEL = "exchange_rates"
+
+type SetExchangeRateDTO struct {
+	Rate float64 `json:"rate" validate:"required,gt=0"`
+}
+
+// GetExchangeRates lists the rates against the base currency.
+func GetExchangeRates(c *fiber.Ctx) error {
+	rateCollection := common.GetDBCollection(EXCHANGE_RATE_MODEL)
+	cursor, err := rateCollection.Find(c.UserContext(), bson.M{}, options.Find().SetSort(bson.D{{Key: "currency", Value: 1}}))
+	if err != nil {
+		return responses.Internal(err)
+	}
+	rates := make([]models.ExchangeRate, 0)
+	if err := cursor.All(c.UserContext(), &rates); err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Exchange rates fetched successfully", Data: &fiber.Map{"baseCurrency": common.BaseCurrency(), "rates": rates}})
+}
+
+// SetExchangeRate creates or replaces the rate of the currency in the path.
+func SetExchangeRate(c *fiber.Ctx) error {
+	claims, err := utils.RequireAdmin(c)
+	if err != nil {
+		return err
+	}
+	var b SetExchangeRateDTO
+	if err := parseBody(c, &b); err != nil {
+		return err
+	}
+	currency, err := rateCurrency(c.Params("currency"))
+	if err != nil {
+		return err
+	}
+
+	before, err := findExchangeRate(c.UserContext(), currency)
+	if err != nil {
+		return err
+	}
+	rate := models.ExchangeRate{Currency: currency, Rate: b.Rate, Source: "manual", UpdatedBy: claims.ID, UpdatedAt: time.Now()}
+	if err := upsertExchangeRate(c.UserContext(), rate); err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, EXCHANGE_RATE_MODEL, currency, before, rate)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Exchange rate saved", Data: &fiber.Map{"rate": rate}})
+}
+
+// ImportExchangeRates reads a CSV upload ("file") of currency,rate rows, a header
+// row is optional. Nothing is saved unless every row is valid.
+func ImportExchangeRates(c *fiber.Ctx) error {
+	claims, err := utils.RequireAdmin(c)
+	if err != nil {
+		return err
+	}
+	formHeader, err := c.FormFile("file")
+	if err != nil || formHeader == nil {
+		return responses.BadRequest("A CSV file is required")
+	}
+	file, err := formHeader.Open()
+	if err != nil {
+		return responses.Internal(err)
+	}
+	defer file.Close()
+
+	rates, err := parseExchangeRatesCSV(file)
+	if err != nil {
+		return responses.BadRequest(err.Error())
+	}
+	now := time.Now()
+	err = common.WithTransaction(c.UserContext(), func(ctx context.Context) error {
+		for i := range rates {
+			rates[i].Source = "csv"
+			rates[i].UpdatedBy = claims.ID
+			rates[i].UpdatedAt = now
+			if err := upsertExchangeRate(ctx, rates[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.AuditAction(c, "import", EXCHANGE_RATE_MODEL, "", nil, bson.M{"rates": rates})
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: fmt.Sprintf("Imported %d exchange rates", len(rates)), Data: &fiber.Map{"rates": rates}})
+}
+
+func DeleteExchangeRate(c *fiber.Ctx) error {
+	rateCollection := common.GetDBCollection(EXCHANGE_RATE_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	currency, err := rateCurrency(c.Params("currency"))
+	if err != nil {
+		return err
+	}
+	rate, err := findExchangeRate(c.UserContext(), currency)
+	if err != nil {
+		return err
+	}
+	if rate == nil {
+		return responses.NotFound("Exchange rate not found")
+	}
+
+	result, err := rateCollection.DeleteOne(c.UserContext(), bson.M{"currency": currency})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, EXCHANGE_RATE_MODEL, currency, rate, nil)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Exchange rate deleted successfully", Data: &fiber.Map{"data": result}})
+}
+
+func parseExchangeRatesCSV(r io.Reader) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	rates := make([]models.ExchangeRate, 0)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil && line == 1 {
+			continue // header
+		}
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("line %d: rate must be a positive number", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(record[0]), common.BaseCurrency()) {
+			continue // exported tables often list the base currency at 1
+		}
+		currency, err := rateCurrency(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s is not a currency code", line, record[0])
+		}
+		rates = append(rates, models.ExchangeRate{Currency: currency, Rate: value})
+	}
+	if len(rates) == 0 {
+		return nil, errors.New("the file has no rates")
+	}
+	return rates, nil
+}
+
+// rateCurrency validates a currency code that can hold a rate, the base currency cannot.
+func rateCurrency(code string) (string, error) {
+	currency := strings.ToUpper(strings.TrimSpace(code))
+	if err := validate.Var(currency, "iso4217"); err != nil {
+		return "", responses.BadRequest(code + " is not an ISO 4217 currency code")
+	}
+	if currency == common.BaseCurrency() {
+		return "", responses.BadRequest("The base currency always has a rate of 1")
+	}
+	return currency, nil
+}
+
+func upsertExchangeRate(ctx context.Context, rate models.ExchangeRate) error {
+	_, err := common.GetDBCollection(EXCHANGE_RATE_MODEL).ReplaceOne(ctx,
+		bson.M{"currency": rate.Currency}, rate, options.Replace().SetUpsert(true))
+	return err
+}
+
+// findExchangeRate returns nil when the currency has no rate yet.
+func findExchangeRate(ctx context.Context, currency string) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := common.GetDBCollection(EXCHANGE_RATE_MODEL).FindOne(ctx, bson.M{"currency": currency}).Decode(&rate)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, responses.Internal(err)
+	}
+	return &rate, nil
+}
+
+// rateTable holds units of each currency per unit of the base currency.
+type rateTable map[string]float64
+
+func loadExchangeRates(ctx context.Context) (rateTable, error) {
+	cursor, err := common.GetDBCollection(EXCHANGE_RATE_MODEL).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	rates := make([]models.ExchangeRate, 0)
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	table := rateTable{common.BaseCurrency(): 1}
+	for _, r := range rates {
+		table[r.Currency] = r.Rate
+	}
+	return table, nil
+}
+
+func (t rateTable) rate(currency string) (float64, error) {
+	rate, ok := t[currency]
+	if !ok {
+		return 0, responses.BadRequest("No exchange rate for " + currency)
+	}
+	return rate, nil
+}
+
+// between is the units of to per unit of from, going through the base currency.
+func (t rateTable) between(from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	fromRate, err := t.rate(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := t.rate(to)
+	if err != nil {
+		return 0, err
+	}
+	return toRate / fromRate, nil
+}
+
+// convert changes an amount in minor units of from into minor units of to.
+func (t rateTable) convert(amount int64, from, to string) (int64, error) {
+	if from == to {
+		return amount, nil
+	}
+	rate, err := t.between(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return models.FromMajor(models.ToMajor(amount, from)*rate, to), nil
+}
+
+// localizeQuote renders a quote priced in its rate plan's currency in the
+// currency the guest asked for, and records its total in the base currency.
+// Lines are converted one by one and the totals summed again so they still add up.
+func localizeQuote(ctx context.Context, quote models.PriceQuote, currency string) (models.PriceQuote, error) {
+	from := quote.Currency
+	if currency == "" {
+		currency = from
+	}
+	currency = strings.ToUpper(currency)
+	rates, err := loadExchangeRates(ctx)
+	if err != nil {
+		return models.PriceQuote{}, responses.Internal(err)
+	}
+
+	convert := func(amount int64) (int64, error) { return rates.convert(amount, from, currency) }
+	out := quote
+	out.Currency = currency
+	out.Nights = make([]models.NightlyRate, len(quote.Nights))
+	out.Adjustments = make([]models.PriceAdjustment, len(quote.Adjustments))
+	out.Taxes = make([]models.TaxLine, len(quote.Taxes))
+	out.Subtotal = 0
+	for i, night := range quote.Nights {
+		if night.BaseAmount, err = convert(night.BaseAmount); err != nil {
+			return models.PriceQuote{}, err
+		}
+		if night.Amount, err = convert(night.Amount); err != nil {
+			return models.PriceQuote{}, err
+		}
+		out.Nights[i] = night
+		out.Subtotal += night.Amount
+	}
+	out.Total = out.Subtotal
+	for i, adjustment := range quote.Adjustments {
+		if adjustment.Amount, err = convert(adjustment.Amount); err != nil {
+			return models.PriceQuote{}, err
+		}
+		out.Adjustments[i] = adjustment
+		out.Total += adjustment.Amount
+	}
+	out.TaxTotal = 0
+	for i, tax := range quote.Taxes {
+		if tax.Amount, err = convert(tax.Amount); err != nil {
+			return models.PriceQuote{}, err
+		}
+		out.Taxes[i] = tax
+		if !tax.Inclusive {
+			out.TaxTotal += tax.Amount
+		}
+	}
+	out.Total += out.TaxTotal
+
+	base := common.BaseCurrency()
+	baseTotal, err := rates.convert(quote.Total, from, base)
+	if err != nil {
+		return models.PriceQuote{}, err
+	}
+	out.Charged = models.Money{Amount: out.Total, Currency: currency}
+	out.Base = models.Money{Amount: baseTotal, Currency: base}
+	// the rate the lines were converted at, from the plan's currency
+	out.ExchangeRate, err = rates.between(from, currency)
+	if err != nil {
+		return models.PriceQuote{}, err
+	}
+	return out, nil
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var FOLIO_CHARGE_MODEL = "folio_charges"
+
+type PostFolioChargeDTO struct {
+	Category    string `json:"category"    validate:"required,oneof=minibar laundry restaurant spa telephone other"`
+	Description string `json:"description" validate:"required,max=200"`
+	Quantity    int    `json:"quantity"    validate:"omitempty,min=1,max=1000"`
+	UnitAmount  int64  `json:"unitAmount"  validate:"required,gt=0"`
+}
+
+// GetFolio returns the account of a booking with its running balance, for its
+// guest or staff.
+func GetFolio(c *fiber.Ctx) error {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	if !claims.IsStaff() && booking.GuestID != claims.ID {
+		return responses.Forbidden("You can only view your own bookings")
+	}
+	folio, err := buildFolio(c.UserContext(), booking)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Folio fetched successfully", Data: &fiber.Map{"folio": folio}})
+}
+
+// PostFolioCharge adds an extra to a booking's folio, in the booking's currency.
+func PostFolioCharge(c *fiber.Ctx) error {
+	chargeCollection := common.GetDBCollection(FOLIO_CHARGE_MODEL)
+	claims, err := utils.RequireStaff(c)
+	if err != nil {
+		return err
+	}
+	var dto PostFolioChargeDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	if booking.CheckedOutAt != nil {
+		return responses.Conflict("Booking is checked out, its folio is closed")
+	}
+	if dto.Quantity == 0 {
+		dto.Quantity = 1
+	}
+
+	charge := models.FolioCharge{
+		BookingID:   booking.ID,
+		Category:    dto.Category,
+		Description: dto.Description,
+		Quantity:    dto.Quantity,
+		UnitAmount:  dto.UnitAmount,
+		Currency:    booking.Quote.Currency,
+		PostedBy:    claims.ID,
+		PostedAt:    time.Now(),
+	}
+	result, err := chargeCollection.InsertOne(c.UserContext(), charge)
+	if err != nil {
+		return responses.FromDB(err, "Charge")
+	}
+	charge.ID = hexID(result.InsertedID)
+	utils.Audit(c, FOLIO_CHARGE_MODEL, charge.ID, nil, charge)
+
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Charge posted successfully", Data: &fiber.Map{"charge": charge}})
+}
+
+// VoidFolioCharge takes a charge posted in error off the folio, it stays on record.
+func VoidFolioCharge(c *fiber.Ctx) error {
+	chargeCollection := common.GetDBCollection(FOLIO_CHARGE_MODEL)
+	claims, err := utils.RequireStaff(c)
+	if err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	chargeObjectId, err := parseObjectID(c.Params("chargeId"))
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	if booking.CheckedOutAt != nil {
+		return responses.Conflict("Booking is checked out, its folio is closed")
+	}
+
+	var charge models.FolioCharge
+	filter := bson.M{"_id": chargeObjectId, "bookingId": booking.ID}
+	if err := chargeCollection.FindOne(c.UserContext(), filter).Decode(&charge); err != nil {
+		return responses.FromDB(err, "Charge")
+	}
+	if charge.VoidedAt != nil {
+		return responses.Conflict("Charge is already void")
+	}
+	now := time.Now()
+	update := bson.M{"voidedAt": now, "voidedBy": claims.ID}
+	if _, err := chargeCollection.UpdateOne(c.UserContext(), filter, bson.M{"$set": update}); err != nil {
+		return responses.Internal(err)
+	}
+	utils.AuditAction(c, "void", FOLIO_CHARGE_MODEL, charge.ID, charge, update)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Charge voided successfully", Data: &fiber.Map{"chargeId": charge.ID}})
+}
+
+// buildFolio assembles a booking's folio from its quote, the extras posted to it
+// and its payments and refunds.
+func buildFolio(ctx context.Context, booking GetBookingDTO) (models.Folio, error) {
+	quote := booking.Quote
+	folio := models.Folio{
+		BookingID:     booking.ID,
+		Currency:      quote.Currency,
+		Lines:         make([]models.FolioLine, 0),
+		IncludedTaxes: make([]models.TaxLine, 0),
+	}
+	for _, night := range quote.Nights {
+		folio.Lines = append(folio.Lines, models.FolioLine{
+			Date: night.Date, Type: models.FolioRoom, Description: "Room night",
+			Quantity: 1, UnitAmount: night.Amount, Amount: night.Amount, Reference: quote.RatePlanID,
+		})
+	}
+	stayDate := dateOf(booking.CheckIn)
+	for _, adjustment := range quote.Adjustments {
+		folio.Lines = append(folio.Lines, models.FolioLine{
+			Date: stayDate, Type: models.FolioAdjustment, Description: adjustment.Name,
+			Quantity: 1, UnitAmount: adjustment.Amount, Amount: adjustment.Amount, Reference: adjustment.RuleID,
+		})
+	}
+	for _, tax := range quote.Taxes {
+		if tax.Inclusive {
+			folio.IncludedTaxes = append(folio.IncludedTaxes, tax)
+			continue
+		}
+		folio.Lines = append(folio.Lines, models.FolioLine{
+			Date: stayDate, Type: models.FolioTax, Description: tax.Name,
+			Quantity: 1, UnitAmount: tax.Amount, Amount: tax.Amount, Reference: tax.TaxRuleID,
+		})
+	}
+
+	cursor, err := common.GetDBCollection(FOLIO_CHARGE_MODEL).Find(ctx,
+		bson.M{"bookingId": booking.ID, "voidedAt": nil},
+		options.Find().SetSort(bson.D{{Key: "postedAt", Value: 1}}),
+	)
+	if err != nil {
+		return models.Folio{}, err
+	}
+	charges := make([]models.FolioCharge, 0)
+	if err := cursor.All(ctx, &charges); err != nil {
+		return models.Folio{}, err
+	}
+	for _, charge := range charges {
+		folio.Lines = append(folio.Lines, models.FolioLine{
+			Date: charge.PostedAt, Type: models.FolioExtra, Description: charge.Description,
+			Quantity: charge.Quantity, UnitAmount: charge.UnitAmount,
+			Amount: int64(charge.Quantity) * charge.UnitAmount, Reference: charge.ID,
+		})
+	}
+
+	payments, err := bookingPayments(ctx, booking.ID)
+	if err != nil {
+		return models.Folio{}, err
+	}
+	for _, payment := range payments {
+		if payment.Captured == 0 {
+			continue
+		}
+		folio.Lines = append(folio.Lines, models.FolioLine{
+			Date: payment.UpdatedAt, Type: models.FolioPayment, Description: "Payment via " + payment.Provider,
+			Quantity: 1, UnitAmount: -payment.Captured, Amount: -payment.Captured, Reference: payment.ID,
+		})
+		for _, refund := range payment.Refunds {
+			if refund.Status == "failed" {
+				continue
+			}
+			folio.Lines = append(folio.Lines, models.FolioLine{
+				Date: refund.CreatedAt, Type: models.FolioRefund, Description: "Refund to " + payment.Provider,
+				Quantity: 1, UnitAmount: refund.Amount, Amount: refund.Amount, Reference: payment.ID,
+			})
+		}
+	}
+
+	sort.SliceStable(folio.Lines, func(i, j int) bool { return folio.Lines[i].Date.Before(folio.Lines[j].Date) })
+	for i, line := range folio.Lines {
+		folio.Balance += line.Amount
+		folio.Lines[i].Balance = folio.Balance
+		switch line.Type {
+		case models.FolioPayment, models.FolioRefund:
+			folio.Paid -= line.Amount
+		default:
+			folio.Charges += line.Amount
+		}
+	}
+	return folio, nil
+}
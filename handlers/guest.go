@@ -1,17 +1,394 @@
 package handlers
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
 
 var GUEST_MODEL = "guests"
 
 type CreateGuestDTO struct {
-	FirstName string `json:"firstName" bson:"firstName" validate:"required"`
-	LastName  string `json:"lastName" bson:"lastName" validate:"required"`
-	Email     string `json:"email" bson:"email" validate:"required,email"`
-	Phone     string `json:"phone" bson:"phone" validate:"required"`
-	RoomID    string `json:"roomId" bson:"roomId"`
+	UserID      string `json:"userId"      bson:"userId,omitempty"`
+	FirstName   string `json:"firstName"   bson:"firstName"   validate:"required"`
+	LastName    string `json:"lastName"    bson:"lastName"    validate:"required"`
+	Email       string `json:"email"       bson:"email"       validate:"omitempty,email"`
+	Phone       string `json:"phone"       bson:"phone"`
+	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth"`
+}
+
+type UpdateGuestDTO struct {
+	FirstName   string `json:"firstName"   bson:"firstName,omitempty"`
+	LastName    string `json:"lastName"    bson:"lastName,omitempty"`
+	Email       string `json:"email"       bson:"email,omitempty"       validate:"omitempty,email" encrypt:"lookup"`
+	Phone       string `json:"phone"       bson:"phone,omitempty"                                encrypt:"lookup"`
+	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth,omitempty"                          encrypt:"random"`
+}
+
+type LinkGuestDTO struct {
+	UserID string `json:"userId" validate:"required"`
 }
 
+type SearchGuestsDTO struct {
+	Q     string `query:"q"`
+	Name  string `query:"name"`
+	Email string `query:"email"`
+	Phone string `query:"phone"`
+	Limit int64  `query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+// CreateGuest lets front desk staff register a guest, including walk-ins without an
+// account. A guest whose email matches a registered user is linked to that user.
 func CreateGuest(c *fiber.Ctx) error {
+	guestCollection := common.GetDBCollection(GUEST_MODEL)
+	claims, err := utils.RequireStaff(c)
+	if err != nil {
+		return err
+	}
+	var dto CreateGuestDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	dto.Email = normalizeEmail(dto.Email)
+	dto.Phone = strings.TrimSpace(dto.Phone)
+
+	if dto.UserID != "" {
+		if _, err := findUser(c, dto.UserID); err != nil {
+			return err
+		}
+	} else if dto.Email != "" {
+		filter, err := emailFilter(dto.Email)
+		if err != nil {
+			return err
+		}
+		var user models.User
+		err = common.GetDBCollection(USERS_MODEL).FindOne(c.UserContext(), filter).Decode(&user)
+		if err == nil {
+			dto.UserID = user.ID
+		}
+	}
+
+	now := time.Now()
+	guest := models.Guest{
+		UserID:      dto.UserID,
+		FirstName:   dto.FirstName,
+		LastName:    dto.LastName,
+		Email:       dto.Email,
+		Phone:       dto.Phone,
+		DateOfBirth: dto.DateOfBirth,
+		CreatedBy:   claims.ID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	sealed := guest
+	if err := sealFields(&sealed); err != nil {
+		return err
+	}
+	result, err := guestCollection.InsertOne(c.UserContext(), sealed)
+	if err != nil {
+		return responses.FromDB(err, "Guest")
+	}
+	guest.ID = hexID(result.InsertedID)
+	utils.Audit(c, GUEST_MODEL, guest.ID, nil, guest)
+
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Guest created successfully", Data: &fiber.Map{"guest": guest}})
+}
+
+// SearchGuests matches q against name, email and phone; name, email and phone narrow
+// the search to one field. Names match case insensitively by substring, email and
+// phone are encrypted so they only match in full.
+func SearchGuests(c *fiber.Ctx) error {
+	guestCollection := common.GetDBCollection(GUEST_MODEL)
+	if _, err := utils.RequireStaff(c); err != nil {
+		return err
+	}
+	var q SearchGuestsDTO
+	if err := c.QueryParser(&q); err != nil {
+		return responses.BadRequest("Invalid query parameters")
+	}
+	if err := validateStruct(&q); err != nil {
+		return err
+	}
+	if q.Limit == 0 {
+		q.Limit = 20
+	}
+
+	and := bson.A{}
+	if q.Q != "" {
+		rx := containsRegex(q.Q)
+		email, err := lookupFilter("email", normalizeEmail(q.Q))
+		if err != nil {
+			return err
+		}
+		phone, err := lookupFilter("phone", strings.TrimSpace(q.Q))
+		if err != nil {
+			return err
+		}
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"firstName": rx},
+			bson.M{"lastName": rx},
+			email,
+			phone,
+		}})
+	}
+	if q.Name != "" {
+		rx := containsRegex(q.Name)
+		and = append(and, bson.M{"$or": bson.A{bson.M{"firstName": rx}, bson.M{"lastName": rx}}})
+	}
+	if q.Email != "" {
+		email, err := lookupFilter("email", normalizeEmail(q.Email))
+		if err != nil {
+			return err
+		}
+		and = append(and, email)
+	}
+	if q.Phone != "" {
+		phone, err := lookupFilter("phone", strings.TrimSpace(q.Phone))
+		if err != nil {
+			return err
+		}
+		and = append(and, phone)
+	}
+	filter := bson.M{}
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "lastName", Value: 1}, {Key: "firstName", Value: 1}}).
+		SetLimit(q.Limit).
+		SetProjection(bson.M{"documents": 0})
+	cursor, err := guestCollection.Find(c.UserContext(), filter, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	guests := make([]models.Guest, 0)
+	if err := cursor.All(c.UserContext(), &guests); err != nil {
+		return responses.Internal(err)
+	}
+	for i := range guests {
+		if err := openFields(&guests[i]); err != nil {
+			return err
+		}
+	}
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Guests fetched successfully", Data: &fiber.Map{"guests": guests}})
+}
+
+func GetGuest(c *fiber.Ctx) error {
+	if _, err := utils.RequireStaff(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	guest, err := findGuest(c, objectId)
+	if err != nil {
+		return err
+	}
+	// full numbers are only served by GET /guests/:id/documents
+	for i := range guest.Documents {
+		guest.Documents[i].Number = maskDocumentNumber(guest.Documents[i].Number)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Guest fetched successfully", Data: &fiber.Map{"guest": guest}})
+}
+
+func UpdateGuest(c *fiber.Ctx) error {
+	guestCollection := common.GetDBCollection(GUEST_MODEL)
+	if _, err := utils.RequireStaff(c); err != nil {
+		return err
+	}
+	var b UpdateGuestDTO
+	if err := parseBody(c, &b); err != nil {
+		return err
+	}
+	b.Email = normalizeEmail(b.Email)
+	b.Phone = strings.TrimSpace(b.Phone)
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	guest, err := findGuest(c, objectId)
+	if err != nil {
+		return err
+	}
+
+	if err := sealFields(&b); err != nil {
+		return err
+	}
+	update, err := toSetDocument(b)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	update["updatedAt"] = time.Now()
+	result, err := guestCollection.UpdateOne(c.UserContext(), bson.M{"_id": objectId}, bson.M{"$set": update})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, GUEST_MODEL, guest.ID, guest, b)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Guest update was successful", Data: &fiber.Map{"guest": result}})
+}
+
+// LinkGuest attaches a guest record to a registered user account.
+func LinkGuest(c *fiber.Ctx) error {
+	guestCollection := common.GetDBCollection(GUEST_MODEL)
+	if _, err := utils.RequireStaff(c); err != nil {
+		return err
+	}
+	var b LinkGuestDTO
+	if err := parseBody(c, &b); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	guest, err := findGuest(c, objectId)
+	if err != nil {
+		return err
+	}
+	if _, err := findUser(c, b.UserID); err != nil {
+		return err
+	}
+
+	update := bson.M{"userId": b.UserID, "updatedAt": time.Now()}
+	result, err := guestCollection.UpdateOne(c.UserContext(), bson.M{"_id": objectId}, bson.M{"$set": update})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.AuditAction(c, "link-user", GUEST_MODEL, guest.ID, guest, update)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Guest linked to user", Data: &fiber.Map{"guest": result}})
+}
+
+func DeleteGuest(c *fiber.Ctx) error {
+	guestCollection := common.GetDBCollection(GUEST_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	guest, err := findGuest(c, objectId)
+	if err != nil {
+		return err
+	}
+
+	result, err := guestCollection.DeleteOne(c.UserContext(), bson.M{"_id": objectId})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, GUEST_MODEL, guest.ID, guest, nil)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Guest deleted successfully", Data: &fiber.Map{"data": result}})
+}
+
+func findGuest(c *fiber.Ctx, objectId primitive.ObjectID) (models.Guest, error) {
+	var guest models.Guest
+	err := common.GetDBCollection(GUEST_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&guest)
+	if err != nil {
+		return models.Guest{}, responses.FromDB(err, "Guest")
+	}
+	if err := openFields(&guest); err != nil {
+		return models.Guest{}, err
+	}
+	return guest, nil
+}
+
+func findUser(c *fiber.Ctx, id string) (models.User, error) {
+	return loadUser(c.UserContext(), id)
+}
+
+func loadUser(ctx context.Context, id string) (models.User, error) {
+	objectId, err := parseObjectID(id)
+	if err != nil {
+		return models.User{}, err
+	}
+	var user models.User
+	err = common.GetDBCollection(USERS_MODEL).FindOne(ctx, bson.M{"_id": objectId}).Decode(&user)
+	if err != nil {
+		return models.User{}, responses.FromDB(err, "User")
+	}
+	if err := openFields(&user); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// validateBookingGuests checks that every guest exists and that at most one is
+// primary. Staff may list any guest, others only guests they created or that
+// are linked to their account.
+func validateBookingGuests(c *fiber.Ctx, claims utils.JWTClaim, guests []models.BookingGuest) error {
+	if len(guests) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(guests))
+	seen := map[string]bool{}
+	primaries := 0
+	for _, g := range guests {
+		objectId, err := parseObjectID(g.GuestID)
+		if err != nil {
+			return err
+		}
+		if seen[g.GuestID] {
+			return responses.BadRequest("Guest " + g.GuestID + " is listed twice")
+		}
+		seen[g.GuestID] = true
+		if g.IsPrimary {
+			primaries++
+		}
+		ids = append(ids, objectId)
+	}
+	if primaries > 1 {
+		return responses.BadRequest("Only one guest can be the primary guest")
+	}
+	filter := bson.M{"_id": bson.M{"$in": ids}}
+	if !claims.IsStaff() {
+		filter["$or"] = bson.A{bson.M{"createdBy": claims.ID}, bson.M{"userId": claims.ID}}
+	}
+	count, err := common.GetDBCollection(GUEST_MODEL).CountDocuments(c.UserContext(), filter)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	if int(count) != len(ids) {
+		return responses.NotFound("Guest not found")
+	}
 	return nil
 }
+
+func containsRegex(s string) primitive.Regex {
+	return primitive.Regex{Pattern: regexp.QuoteMeta(strings.TrimSpace(s)), Options: "i"}
+}
+
+// toSetDocument turns a partial update DTO into a $set document, the DTO's omitempty
+// bson tags keep fields the client did not send out of the update.
+func toSetDocument(v interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	err = bson.Unmarshal(raw, &doc)
+	return doc, err
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// Healthz is the liveness probe, it only tells the load balancer the process is serving.
+func Healthz(c *fiber.Ctx) error {
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "ok"})
+}
+
+// Readyz is the readiness probe, it checks the dependencies a request may need.
+func Readyz(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), readinessTimeout)
+	defer cancel()
+
+	checks := fiber.Map{"database": "ok", "mail": "ok", "media": "ok"}
+	ready := true
+	if err := common.PingDB(ctx); err != nil {
+		checks["database"] = err.Error()
+		ready = false
+	}
+	if _, err := utils.ActiveMailer(); err != nil {
+		checks["mail"] = err.Error()
+		ready = false
+	}
+	if !common.MediaConfigured() {
+		checks["media"] = "not configured"
+		ready = false
+	}
+
+	if !ready {
+		return c.Status(http.StatusServiceUnavailable).
+			JSON(responses.APIResponse{Status: http.StatusServiceUnavailable, Message: "not ready", Data: &fiber.Map{"checks": checks}})
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "ready", Data: &fiber.Map{"checks": checks}})
+}
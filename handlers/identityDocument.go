@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+const documentDateLayout = "2006-01-02"
+
+type CaptureIdentityDocumentDTO struct {
+	Type        string `json:"type"        form:"type"        validate:"required,oneof=passport national_id drivers_license residence_permit"`
+	Number      string `json:"number"      form:"number"      validate:"required,max=64"`
+	Nationality string `json:"nationality" form:"nationality" validate:"required,iso3166_1_alpha2|iso3166_1_alpha3"`
+	ExpiryDate  string `json:"expiryDate"  form:"expiryDate"  validate:"required,datetime=2006-01-02"`
+	BookingID   string `json:"bookingId"   form:"bookingId"`
+}
+
+// CaptureIdentityDocument records an ID or passport for a guest, typically at check-in.
+// The number is encrypted before it is stored and the optional "image" scan is kept
+// as a private media asset.
+func CaptureIdentityDocument(c *fiber.Ctx) error {
+	guestCollection := common.GetDBCollection(GUEST_MODEL)
+	claims, err := utils.RequireStaff(c)
+	if err != nil {
+		return err
+	}
+	var dto CaptureIdentityDocumentDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	guest, err := findGuest(c, objectId)
+	if err != nil {
+		return err
+	}
+
+	expiry, _ := time.Parse(documentDateLayout, dto.ExpiryDate)
+	if !expiry.After(time.Now()) {
+		return responses.BadRequest("Document has expired")
+	}
+	if dto.BookingID != "" {
+		if _, err := parseObjectID(dto.BookingID); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	document := models.IdentityDocument{
+		ID:          primitive.NewObjectID().Hex(),
+		Type:        dto.Type,
+		Number:      strings.TrimSpace(dto.Number),
+		Nationality: strings.ToUpper(dto.Nationality),
+		ExpiryDate:  expiry,
+		BookingID:   dto.BookingID,
+		CapturedBy:  claims.ID,
+		CapturedAt:  now,
+		PurgeAfter:  now.Add(common.IDDocumentRetention()),
+	}
+
+	formHeader, err := c.FormFile("image")
+	if err == nil && formHeader != nil {
+		formFile, err := formHeader.Open()
+		if err != nil {
+			return responses.Internal(err)
+		}
+		defer formFile.Close()
+		document.ImageURL, document.ImagePublicID, err = utils.PrivateUploadHelper(c.UserContext(), formFile)
+		if err != nil {
+			return responses.Upstream("Failed to upload document image", err)
+		}
+	} else if err != nil && !errors.Is(err, fasthttp.ErrMissingFile) && !errors.Is(err, fasthttp.ErrNoMultipartForm) {
+		return responses.BadRequest("Invalid image file")
+	}
+
+	sealed := document
+	if err := sealFields(&sealed); err != nil {
+		return err
+	}
+	_, err = guestCollection.UpdateOne(
+		c.UserContext(),
+		bson.M{"_id": objectId},
+		bson.M{"$push": bson.M{"documents": sealed}, "$set": bson.M{"updatedAt": now}},
+	)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	// the number never reaches the audit trail
+	utils.AuditAction(c, "capture-document", GUEST_MODEL, guest.ID, nil, bson.M{
+		"documentId": document.ID, "type": document.Type, "nationality": document.Nationality, "bookingId": document.BookingID,
+	})
+
+	document.Number = maskDocumentNumber(document.Number)
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Document captured successfully", Data: &fiber.Map{"document": document}})
+}
+
+// GetIdentityDocuments returns a guest's documents with their full numbers, staff only.
+func GetIdentityDocuments(c *fiber.Ctx) error {
+	if _, err := utils.RequireStaff(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	guest, err := findGuest(c, objectId)
+	if err != nil {
+		return err
+	}
+	documents := guest.Documents
+	if documents == nil {
+		documents = []models.IdentityDocument{}
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Documents fetched successfully", Data: &fiber.Map{"documents": documents}})
+}
+
+func maskDocumentNumber(number string) string {
+	number = strings.TrimSpace(number)
+	if len(number) <= 4 {
+		return strings.Repeat("*", len(number))
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
+
+// hasValidDocument reports whether the guest has an unexpired document on file.
+func hasValidDocument(guest models.Guest, at time.Time) bool {
+	for _, d := range guest.Documents {
+		if d.ExpiryDate.After(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// PurgeExpiredDocuments removes identity documents past their retention period,
+// including their scans. It runs as a background job.
+func PurgeExpiredDocuments(ctx context.Context) error {
+	guestCollection := common.GetDBCollection(GUEST_MODEL)
+	now := time.Now()
+	cursor, err := guestCollection.Find(ctx, bson.M{"documents.purgeAfter": bson.M{"$lte": now}})
+	if err != nil {
+		return err
+	}
+	guests := make([]models.Guest, 0)
+	if err := cursor.All(ctx, &guests); err != nil {
+		return err
+	}
+
+	purged := 0
+	for _, guest := range guests {
+		objectId, err := primitive.ObjectIDFromHex(guest.ID)
+		if err != nil {
+			continue
+		}
+		for _, d := range guest.Documents {
+			if d.PurgeAfter.After(now) {
+				continue
+			}
+			if d.ImagePublicID != "" {
+				if err := utils.DestroyPrivateUpload(ctx, d.ImagePublicID); err != nil {
+					// keep the record so the scan is retried on the next run
+					common.Logger(ctx).Error("failed to delete document image", "guestId", guest.ID, "documentId", d.ID, "error", err)
+					continue
+				}
+			}
+			_, err := guestCollection.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{"$pull": bson.M{"documents": bson.M{"id": d.ID}}})
+			if err != nil {
+				return err
+			}
+			purged++
+		}
+	}
+	if purged > 0 {
+		common.Logger(ctx).Info("purged identity documents", "count", purged)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+// EnsureIndexes creates the indexes the handlers rely on, it is safe to run on every start.
+func EnsureIndexes(ctx context.Context) error {
+	indexes := map[string][]mongo.IndexModel{
+		GUEST_MODEL: {
+			{Keys: bson.D{{Key: "lastName", Value: 1}, {Key: "firstName", Value: 1}}},
+			{Keys: bson.D{{Key: "email", Value: 1}}},
+			{Keys: bson.D{{Key: "phone", Value: 1}}},
+			{Keys: bson.D{{Key: "userId", Value: 1}}},
+			{Keys: bson.D{{Key: "documents.purgeAfter", Value: 1}}},
+		},
+		BOOKING_MODEL: {
+			{Keys: bson.D{{Key: "roomId", Value: 1}, {Key: "checkIn", Value: 1}, {Key: "checkOut", Value: 1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "holdExpiresAt", Value: 1}}},
+			{Keys: bson.D{{Key: "groupId", Value: 1}}, Options: options.Index().SetSparse(true)},
+			{Keys: bson.D{{Key: "guestId", Value: 1}, {Key: "checkIn", Value: -1}}},
+		},
+		BOOKING_GROUP_MODEL: {
+			{Keys: bson.D{{Key: "leaderId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		},
+		RATE_PLAN_MODEL: {
+			{Keys: bson.D{{Key: "roomCategory", Value: 1}, {Key: "active", Value: 1}, {Key: "baseRate", Value: 1}}},
+		},
+		PRICING_RULE_MODEL: {
+			{Keys: bson.D{{Key: "active", Value: 1}, {Key: "roomCategory", Value: 1}, {Key: "ratePlanId", Value: 1}}},
+		},
+		TAX_RULE_MODEL: {
+			{Keys: bson.D{{Key: "active", Value: 1}, {Key: "roomCategories", Value: 1}}},
+		},
+		PAYMENT_MODEL: {
+			{Keys: bson.D{{Key: "bookingId", Value: 1}, {Key: "createdAt", Value: 1}}},
+			{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "providerRef", Value: 1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}}},
+		},
+		PAYMENT_EVENT_MODEL: {
+			{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "eventId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "receivedAt", Value: 1}}},
+		},
+		FOLIO_CHARGE_MODEL: {
+			{Keys: bson.D{{Key: "bookingId", Value: 1}, {Key: "postedAt", Value: 1}}},
+		},
+		INVOICE_MODEL: {
+			{Keys: bson.D{{Key: "number", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "bookingId", Value: 1}, {Key: "issuedAt", Value: 1}}},
+			{Keys: bson.D{{Key: "groupId", Value: 1}, {Key: "issuedAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+		EXCHANGE_RATE_MODEL: {
+			{Keys: bson.D{{Key: "currency", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		PROMOTION_MODEL: {
+			{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		PROMOTION_USES_MODEL: {
+			{Keys: bson.D{{Key: "promotionId", Value: 1}, {Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		REDEMPTION_MODEL: {
+			{Keys: bson.D{{Key: "promotionId", Value: 1}, {Key: "userId", Value: 1}}},
+			{Keys: bson.D{{Key: "promotionId", Value: 1}, {Key: "redeemedAt", Value: -1}}},
+		},
+		utils.IDEMPOTENCY_MODEL: {
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		utils.OUTBOX_MODEL: {
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "lockedUntil", Value: 1}}},
+		},
+		utils.EMAIL_TEMPLATE_MODEL: {
+			{Keys: bson.D{{Key: "name", Value: 1}, {Key: "locale", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		utils.AUDIT_MODEL: {
+			{Keys: bson.D{{Key: "entity", Value: 1}, {Key: "entityId", Value: 1}, {Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		},
+	}
+	for collection, models := range indexes {
+		if _, err := common.GetDBCollection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
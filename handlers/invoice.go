@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var (
+	INVOICE_MODEL = "invoices"
+	COUNTER_MODEL = "counters"
+)
+
+var invoicePrefixes = map[string]string{models.KindInvoice: "INV", models.KindReceipt: "RCT"}
+
+type IssueInvoiceDTO struct {
+	Kind string `json:"kind" validate:"required,oneof=invoice receipt"`
+}
+
+// IssueInvoice issues an invoice or receipt for a booking outside check-out,
+// e.g. a receipt once a balance left at check-out is paid.
+func IssueInvoice(c *fiber.Ctx) error {
+	claims, err := utils.RequireStaff(c)
+	if err != nil {
+		return err
+	}
+	var dto IssueInvoiceDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	invoice, err := issueInvoice(c.UserContext(), booking, dto.Kind, claims.ID)
+	if err != nil {
+		return err
+	}
+	auditInvoice(c, invoice)
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Invoice issued successfully", Data: &fiber.Map{"invoice": invoice}})
+}
+
+// GetBookingInvoices lists the invoices and receipts of a booking.
+func GetBookingInvoices(c *fiber.Ctx) error {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking, err := findBooking(c, objectId)
+	if err != nil {
+		return err
+	}
+	if !claims.IsStaff() && booking.GuestID != claims.ID {
+		return responses.Forbidden("You can only view your own bookings")
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "issuedAt", Value: 1}})
+	cursor, err := common.GetDBCollection(INVOICE_MODEL).Find(c.UserContext(), bson.M{"bookingId": booking.ID}, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	invoices := make([]models.Invoice, 0)
+	if err := cursor.All(c.UserContext(), &invoices); err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Invoices fetched successfully", Data: &fiber.Map{"invoices": invoices}})
+}
+
+// DownloadInvoice sends an invoice or receipt as a PDF.
+func DownloadInvoice(c *fiber.Ctx) error {
+	invoice, err := invoiceForCaller(c)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.pdf"`, invoice.Number))
+	return c.Status(http.StatusOK).Send(renderInvoicePDF(invoice))
+}
+
+// EmailInvoice sends an invoice or receipt to the guest as a PDF attachment.
+func EmailInvoice(c *fiber.Ctx) error {
+	invoice, err := invoiceForCaller(c)
+	if err != nil {
+		return err
+	}
+	user, err := findUser(c, invoice.UserID)
+	if err != nil {
+		return err
+	}
+	data := map[string]string{
+		"FirstName": user.FirstName,
+		"Kind":      invoice.Kind,
+		"Number":    invoice.Number,
+		"Total":     formatAmount(invoice.Folio.Charges, invoice.Folio.Currency),
+		"Balance":   formatAmount(invoice.Folio.Balance, invoice.Folio.Currency),
+	}
+	err = utils.EnqueueEmail(c.UserContext(), utils.Email{
+		To:          []utils.Recipient{utils.UserRecipient(user)},
+		Subject:     fmt.Sprintf("Your %s %s", invoice.Kind, invoice.Number),
+		Template:    "invoice",
+		Locale:      user.Locale,
+		Data:        data,
+		Attachments: []utils.Attachment{{Name: invoice.Number + ".pdf", Content: renderInvoicePDF(invoice)}},
+	})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.AuditAction(c, "email", INVOICE_MODEL, invoice.ID, nil, bson.M{"number": invoice.Number})
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Invoice queued for " + user.Email})
+}
+
+// invoiceForCaller loads the invoice in the path if the caller is its guest or staff.
+func invoiceForCaller(c *fiber.Ctx) (models.Invoice, error) {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	invoice, err := findInvoice(c, objectId)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	if !claims.IsStaff() && invoice.UserID != claims.ID {
+		return models.Invoice{}, responses.Forbidden("You can only view your own invoices")
+	}
+	return invoice, nil
+}
+
+// issueInvoice numbers and stores an invoice or receipt of the booking's folio as it is now.
+func issueInvoice(ctx context.Context, booking GetBookingDTO, kind, issuedBy string) (models.Invoice, error) {
+	folio, err := buildFolio(ctx, booking)
+	if err != nil {
+		return models.Invoice{}, responses.Internal(err)
+	}
+	user, err := loadUser(ctx, booking.GuestID)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	return saveInvoice(ctx, models.Invoice{
+		Kind:      kind,
+		BookingID: booking.ID,
+		UserID:    booking.GuestID,
+		BilledTo:  strings.TrimSpace(user.FirstName + " " + user.LastName),
+		Folio:     folio,
+		IssuedBy:  issuedBy,
+	})
+}
+
+// saveInvoice numbers an invoice and stores it, callers audit it with
+// auditInvoice once it is committed.
+func saveInvoice(ctx context.Context, invoice models.Invoice) (models.Invoice, error) {
+	invoice.IssuedAt = time.Now()
+	number, err := nextDocumentNumber(ctx, invoice.Kind, invoice.IssuedAt)
+	if err != nil {
+		return models.Invoice{}, responses.Internal(err)
+	}
+	invoice.Number = number
+	result, err := common.GetDBCollection(INVOICE_MODEL).InsertOne(ctx, invoice)
+	if err != nil {
+		return models.Invoice{}, responses.FromDB(err, "Invoice")
+	}
+	invoice.ID = hexID(result.InsertedID)
+	return invoice, nil
+}
+
+func auditInvoice(c *fiber.Ctx, invoice models.Invoice) {
+	utils.AuditAction(c, "issue", INVOICE_MODEL, invoice.ID, nil, bson.M{"number": invoice.Number, "bookingId": invoice.BookingID, "groupId": invoice.GroupID})
+}
+
+// nextDocumentNumber takes the next number of a kind's yearly sequence, like
+// INV-2024-00042. Numbers are never reused; one taken in a transaction that
+// aborts was never used.
+func nextDocumentNumber(ctx context.Context, kind string, at time.Time) (string, error) {
+	prefix := invoicePrefixes[kind]
+	key := fmt.Sprintf("%s-%d", prefix, at.Year())
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := common.GetDBCollection(COUNTER_MODEL).FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%05d", key, counter.Seq), nil
+}
+
+func renderInvoicePDF(invoice models.Invoice) []byte {
+	folio := invoice.Folio
+	pdf := utils.NewPDFWriter()
+	right := pdf.ContentWidth()
+	title := "INVOICE"
+	if invoice.Kind == models.KindReceipt {
+		title = "RECEIPT"
+	}
+
+	pdf.Row(20, true, utils.PDFCell{Text: "Hotel Booking System"}, utils.PDFCell{X: right, Text: title, AlignRight: true})
+	pdf.Space(10)
+	pdf.Row(10, false, utils.PDFCell{Text: "Number: " + invoice.Number}, utils.PDFCell{X: right, Text: "Issued: " + invoice.IssuedAt.Format("2 Jan 2006"), AlignRight: true})
+	reference := "Booking: " + invoice.BookingID
+	if invoice.GroupID != "" {
+		reference = "Group: " + invoice.GroupID
+	}
+	pdf.Row(10, false, utils.PDFCell{Text: "Billed to: " + invoice.BilledTo}, utils.PDFCell{X: right, Text: reference, AlignRight: true})
+	pdf.Row(10, false, utils.PDFCell{Text: "Currency: " + folio.Currency})
+	pdf.Space(12)
+
+	pdf.Row(9, true,
+		utils.PDFCell{Text: "Date"},
+		utils.PDFCell{X: 70, Text: "Description"},
+		utils.PDFCell{X: 310, Text: "Qty", AlignRight: true},
+		utils.PDFCell{X: 385, Text: "Amount", AlignRight: true},
+		utils.PDFCell{X: right, Text: "Balance", AlignRight: true},
+	)
+	pdf.Rule()
+	for _, line := range folio.Lines {
+		description := line.Description
+		if runes := []rune(description); len(runes) > 45 {
+			description = string(runes[:42]) + "..."
+		}
+		pdf.Row(9, false,
+			utils.PDFCell{Text: line.Date.Format("02 Jan 06")},
+			utils.PDFCell{X: 70, Text: description},
+			utils.PDFCell{X: 310, Text: fmt.Sprint(line.Quantity), AlignRight: true},
+			utils.PDFCell{X: 385, Text: formatAmount(line.Amount, folio.Currency), AlignRight: true},
+			utils.PDFCell{X: right, Text: formatAmount(line.Balance, folio.Currency), AlignRight: true},
+		)
+	}
+	pdf.Rule()
+
+	total := func(bold bool, label string, amount int64) {
+		pdf.Row(10, bold, utils.PDFCell{X: 250, Text: label}, utils.PDFCell{X: right, Text: formatAmount(amount, folio.Currency), AlignRight: true})
+	}
+	total(false, "Total charges", folio.Charges)
+	for _, tax := range folio.IncludedTaxes {
+		total(false, "  incl. "+tax.Name, tax.Amount)
+	}
+	total(false, "Paid", folio.Paid)
+	total(true, "Balance due", folio.Balance)
+	if invoice.Kind == models.KindReceipt && folio.Balance <= 0 {
+		pdf.Space(16)
+		pdf.Row(10, true, utils.PDFCell{Text: "Paid in full. Thank you for staying with us."})
+	}
+	return pdf.Bytes()
+}
+
+// formatAmount writes minor units as a decimal amount, 123450 USD is "1,234.50".
+func formatAmount(amount int64, currency string) string {
+	exp := models.MinorUnitExponent(currency)
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	digits := fmt.Sprintf("%0*d", exp+1, amount)
+	whole, fraction := digits[:len(digits)-exp], digits[len(digits)-exp:]
+	var grouped strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(d)
+	}
+	if exp == 0 {
+		return sign + grouped.String()
+	}
+	return sign + grouped.String() + "." + fraction
+}
+
+func findInvoice(c *fiber.Ctx, objectId primitive.ObjectID) (models.Invoice, error) {
+	var invoice models.Invoice
+	err := common.GetDBCollection(INVOICE_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&invoice)
+	if err != nil {
+		return models.Invoice{}, responses.FromDB(err, "Invoice")
+	}
+	return invoice, nil
+}
@@ -2,20 +2,19 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/chiboycalix/hotel-booking-system-backend/common"
-	"github.com/chiboycalix/hotel-booking-system-backend/models"
 	"github.com/chiboycalix/hotel-booking-system-backend/responses"
 	"github.com/chiboycalix/hotel-booking-system-backend/utils"
 )
 
 type CreateListingDTO struct {
 	RoomPrice   int64  `json:"roomPrice"   bson:"roomPrice"   validate:"required"`
+	Currency    string `json:"currency"    bson:"currency"    validate:"omitempty,iso4217"`
 	Location    string `json:"location"    bson:"location"    validate:"required"`
 	RoomName    string `json:"roomName"    bson:"roomName"    validate:"required"`
 	RoomBedType string `json:"roomBedType" bson:"roomBedType" validate:"required"`
@@ -24,6 +23,7 @@ type CreateListingDTO struct {
 type GetListingDTO struct {
 	ID          string `json:"id"          bson:"_id"`
 	RoomPrice   int64  `json:"roomPrice"   bson:"roomPrice"   validate:"required"`
+	Currency    string `json:"currency"    bson:"currency"`
 	Location    string `json:"location"    bson:"location"    validate:"required"`
 	RoomName    string `json:"roomName"    bson:"roomName"    validate:"required"`
 	RoomBedType string `json:"roomBedType" bson:"roomBedType" validate:"required"`
@@ -31,6 +31,7 @@ type GetListingDTO struct {
 }
 type UpdateListingDTO struct {
 	RoomPrice   int64  `json:"roomPrice"   bson:"roomPrice"`
+	Currency    string `json:"currency"    bson:"currency"    validate:"omitempty,iso4217"`
 	Location    string `json:"location"    bson:"location"`
 	RoomName    string `json:"roomName"    bson:"roomName"`
 	RoomBedType string `json:"roomBedType" bson:"roomBedType"`
@@ -42,65 +43,42 @@ var LISTING_MODEL = "listings"
 func CreateListing(c *fiber.Ctx) error {
 	listingCollection := common.GetDBCollection(LISTING_MODEL)
 	var createListing CreateListingDTO
-	if err := c.BodyParser(&createListing); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": "Please provide request body"}})
+	if err := parseBody(c, &createListing); err != nil {
+		return err
 	}
 
-	if validationErr := validate.Struct(&createListing); validationErr != nil {
-		for _, err := range validationErr.(validator.ValidationErrors) {
-			return c.Status(http.StatusBadRequest).
-				JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": err.Field() + " is required"}})
-		}
-	}
-
-	formHeader, err := c.FormFile("roomImage")
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-	}
-
-	formFile, err := formHeader.Open()
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-	}
-
-	uploadUrl, err := utils.NewMediaUpload().FileUpload(models.File{File: formFile})
+	uploadUrl, err := uploadFormImage(c, "roomImage")
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return err
 	}
 
 	createListing.RoomImage = uploadUrl
-	result, err := listingCollection.InsertOne(c.Context(), createListing)
+	// prices are in the property's base currency unless stated
+	createListing.Currency = strings.ToUpper(createListing.Currency)
+	if createListing.Currency == "" {
+		createListing.Currency = common.BaseCurrency()
+	}
+	result, err := listingCollection.InsertOne(c.UserContext(), createListing)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.FromDB(err, "Listing")
 	}
+	utils.Audit(c, LISTING_MODEL, hexID(result.InsertedID), nil, createListing)
 	return c.Status(http.StatusCreated).
 		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Listing created successfully", Data: &fiber.Map{"listing": result}})
 }
 
 func GetListing(c *fiber.Ctx) error {
 	listingCollection := common.GetDBCollection(LISTING_MODEL)
-	id := c.Params("id")
-	if id == "" {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Id is required"}})
-	}
-	objectId, err := primitive.ObjectIDFromHex(id)
+	objectId, err := paramObjectID(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
 	listing := GetListingDTO{}
 
-	err = listingCollection.FindOne(c.Context(), bson.M{"_id": objectId}).Decode(&listing)
+	err = listingCollection.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&listing)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.FromDB(err, "Listing")
 	}
 
 	return c.Status(http.StatusOK).
@@ -110,19 +88,17 @@ func GetListing(c *fiber.Ctx) error {
 func GetAllListings(c *fiber.Ctx) error {
 	listingCollection := common.GetDBCollection(LISTING_MODEL)
 	listings := make([]GetListingDTO, 0)
-	cursor, err := listingCollection.Find(c.Context(), bson.M{})
+	cursor, err := listingCollection.Find(c.UserContext(), bson.M{})
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
 
 	// iterate over the cursor
-	for cursor.Next(c.Context()) {
+	for cursor.Next(c.UserContext()) {
 		listing := GetListingDTO{}
 		err := cursor.Decode(&listing)
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).
-				JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+			return responses.Internal(err)
 		}
 		listings = append(listings, listing)
 	}
@@ -133,38 +109,23 @@ func GetAllListings(c *fiber.Ctx) error {
 
 func UpdateListing(c *fiber.Ctx) error {
 	listingCollection := common.GetDBCollection(LISTING_MODEL)
-	var b UpdateListingDTO
-	if err := c.BodyParser(&b); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid body"}})
-	}
-	var tokenString = c.Get("Authorization")
-	isAdmin, err := utils.IsAdmin(tokenString, common.EnvJWTSecret(), c)
-	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
 	}
-	if !isAdmin {
-		return c.Status(http.StatusUnauthorized).
-			JSON(responses.APIResponse{Status: http.StatusUnauthorized, Message: "Unauthorized", Data: &fiber.Map{"error": "Unauthorized"}})
-	}
-	id := c.Params("id")
-	if id == "" {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Id is required"}})
+	var b UpdateListingDTO
+	if err := parseBody(c, &b); err != nil {
+		return err
 	}
-	objectId, err := primitive.ObjectIDFromHex(id)
+	objectId, err := paramObjectID(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
 	listing := GetListingDTO{}
 
-	err = listingCollection.FindOne(c.Context(), bson.M{"_id": objectId}).Decode(&listing)
+	err = listingCollection.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&listing)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.FromDB(err, "Listing")
 	}
 	if b.Location == "" {
 		b.Location = listing.Location
@@ -178,75 +139,63 @@ func UpdateListing(c *fiber.Ctx) error {
 	if b.RoomPrice == 0 {
 		b.RoomPrice = listing.RoomPrice
 	}
+	b.Currency = strings.ToUpper(b.Currency)
+	if b.Currency == "" {
+		b.Currency = listing.Currency
+	}
 
 	if b.RoomImage != "" {
-		var url models.Url
-		url.Url = b.RoomImage
-		uploadUrl, err := utils.NewMediaUpload().RemoteUpload(url)
+		uploadUrl, err := uploadRemoteImage(c, b.RoomImage)
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).
-				JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+			return err
 		}
 		b.RoomImage = uploadUrl
 	} else {
-		formHeader, err := c.FormFile("roomImage")
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-		}
-		formFile, err := formHeader.Open()
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-		}
 		// if image
-		uploadUrl, err := utils.NewMediaUpload().FileUpload(models.File{File: formFile})
+		uploadUrl, err := uploadFormImage(c, "roomImage")
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+			return err
 		}
 		b.RoomImage = uploadUrl
 	}
 
 	result, err := listingCollection.UpdateOne(
-		c.Context(),
+		c.UserContext(),
 		bson.M{"_id": objectId},
 		bson.M{"$set": b},
 	)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Failed to update listing", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
+	utils.Audit(c, LISTING_MODEL, listing.ID, listing, b)
 
 	return c.Status(http.StatusOK).
 		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Listing update was successful", Data: &fiber.Map{"listing": result}})
 }
 
 func DeleteListing(c *fiber.Ctx) error {
-	id := c.Params("id")
 	listingCollection := common.GetDBCollection(LISTING_MODEL)
-	var tokenString = c.Get("Authorization")
-	isAdmin, err := utils.IsAdmin(tokenString, common.EnvJWTSecret(), c)
-	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-	}
-	if !isAdmin {
-		return c.Status(http.StatusUnauthorized).
-			JSON(responses.APIResponse{Status: http.StatusUnauthorized, Message: "Unauthorized", Data: &fiber.Map{"error": "Unauthorized"}})
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
 	}
-	if id == "" {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Id is required"}})
-	}
-	objectId, err := primitive.ObjectIDFromHex(id)
+	objectId, err := paramObjectID(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
-	result, err := listingCollection.DeleteOne(c.Context(), bson.M{"_id": objectId})
+	listing := GetListingDTO{}
+	if err := listingCollection.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&listing); err != nil {
+		return responses.FromDB(err, "Listing")
+	}
+
+	result, err := listingCollection.DeleteOne(c.UserContext(), bson.M{"_id": objectId})
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Fail to delete listing"}})
+		return responses.Internal(err)
+	}
+	if result.DeletedCount == 0 {
+		return responses.NotFound("Listing not found")
 	}
+	utils.Audit(c, LISTING_MODEL, listing.ID, listing, nil)
 	return c.Status(http.StatusOK).
 		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Listing deleted successfully", Data: &fiber.Map{"data": result}})
 }
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+type OutboxQueryDTO struct {
+	Status string `query:"status" validate:"omitempty,oneof=pending processing sent dead"`
+	Kind   string `query:"kind"`
+	Limit  int64  `query:"limit"  validate:"omitempty,min=1,max=500"`
+	Page   int64  `query:"page"   validate:"omitempty,min=1"`
+}
+
+// GetOutboxMessages lets admins look at queued notifications, by default the
+// dead ones that ran out of attempts, most recently updated first.
+func GetOutboxMessages(c *fiber.Ctx) error {
+	outboxCollection := common.GetDBCollection(utils.OUTBOX_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var q OutboxQueryDTO
+	if err := c.QueryParser(&q); err != nil {
+		return responses.BadRequest("Invalid query parameters")
+	}
+	if err := validateStruct(&q); err != nil {
+		return err
+	}
+	if q.Status == "" {
+		q.Status = utils.OutboxDead
+	}
+	if q.Limit == 0 {
+		q.Limit = 50
+	}
+	if q.Page == 0 {
+		q.Page = 1
+	}
+
+	filter := bson.M{"status": q.Status}
+	if q.Kind != "" {
+		filter["kind"] = q.Kind
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}}).
+		SetSkip((q.Page - 1) * q.Limit).
+		SetLimit(q.Limit)
+	cursor, err := outboxCollection.Find(c.UserContext(), filter, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	messages := make([]utils.OutboxMessage, 0)
+	if err := cursor.All(c.UserContext(), &messages); err != nil {
+		return responses.Internal(err)
+	}
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Outbox messages fetched successfully", Data: &fiber.Map{"messages": messages, "page": q.Page, "limit": q.Limit}})
+}
+
+// RetryOutboxMessage puts a dead message back in the queue with a fresh set of attempts.
+func RetryOutboxMessage(c *fiber.Ctx) error {
+	outboxCollection := common.GetDBCollection(utils.OUTBOX_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var message utils.OutboxMessage
+	err = outboxCollection.FindOneAndUpdate(c.UserContext(),
+		bson.M{"_id": objectId, "status": utils.OutboxDead},
+		bson.M{"$set": bson.M{"status": utils.OutboxPending, "attempts": 0, "nextAttemptAt": now, "updatedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&message)
+	if err != nil {
+		return responses.FromDB(err, "Dead outbox message")
+	}
+	utils.AuditAction(c, "retry", utils.OUTBOX_MODEL, message.ID, nil, bson.M{"status": utils.OutboxPending})
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Outbox message queued again", Data: &fiber.Map{"message": message}})
+}
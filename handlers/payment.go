@@ -0,0 +1,565 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var PAYMENT_MODEL = "payments"
+
+type CreatePaymentDTO struct {
+	Kind         string `json:"kind"         validate:"required,oneof=deposit full"`
+	CaptureLater bool   `json:"captureLater"`
+}
+
+type CapturePaymentDTO struct {
+	Amount int64 `json:"amount" validate:"omitempty,gt=0"`
+}
+
+type RefundPaymentDTO struct {
+	Amount int64  `json:"amount" validate:"omitempty,gt=0"`
+	Reason string `json:"reason" validate:"max=200"`
+}
+
+// CreateBookingPayment starts paying for a booking through the active gateway,
+// either a deposit of PAYMENT_DEPOSIT_PERCENT of the total or all that is still
+// owed. The booking is confirmed once the gateway reports the payment succeeded
+// or the funds are held for capture; the client completes the payment with the
+// returned client secret or checkout URL and then calls POST /payments/:id/confirm.
+func CreateBookingPayment(c *fiber.Ctx) error {
+	paymentCollection := common.GetDBCollection(PAYMENT_MODEL)
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	var dto CreatePaymentDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking := GetBookingDTO{}
+	if err := common.GetDBCollection(BOOKING_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&booking); err != nil {
+		return responses.FromDB(err, "Booking")
+	}
+	if !claims.IsStaff() && booking.GuestID != claims.ID {
+		return responses.Forbidden("You can only pay for your own bookings")
+	}
+	switch booking.Status {
+	case models.BookingExpired:
+		return responses.Conflict("Booking hold has expired, please book again")
+	case models.BookingCancelled:
+		return responses.Conflict("Booking is cancelled")
+	}
+	total := booking.Quote.Total
+	if total <= 0 {
+		return responses.BadRequest("Booking has no price to pay")
+	}
+
+	payments, err := bookingPayments(c.UserContext(), booking.ID)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	var paid int64
+	for _, p := range payments {
+		paid += p.Balance()
+	}
+	amount := total - paid
+	if amount <= 0 {
+		return responses.Conflict("Booking is already paid")
+	}
+	if dto.Kind == models.PaymentDeposit {
+		deposit := models.FromMajor(models.ToMajor(total, booking.Quote.Currency)*common.DepositPercent()/100, booking.Quote.Currency)
+		if paid >= deposit {
+			return responses.Conflict("Deposit is already paid")
+		}
+		if deposit-paid < amount {
+			amount = deposit - paid
+		}
+	}
+	// an unfinished attempt for the same amount is resumed rather than duplicated
+	for _, p := range payments {
+		if p.Status == models.PaymentPending && p.Kind == dto.Kind && p.Amount.Amount == amount {
+			return c.Status(http.StatusOK).
+				JSON(responses.APIResponse{Status: http.StatusOK, Message: "Payment already started", Data: &fiber.Map{"payment": p}})
+		}
+	}
+
+	provider, err := utils.ActivePaymentProvider()
+	if err != nil {
+		return responses.Internal(err)
+	}
+	user, err := findUser(c, booking.GuestID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	payment := models.Payment{
+		BookingID: booking.ID,
+		UserID:    booking.GuestID,
+		Provider:  provider.Name(),
+		Kind:      dto.Kind,
+		Status:    models.PaymentPending,
+		Amount:    models.Money{Amount: amount, Currency: booking.Quote.Currency},
+		Refunds:   []models.Refund{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	result, err := paymentCollection.InsertOne(c.UserContext(), payment)
+	if err != nil {
+		return responses.FromDB(err, "Payment")
+	}
+	payment.ID = hexID(result.InsertedID)
+
+	intent, err := provider.CreateIntent(c.UserContext(), utils.PaymentIntentRequest{
+		Reference:    payment.ID,
+		Amount:       amount,
+		Currency:     payment.Amount.Currency,
+		Email:        user.Email,
+		Description:  "Booking " + booking.ID,
+		CaptureLater: dto.CaptureLater,
+	})
+	if err != nil {
+		if _, updateErr := paymentCollection.UpdateOne(c.UserContext(), bson.M{"_id": result.InsertedID}, bson.M{"$set": bson.M{
+			"status": models.PaymentFailed, "failure": err.Error(), "updatedAt": time.Now(),
+		}}); updateErr != nil {
+			common.Logger(c.UserContext()).Error("failed to record payment failure", "paymentId", payment.ID, "error", updateErr)
+		}
+		if errors.Is(err, utils.ErrCaptureUnsupported) {
+			return responses.BadRequest("The payment provider cannot hold funds for a later capture")
+		}
+		return responses.Upstream("Failed to start payment", err)
+	}
+	if payment, err = applyIntent(c.UserContext(), payment, intent); err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, PAYMENT_MODEL, payment.ID, nil, payment)
+
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Payment started successfully", Data: &fiber.Map{"payment": payment}})
+}
+
+// ConfirmPayment asks the gateway for the outcome of a payment, the client calls
+// it after the guest completed the payment.
+func ConfirmPayment(c *fiber.Ctx) error {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	payment, err := findPayment(c, objectId)
+	if err != nil {
+		return err
+	}
+	if !claims.IsStaff() && payment.UserID != claims.ID {
+		return responses.Forbidden("You can only confirm your own payments")
+	}
+	provider, err := utils.PaymentProviderByName(payment.Provider)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	intent, err := provider.GetIntent(c.UserContext(), payment.ProviderRef)
+	if err != nil {
+		return responses.Upstream("Failed to check payment", err)
+	}
+	if payment, err = applyIntent(c.UserContext(), payment, intent); err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Payment is " + payment.Status, Data: &fiber.Map{"payment": payment}})
+}
+
+// CapturePayment takes held funds, all of them unless an amount is given.
+func CapturePayment(c *fiber.Ctx) error {
+	if _, err := utils.RequireStaff(c); err != nil {
+		return err
+	}
+	var dto CapturePaymentDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	payment, err := findPayment(c, objectId)
+	if err != nil {
+		return err
+	}
+	if payment.Status != models.PaymentAuthorized {
+		return responses.Conflict("Only authorized payments can be captured")
+	}
+	if dto.Amount > payment.Amount.Amount {
+		return responses.BadRequest("Cannot capture more than was authorized")
+	}
+	provider, err := utils.PaymentProviderByName(payment.Provider)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	intent, err := provider.Capture(c.UserContext(), payment.ProviderRef, dto.Amount)
+	if errors.Is(err, utils.ErrCaptureUnsupported) {
+		return responses.BadRequest("The payment provider does not support captures")
+	}
+	if err != nil {
+		return responses.Upstream("Failed to capture payment", err)
+	}
+	before := payment
+	if payment, err = applyIntent(c.UserContext(), payment, intent); err != nil {
+		return responses.Internal(err)
+	}
+	utils.AuditAction(c, "capture", PAYMENT_MODEL, payment.ID, before, payment)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Payment captured successfully", Data: &fiber.Map{"payment": payment}})
+}
+
+// RefundPayment gives back part or, without an amount, all of what is left of a
+// captured payment.
+func RefundPayment(c *fiber.Ctx) error {
+	claims, err := utils.RequireStaff(c)
+	if err != nil {
+		return err
+	}
+	var dto RefundPaymentDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	payment, err := findPayment(c, objectId)
+	if err != nil {
+		return err
+	}
+	refundable := payment.Captured - payment.Refunded
+	if refundable <= 0 {
+		return responses.Conflict("Nothing left to refund on this payment")
+	}
+	amount := dto.Amount
+	if amount == 0 {
+		amount = refundable
+	}
+	if amount > refundable {
+		return responses.BadRequest("Cannot refund more than is left on the payment")
+	}
+	before := payment
+	payment, refund, err := refundPayment(c.UserContext(), payment, amount, dto.Reason, claims.ID)
+	if err != nil {
+		return err
+	}
+	utils.AuditAction(c, "refund", PAYMENT_MODEL, payment.ID, before, payment)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Refund " + refund.Status, Data: &fiber.Map{"payment": payment}})
+}
+
+// refundPayment refunds amount of a payment through its gateway and records the
+// refund, it returns the payment as it is now.
+func refundPayment(ctx context.Context, payment models.Payment, amount int64, reason, createdBy string) (models.Payment, models.Refund, error) {
+	paymentCollection := common.GetDBCollection(PAYMENT_MODEL)
+	objectId, err := primitive.ObjectIDFromHex(payment.ID)
+	if err != nil {
+		return models.Payment{}, models.Refund{}, responses.Internal(err)
+	}
+	provider, err := utils.PaymentProviderByName(payment.Provider)
+	if err != nil {
+		return models.Payment{}, models.Refund{}, responses.Internal(err)
+	}
+	// the same refund retried after a timeout gets the same key, so the gateway
+	// does not pay it back twice
+	key := fmt.Sprintf("refund-%s-%d-%d", payment.ProviderRef, amount, len(payment.Refunds))
+	refunded, err := provider.Refund(ctx, payment.ProviderRef, amount, key)
+	if err != nil {
+		return models.Payment{}, models.Refund{}, responses.Upstream("Failed to refund payment", err)
+	}
+
+	refund := models.Refund{
+		ProviderRef: refunded.Ref,
+		Amount:      amount,
+		Status:      refunded.Status,
+		Reason:      reason,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}
+	update := bson.M{
+		"$push": bson.M{"refunds": refund},
+		"$set":  bson.M{"updatedAt": refund.CreatedAt},
+	}
+	if refundCounts(refund.Status) {
+		update["$inc"] = bson.M{"refunded": amount}
+	}
+	// the gateway's webhook may have reported the refund already
+	filter := bson.M{"_id": objectId, "refunds.providerRef": bson.M{"$ne": refund.ProviderRef}}
+	if _, err := paymentCollection.UpdateOne(ctx, filter, update); err != nil {
+		return models.Payment{}, models.Refund{}, responses.Internal(err)
+	}
+	payment, err = settleRefundStatus(ctx, objectId)
+	if err != nil {
+		return models.Payment{}, models.Refund{}, responses.FromDB(err, "Payment")
+	}
+	return payment, refund, nil
+}
+
+// refundCounts reports whether a refund in status adds to the refunded total.
+func refundCounts(status string) bool {
+	return status != "failed"
+}
+
+// settleRefundStatus sets a payment's status from the refunded total it has now.
+// Refunds change the total with $inc so concurrent ones add up, and the status
+// is only written while the total is still the one it was worked out from.
+func settleRefundStatus(ctx context.Context, objectId primitive.ObjectID) (models.Payment, error) {
+	paymentCollection := common.GetDBCollection(PAYMENT_MODEL)
+	var payment models.Payment
+	if err := paymentCollection.FindOne(ctx, bson.M{"_id": objectId}).Decode(&payment); err != nil {
+		return models.Payment{}, err
+	}
+	status := payment.Status
+	switch {
+	case payment.Refunded > 0:
+		status = refundedStatus(payment)
+	case settled(payment.Status):
+		status = models.PaymentSucceeded
+	}
+	if status == payment.Status {
+		return payment, nil
+	}
+	_, err := paymentCollection.UpdateOne(ctx,
+		bson.M{"_id": objectId, "refunded": payment.Refunded},
+		bson.M{"$set": bson.M{"status": status}},
+	)
+	payment.Status = status
+	return payment, err
+}
+
+// GetBookingPayments lists the payments of a booking, for its guest or staff.
+func GetBookingPayments(c *fiber.Ctx) error {
+	claims, err := utils.ClaimsFromRequest(c)
+	if err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	booking := GetBookingDTO{}
+	if err := common.GetDBCollection(BOOKING_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&booking); err != nil {
+		return responses.FromDB(err, "Booking")
+	}
+	if !claims.IsStaff() && booking.GuestID != claims.ID {
+		return responses.Forbidden("You can only view your own bookings")
+	}
+	payments, err := bookingPayments(c.UserContext(), booking.ID)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Payments fetched successfully", Data: &fiber.Map{"payments": payments}})
+}
+
+// GetPayments lists payments for staff, newest first, by status or provider.
+func GetPayments(c *fiber.Ctx) error {
+	paymentCollection := common.GetDBCollection(PAYMENT_MODEL)
+	if _, err := utils.RequireStaff(c); err != nil {
+		return err
+	}
+	filter := bson.M{}
+	for _, field := range []string{"status", "provider", "bookingId"} {
+		if value := c.Query(field); value != "" {
+			filter[field] = value
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(200)
+	cursor, err := paymentCollection.Find(c.UserContext(), filter, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	payments := make([]models.Payment, 0)
+	if err := cursor.All(c.UserContext(), &payments); err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Payments fetched successfully", Data: &fiber.Map{"payments": payments}})
+}
+
+// applyIntent records the gateway's view of a payment and confirms the booking
+// once the payment succeeded or its funds are held. The status only ever moves
+// up in rank, checked in the update so a caller holding a stale payment can't
+// overwrite a newer status; it then gets the payment as stored.
+func applyIntent(ctx context.Context, payment models.Payment, intent utils.PaymentIntent) (models.Payment, error) {
+	objectId, err := primitive.ObjectIDFromHex(payment.ID)
+	if err != nil {
+		return payment, err
+	}
+	set := bson.M{
+		"status":    intent.Status,
+		"captured":  intent.Captured,
+		"failure":   intent.Failure,
+		"updatedAt": time.Now(),
+	}
+	if intent.Ref != "" {
+		set["providerRef"] = intent.Ref
+	}
+	if intent.ClientSecret != "" {
+		set["clientSecret"] = intent.ClientSecret
+	}
+	if intent.CheckoutURL != "" {
+		set["checkoutUrl"] = intent.CheckoutURL
+	}
+	filter := bson.M{"_id": objectId, "status": bson.M{"$in": statusesUpTo(intent.Status)}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = common.GetDBCollection(PAYMENT_MODEL).FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&payment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// a late or stale answer, the payment has moved past it
+		err = common.GetDBCollection(PAYMENT_MODEL).FindOne(ctx, bson.M{"_id": objectId}).Decode(&payment)
+		return payment, err
+	}
+	if err != nil {
+		return payment, err
+	}
+	if payment.Status == models.PaymentAuthorized || payment.Status == models.PaymentSucceeded {
+		return payment, confirmBooking(ctx, payment.BookingID)
+	}
+	return payment, nil
+}
+
+// confirmBooking moves a held or unpaid booking to confirmed. A hold that ran out
+// before the payment came through is confirmed only if its room is still free,
+// otherwise the booking stays expired for staff to refund.
+func confirmBooking(ctx context.Context, bookingID string) error {
+	bookingCollection := common.GetDBCollection(BOOKING_MODEL)
+	objectId, err := primitive.ObjectIDFromHex(bookingID)
+	if err != nil {
+		return err
+	}
+	var booking GetBookingDTO
+	filter := bson.M{"_id": objectId, "status": bson.M{"$in": bson.A{models.BookingHeld, models.BookingExpired, models.BookingPendingPayment}}}
+	if err := bookingCollection.FindOne(ctx, filter).Decode(&booking); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	confirm := func(ctx context.Context) (*mongo.UpdateResult, error) {
+		return bookingCollection.UpdateOne(ctx,
+			bson.M{"_id": objectId, "status": booking.Status},
+			bson.M{"$set": bson.M{"status": models.BookingConfirmed, "confirmedAt": now, "bookingUpdatedDate": now}},
+		)
+	}
+	var result *mongo.UpdateResult
+	if booking.Status == models.BookingPendingPayment || (booking.HoldExpiresAt != nil && booking.HoldExpiresAt.After(now)) {
+		result, err = confirm(ctx)
+	} else {
+		err = common.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := claimRoom(ctx, booking.RoomID, booking.CheckIn, booking.CheckOut, booking.ID); err != nil {
+				return err
+			}
+			result, err = confirm(ctx)
+			return err
+		})
+		var appErr *responses.AppError
+		if errors.As(err, &appErr) {
+			common.Logger(ctx).Error("paid booking lost its room after the hold expired", "bookingId", bookingID)
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		common.Logger(ctx).Info("booking confirmed", "bookingId", bookingID)
+		booking.Status = models.BookingConfirmed
+		return notifyBooking(ctx, mailBookingConfirmed, "Your booking is confirmed", booking, nil)
+	}
+	return nil
+}
+
+func settled(status string) bool {
+	switch status {
+	case models.PaymentSucceeded, models.PaymentPartiallyRefunded, models.PaymentRefunded:
+		return true
+	}
+	return false
+}
+
+// paymentRank orders payment statuses by how far a payment has come, gateway
+// events only ever move it to an equal or higher rank. A failed attempt can be
+// retried, so it ranks below an authorization; a voided authorization is
+// cancelled and ranks above it.
+func paymentRank(status string) int {
+	switch status {
+	case models.PaymentPending:
+		return 0
+	case models.PaymentFailed:
+		return 1
+	case models.PaymentAuthorized:
+		return 2
+	case models.PaymentCancelled:
+		return 3
+	case models.PaymentSucceeded, models.PaymentPartiallyRefunded, models.PaymentRefunded:
+		return 4
+	}
+	return -1
+}
+
+// statusesUpTo lists the statuses an intent in status may replace: those of
+// equal or lower rank. Refunded payments are left to the refunds, an intent
+// reporting success again must not undo them.
+func statusesUpTo(status string) bson.A {
+	statuses := bson.A{}
+	for _, s := range []string{models.PaymentPending, models.PaymentFailed, models.PaymentAuthorized, models.PaymentCancelled, models.PaymentSucceeded} {
+		if paymentRank(s) <= paymentRank(status) {
+			statuses = append(statuses, s)
+		}
+	}
+	return statuses
+}
+
+func refundedStatus(payment models.Payment) string {
+	if payment.Refunded >= payment.Captured {
+		return models.PaymentRefunded
+	}
+	return models.PaymentPartiallyRefunded
+}
+
+func bookingPayments(ctx context.Context, bookingID string) ([]models.Payment, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := common.GetDBCollection(PAYMENT_MODEL).Find(ctx, bson.M{"bookingId": bookingID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	payments := make([]models.Payment, 0)
+	err = cursor.All(ctx, &payments)
+	return payments, err
+}
+
+func findPayment(c *fiber.Ctx, objectId primitive.ObjectID) (models.Payment, error) {
+	var payment models.Payment
+	err := common.GetDBCollection(PAYMENT_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&payment)
+	if err != nil {
+		return models.Payment{}, responses.FromDB(err, "Payment")
+	}
+	return payment, nil
+}
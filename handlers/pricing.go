@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+)
+
+// maxStayNights bounds a single quote, longer stays are arranged with the hotel.
+const maxStayNights = 90
+
+// stayNights returns the day of each night between checkIn and checkOut, days are UTC dates.
+func stayNights(checkIn, checkOut time.Time) ([]time.Time, error) {
+	first := dateOf(checkIn)
+	last := dateOf(checkOut)
+	if !last.After(first) {
+		return nil, responses.BadRequest("checkOut must be at least one day after checkIn")
+	}
+	nights := make([]time.Time, 0)
+	for day := first; day.Before(last); day = day.AddDate(0, 0, 1) {
+		nights = append(nights, day)
+		if len(nights) > maxStayNights {
+			return nil, responses.BadRequest("Stays are limited to 90 nights")
+		}
+	}
+	return nights, nil
+}
+
+func dateOf(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+type QuoteDTO struct {
+	CheckIn    string `query:"checkIn"    validate:"required"`
+	CheckOut   string `query:"checkOut"   validate:"required"`
+	Guests     int    `query:"guests"     validate:"omitempty,min=1,max=20"`
+	RatePlanID string `query:"ratePlanId"`
+	Currency   string `query:"currency"   validate:"omitempty,iso4217"`
+	PromoCode  string `query:"promoCode"`
+}
+
+// stay is what a quote prices.
+type stay struct {
+	Room      models.Room
+	Plan      models.RatePlan
+	CheckIn   time.Time
+	CheckOut  time.Time
+	Guests    int
+	Currency  string            // the plan's currency when empty
+	Promotion *models.Promotion // optional
+}
+
+// GetRoomQuote prices a stay in a room without booking it, checkIn and checkOut
+// are dates (2006-01-02) or RFC 3339 times. Amounts are in currency when given,
+// otherwise in the rate plan's currency.
+func GetRoomQuote(c *fiber.Ctx) error {
+	var q QuoteDTO
+	if err := c.QueryParser(&q); err != nil {
+		return responses.BadRequest("Invalid query parameters")
+	}
+	if err := validateStruct(&q); err != nil {
+		return err
+	}
+	checkIn, err := parseDate(q.CheckIn, "checkIn")
+	if err != nil {
+		return err
+	}
+	checkOut, err := parseDate(q.CheckOut, "checkOut")
+	if err != nil {
+		return err
+	}
+	room, err := findRoom(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	plan, err := ratePlanForRoom(c, room, q.RatePlanID)
+	if err != nil {
+		return err
+	}
+	var promotion *models.Promotion
+	if q.PromoCode != "" {
+		// per user limits are only checked when booking
+		if promotion, err = findPromotionByCode(c, q.PromoCode); err != nil {
+			return err
+		}
+	}
+	quote, err := quoteStay(c, stay{
+		Room: room, Plan: plan, CheckIn: checkIn, CheckOut: checkOut,
+		Guests: q.Guests, Currency: q.Currency, Promotion: promotion,
+	})
+	if err != nil {
+		return err
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Quote computed successfully", Data: &fiber.Map{"quote": quote, "ratePlan": plan}})
+}
+
+func parseDate(value, field string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, responses.BadRequest(field + " must be a date like 2006-01-02")
+}
+
+// quoteStay prices a stay under its plan and the pricing rules that apply to it,
+// then adds its taxes and fees.
+func quoteStay(c *fiber.Ctx, s stay) (models.PriceQuote, error) {
+	rules, err := pricingRulesFor(c.UserContext(), s.Plan)
+	if err != nil {
+		return models.PriceQuote{}, responses.Internal(err)
+	}
+	quote, err := priceStay(s, rules)
+	if err != nil {
+		return models.PriceQuote{}, err
+	}
+	if s.Promotion != nil {
+		if quote, err = applyPromotion(c.UserContext(), quote, s); err != nil {
+			return models.PriceQuote{}, err
+		}
+	}
+	if quote, err = applyTaxes(c.UserContext(), quote, s); err != nil {
+		return models.PriceQuote{}, err
+	}
+	return localizeQuote(c.UserContext(), quote, s.Currency)
+}
+
+// priceStay is the pricing engine. Each night starts at the plan's base rate,
+// is scaled by the highest priority season and every matching day-of-week rule,
+// and gets the occupancy surcharges added. The best length-of-stay discount is
+// then taken off the whole stay. Rules must already be filtered to the plan.
+func priceStay(s stay, rules []models.PricingRule) (models.PriceQuote, error) {
+	plan, guests := s.Plan, s.Guests
+	nights, err := stayNights(s.CheckIn, s.CheckOut)
+	if err != nil {
+		return models.PriceQuote{}, err
+	}
+	if guests < 1 {
+		guests = 1
+	}
+	for _, r := range rules {
+		if r.Type == models.RuleMinStay && ruleCovers(r, nights[0]) && len(nights) < r.MinNights {
+			return models.PriceQuote{}, responses.BadRequest(fmt.Sprintf("%s requires a stay of at least %d nights", r.Name, r.MinNights))
+		}
+	}
+
+	quote := models.PriceQuote{
+		RatePlanID:  plan.ID,
+		Currency:    plan.Currency,
+		Board:       plan.Board,
+		Refundable:  plan.Refundable,
+		Guests:      guests,
+		Nights:      make([]models.NightlyRate, 0, len(nights)),
+		Adjustments: make([]models.PriceAdjustment, 0),
+		Taxes:       make([]models.TaxLine, 0),
+		QuotedAt:    time.Now(),
+	}
+	for _, night := range nights {
+		rate := models.NightlyRate{Date: night, BaseAmount: plan.BaseRate, Amount: plan.BaseRate, Rules: make([]string, 0)}
+		// rules are sorted by priority, so the first matching season wins
+		for _, r := range rules {
+			if r.Type == models.RuleSeason && ruleCovers(r, night) {
+				rate.Amount = scaleAmount(rate.Amount, r.Multiplier)
+				rate.Rules = append(rate.Rules, r.Name)
+				break
+			}
+		}
+		for _, r := range rules {
+			switch {
+			case r.Type == models.RuleDayOfWeek && ruleCovers(r, night) && containsDay(r.DaysOfWeek, night.Weekday()):
+				rate.Amount = scaleAmount(rate.Amount, r.Multiplier)
+				rate.Rules = append(rate.Rules, r.Name)
+			case r.Type == models.RuleOccupancy && ruleCovers(r, night) && guests > r.BaseGuests:
+				rate.Amount += int64(guests-r.BaseGuests) * r.ExtraGuestAmount
+				rate.Rules = append(rate.Rules, r.Name)
+			}
+		}
+		quote.Nights = append(quote.Nights, rate)
+		quote.Subtotal += rate.Amount
+	}
+
+	var discount *models.PricingRule
+	for i, r := range rules {
+		if r.Type != models.RuleLengthOfStay || !ruleCovers(r, nights[0]) || len(nights) < r.MinNights {
+			continue
+		}
+		if discount == nil || r.DiscountPercent > discount.DiscountPercent {
+			discount = &rules[i]
+		}
+	}
+	if discount != nil {
+		quote.Adjustments = append(quote.Adjustments, models.PriceAdjustment{
+			RuleID: discount.ID,
+			Name:   discount.Name,
+			Amount: -int64(math.Round(float64(quote.Subtotal) * discount.DiscountPercent / 100)),
+		})
+	}
+
+	quote.Total = quote.Subtotal
+	for _, a := range quote.Adjustments {
+		quote.Total += a.Amount
+	}
+	return quote, nil
+}
+
+// pricingRulesFor loads the active rules for plan, highest priority first.
+func pricingRulesFor(ctx context.Context, plan models.RatePlan) ([]models.PricingRule, error) {
+	filter := bson.M{
+		"active":       true,
+		"roomCategory": bson.M{"$in": bson.A{"", plan.RoomCategory}},
+		"ratePlanId":   bson.M{"$in": bson.A{"", plan.ID}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "createdAt", Value: -1}})
+	cursor, err := common.GetDBCollection(PRICING_RULE_MODEL).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]models.PricingRule, 0)
+	err = cursor.All(ctx, &rules)
+	return rules, err
+}
+
+// ruleCovers reports whether day falls within the rule's optional date range.
+func ruleCovers(r models.PricingRule, day time.Time) bool {
+	if r.StartDate != nil && day.Before(dateOf(*r.StartDate)) {
+		return false
+	}
+	if r.EndDate != nil && day.After(dateOf(*r.EndDate)) {
+		return false
+	}
+	return true
+}
+
+func containsDay(days []int, day time.Weekday) bool {
+	for _, d := range days {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+func scaleAmount(amount int64, multiplier float64) int64 {
+	return int64(math.Round(float64(amount) * multiplier))
+}
+
+// ratePlanForRoom returns the plan a booking of room is priced with: the requested
+// one, which must be active and for the room's category, or else the cheapest
+// active plan of the category.
+func ratePlanForRoom(c *fiber.Ctx, room models.Room, ratePlanID string) (models.RatePlan, error) {
+	if ratePlanID != "" {
+		objectId, err := parseObjectID(ratePlanID)
+		if err != nil {
+			return models.RatePlan{}, err
+		}
+		plan, err := findRatePlan(c, objectId)
+		if err != nil {
+			return models.RatePlan{}, err
+		}
+		if !plan.Active || plan.RoomCategory != room.RoomCategory {
+			return models.RatePlan{}, responses.BadRequest("Rate plan is not available for this room")
+		}
+		return plan, nil
+	}
+
+	var plan models.RatePlan
+	opts := options.FindOne().SetSort(bson.D{{Key: "baseRate", Value: 1}})
+	err := common.GetDBCollection(RATE_PLAN_MODEL).
+		FindOne(c.UserContext(), bson.M{"roomCategory": room.RoomCategory, "active": true}, opts).
+		Decode(&plan)
+	if err != nil {
+		appErr := responses.FromDB(err, "Rate plan")
+		if appErr.Code == responses.CodeNotFound {
+			return models.RatePlan{}, responses.Conflict("Room has no rate plan, it cannot be booked yet")
+		}
+		return models.RatePlan{}, appErr
+	}
+	return plan, nil
+}
+
+func findRoom(c *fiber.Ctx, id string) (models.Room, error) {
+	return loadRoom(c.UserContext(), id)
+}
+
+func loadRoom(ctx context.Context, id string) (models.Room, error) {
+	objectId, err := parseObjectID(id)
+	if err != nil {
+		return models.Room{}, err
+	}
+	var room models.Room
+	if err := common.GetDBCollection(ROOM_MODEL).FindOne(ctx, bson.M{"_id": objectId}).Decode(&room); err != nil {
+		return models.Room{}, responses.FromDB(err, "Room")
+	}
+	return room, nil
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var PRICING_RULE_MODEL = "pricing_rules"
+
+// PricingRuleDTO creates a rule and, on PUT, replaces it.
+type PricingRuleDTO struct {
+	Name             string     `json:"name"             validate:"required"`
+	Type             string     `json:"type"             validate:"required,oneof=season day_of_week min_stay length_of_stay occupancy"`
+	RoomCategory     string     `json:"roomCategory"`
+	RatePlanID       string     `json:"ratePlanId"`
+	StartDate        *time.Time `json:"startDate"`
+	EndDate          *time.Time `json:"endDate"`
+	DaysOfWeek       []int      `json:"daysOfWeek"       validate:"omitempty,dive,min=0,max=6"`
+	Multiplier       float64    `json:"multiplier"       validate:"omitempty,gt=0,max=10"`
+	MinNights        int        `json:"minNights"        validate:"omitempty,min=1"`
+	DiscountPercent  float64    `json:"discountPercent"  validate:"omitempty,gt=0,max=100"`
+	BaseGuests       int        `json:"baseGuests"       validate:"omitempty,min=1"`
+	ExtraGuestAmount int64      `json:"extraGuestAmount" validate:"omitempty,gt=0"`
+	Priority         int        `json:"priority"`
+	Active           *bool      `json:"active"`
+}
+
+func CreatePricingRule(c *fiber.Ctx) error {
+	ruleCollection := common.GetDBCollection(PRICING_RULE_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var dto PricingRuleDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	rule, err := pricingRuleFromDTO(c, dto)
+	if err != nil {
+		return err
+	}
+	rule.CreatedAt = rule.UpdatedAt
+
+	result, err := ruleCollection.InsertOne(c.UserContext(), rule)
+	if err != nil {
+		return responses.FromDB(err, "Pricing rule")
+	}
+	rule.ID = hexID(result.InsertedID)
+	utils.Audit(c, PRICING_RULE_MODEL, rule.ID, nil, rule)
+
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Pricing rule created successfully", Data: &fiber.Map{"pricingRule": rule}})
+}
+
+func GetPricingRules(c *fiber.Ctx) error {
+	ruleCollection := common.GetDBCollection(PRICING_RULE_MODEL)
+	if _, err := utils.RequireStaff(c); err != nil {
+		return err
+	}
+	filter := bson.M{}
+	if t := c.Query("type"); t != "" {
+		filter["type"] = t
+	}
+	if category := c.Query("roomCategory"); category != "" {
+		filter["roomCategory"] = category
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "type", Value: 1}, {Key: "priority", Value: -1}})
+	cursor, err := ruleCollection.Find(c.UserContext(), filter, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	rules := make([]models.PricingRule, 0)
+	if err := cursor.All(c.UserContext(), &rules); err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Pricing rules fetched successfully", Data: &fiber.Map{"pricingRules": rules}})
+}
+
+func UpdatePricingRule(c *fiber.Ctx) error {
+	ruleCollection := common.GetDBCollection(PRICING_RULE_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var dto PricingRuleDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	existing, err := findPricingRule(c, objectId)
+	if err != nil {
+		return err
+	}
+	rule, err := pricingRuleFromDTO(c, dto)
+	if err != nil {
+		return err
+	}
+	rule.CreatedAt = existing.CreatedAt
+
+	result, err := ruleCollection.ReplaceOne(c.UserContext(), bson.M{"_id": objectId}, rule)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, PRICING_RULE_MODEL, existing.ID, existing, rule)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Pricing rule update was successful", Data: &fiber.Map{"pricingRule": result}})
+}
+
+func DeletePricingRule(c *fiber.Ctx) error {
+	ruleCollection := common.GetDBCollection(PRICING_RULE_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	rule, err := findPricingRule(c, objectId)
+	if err != nil {
+		return err
+	}
+
+	result, err := ruleCollection.DeleteOne(c.UserContext(), bson.M{"_id": objectId})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, PRICING_RULE_MODEL, rule.ID, rule, nil)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Pricing rule deleted successfully", Data: &fiber.Map{"data": result}})
+}
+
+// pricingRuleFromDTO checks that the fields the rule's type needs are set.
+func pricingRuleFromDTO(c *fiber.Ctx, dto PricingRuleDTO) (models.PricingRule, error) {
+	switch dto.Type {
+	case models.RuleSeason:
+		if dto.StartDate == nil || dto.EndDate == nil || dto.Multiplier == 0 {
+			return models.PricingRule{}, responses.BadRequest("Seasons need startDate, endDate and multiplier")
+		}
+	case models.RuleDayOfWeek:
+		if len(dto.DaysOfWeek) == 0 || dto.Multiplier == 0 {
+			return models.PricingRule{}, responses.BadRequest("Day of week rules need daysOfWeek and multiplier")
+		}
+	case models.RuleMinStay:
+		if dto.MinNights == 0 {
+			return models.PricingRule{}, responses.BadRequest("Minimum stay rules need minNights")
+		}
+	case models.RuleLengthOfStay:
+		if dto.MinNights == 0 || dto.DiscountPercent == 0 {
+			return models.PricingRule{}, responses.BadRequest("Length of stay rules need minNights and discountPercent")
+		}
+	case models.RuleOccupancy:
+		if dto.BaseGuests == 0 || dto.ExtraGuestAmount == 0 {
+			return models.PricingRule{}, responses.BadRequest("Occupancy rules need baseGuests and extraGuestAmount")
+		}
+	}
+	if dto.StartDate != nil && dto.EndDate != nil && dto.EndDate.Before(*dto.StartDate) {
+		return models.PricingRule{}, responses.BadRequest("endDate must not be before startDate")
+	}
+	if dto.RatePlanID != "" {
+		objectId, err := parseObjectID(dto.RatePlanID)
+		if err != nil {
+			return models.PricingRule{}, err
+		}
+		if _, err := findRatePlan(c, objectId); err != nil {
+			return models.PricingRule{}, err
+		}
+	}
+
+	return models.PricingRule{
+		Name:             dto.Name,
+		Type:             dto.Type,
+		RoomCategory:     dto.RoomCategory,
+		RatePlanID:       dto.RatePlanID,
+		StartDate:        dto.StartDate,
+		EndDate:          dto.EndDate,
+		DaysOfWeek:       dto.DaysOfWeek,
+		Multiplier:       dto.Multiplier,
+		MinNights:        dto.MinNights,
+		DiscountPercent:  dto.DiscountPercent,
+		BaseGuests:       dto.BaseGuests,
+		ExtraGuestAmount: dto.ExtraGuestAmount,
+		Priority:         dto.Priority,
+		Active:           dto.Active == nil || *dto.Active,
+		UpdatedAt:        time.Now(),
+	}, nil
+}
+
+func findPricingRule(c *fiber.Ctx, objectId primitive.ObjectID) (models.PricingRule, error) {
+	var rule models.PricingRule
+	err := common.GetDBCollection(PRICING_RULE_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&rule)
+	if err != nil {
+		return models.PricingRule{}, responses.FromDB(err, "Pricing rule")
+	}
+	return rule, nil
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+)
+
+// day is a date in June 2025, June 1st was a Sunday.
+func day(d int) time.Time {
+	return time.Date(2025, time.June, d, 0, 0, 0, 0, time.UTC)
+}
+
+func dayPtr(d int) *time.Time {
+	t := day(d)
+	return &t
+}
+
+func TestPriceStay(t *testing.T) {
+	summer := models.PricingRule{Name: "summer", Type: models.RuleSeason, Multiplier: 1.5, StartDate: dayPtr(3), EndDate: dayPtr(4)}
+	peak := models.PricingRule{Name: "peak", Type: models.RuleSeason, Multiplier: 2, StartDate: dayPtr(4), EndDate: dayPtr(4)}
+	weekend := models.PricingRule{Name: "weekend", Type: models.RuleDayOfWeek, Multiplier: 1.2, DaysOfWeek: []int{5, 6}}
+	extraGuests := models.PricingRule{Name: "extra guests", Type: models.RuleOccupancy, BaseGuests: 2, ExtraGuestAmount: 2500}
+	week := models.PricingRule{ID: "week", Name: "week", Type: models.RuleLengthOfStay, MinNights: 7, DiscountPercent: 10}
+	long := models.PricingRule{ID: "long", Name: "long", Type: models.RuleLengthOfStay, MinNights: 3, DiscountPercent: 5}
+	minStay := models.PricingRule{Name: "festival", Type: models.RuleMinStay, MinNights: 3, StartDate: dayPtr(5), EndDate: dayPtr(8)}
+
+	tests := []struct {
+		name         string
+		checkIn      time.Time
+		checkOut     time.Time
+		guests       int
+		rules        []models.PricingRule
+		wantNights   []int64
+		wantSubtotal int64
+		wantTotal    int64
+		wantErr      string
+	}{
+		{
+			name:    "base rate only",
+			checkIn: day(2), checkOut: day(4), guests: 2,
+			wantNights: []int64{10000, 10000}, wantSubtotal: 20000, wantTotal: 20000,
+		},
+		{
+			name:    "season covers some nights",
+			checkIn: day(2), checkOut: day(5), guests: 2,
+			rules:      []models.PricingRule{summer},
+			wantNights: []int64{10000, 15000, 15000}, wantSubtotal: 40000, wantTotal: 40000,
+		},
+		{
+			name:    "highest priority season wins",
+			checkIn: day(3), checkOut: day(5), guests: 2,
+			rules:      []models.PricingRule{peak, summer},
+			wantNights: []int64{15000, 20000}, wantSubtotal: 35000, wantTotal: 35000,
+		},
+		{
+			name:    "day of week",
+			checkIn: day(5), checkOut: day(8), guests: 2,
+			rules:      []models.PricingRule{weekend},
+			wantNights: []int64{10000, 12000, 12000}, wantSubtotal: 34000, wantTotal: 34000,
+		},
+		{
+			name:    "day of week on top of season",
+			checkIn: day(6), checkOut: day(8), guests: 2,
+			rules:      []models.PricingRule{{Name: "june", Type: models.RuleSeason, Multiplier: 1.5}, weekend},
+			wantNights: []int64{18000, 18000}, wantSubtotal: 36000, wantTotal: 36000,
+		},
+		{
+			name:    "occupancy above base guests",
+			checkIn: day(2), checkOut: day(4), guests: 4,
+			rules:      []models.PricingRule{extraGuests},
+			wantNights: []int64{15000, 15000}, wantSubtotal: 30000, wantTotal: 30000,
+		},
+		{
+			name:    "occupancy at base guests",
+			checkIn: day(2), checkOut: day(3), guests: 2,
+			rules:      []models.PricingRule{extraGuests},
+			wantNights: []int64{10000}, wantSubtotal: 10000, wantTotal: 10000,
+		},
+		{
+			name:    "no guests counts as one",
+			checkIn: day(2), checkOut: day(3), guests: 0,
+			rules:      []models.PricingRule{{Name: "single", Type: models.RuleOccupancy, BaseGuests: 0, ExtraGuestAmount: 1000}},
+			wantNights: []int64{11000}, wantSubtotal: 11000, wantTotal: 11000,
+		},
+		{
+			name:    "occupancy added after season",
+			checkIn: day(3), checkOut: day(4), guests: 3,
+			rules:      []models.PricingRule{summer, extraGuests},
+			wantNights: []int64{17500}, wantSubtotal: 17500, wantTotal: 17500,
+		},
+		{
+			name:    "best length of stay discount",
+			checkIn: day(9), checkOut: day(16), guests: 2,
+			rules:        []models.PricingRule{long, week},
+			wantNights:   []int64{10000, 10000, 10000, 10000, 10000, 10000, 10000},
+			wantSubtotal: 70000, wantTotal: 63000,
+		},
+		{
+			name:    "length of stay below the longer minimum",
+			checkIn: day(9), checkOut: day(15), guests: 2,
+			rules:        []models.PricingRule{long, week},
+			wantNights:   []int64{10000, 10000, 10000, 10000, 10000, 10000},
+			wantSubtotal: 60000, wantTotal: 57000,
+		},
+		{
+			name:    "length of stay discount on adjusted nights",
+			checkIn: day(2), checkOut: day(5), guests: 3,
+			rules:      []models.PricingRule{summer, extraGuests, long},
+			wantNights: []int64{12500, 17500, 17500}, wantSubtotal: 47500, wantTotal: 45125,
+		},
+		{
+			name:    "too short for a length of stay discount",
+			checkIn: day(2), checkOut: day(4), guests: 2,
+			rules:      []models.PricingRule{long},
+			wantNights: []int64{10000, 10000}, wantSubtotal: 20000, wantTotal: 20000,
+		},
+		{
+			name:    "min stay met",
+			checkIn: day(6), checkOut: day(9), guests: 2,
+			rules:      []models.PricingRule{minStay},
+			wantNights: []int64{10000, 10000, 10000}, wantSubtotal: 30000, wantTotal: 30000,
+		},
+		{
+			name:    "min stay not met",
+			checkIn: day(6), checkOut: day(8), guests: 2,
+			rules:   []models.PricingRule{minStay},
+			wantErr: "festival requires a stay of at least 3 nights",
+		},
+		{
+			name:    "min stay only for check-ins in its range",
+			checkIn: day(4), checkOut: day(6), guests: 2,
+			rules:      []models.PricingRule{minStay},
+			wantNights: []int64{10000, 10000}, wantSubtotal: 20000, wantTotal: 20000,
+		},
+		{
+			name:    "times on the same dates as the nights",
+			checkIn: day(2).Add(15 * time.Hour), checkOut: day(3).Add(11 * time.Hour), guests: 2,
+			wantNights: []int64{10000}, wantSubtotal: 10000, wantTotal: 10000,
+		},
+		{
+			name:    "check out on check in day",
+			checkIn: day(2), checkOut: day(2).Add(20 * time.Hour), guests: 2,
+			wantErr: "checkOut must be at least one day after checkIn",
+		},
+		{
+			name:    "check out before check in",
+			checkIn: day(5), checkOut: day(2), guests: 2,
+			wantErr: "checkOut must be at least one day after checkIn",
+		},
+		{
+			name:    "90 nights",
+			checkIn: day(1), checkOut: day(1).AddDate(0, 0, 90), guests: 2,
+			wantSubtotal: 900000, wantTotal: 900000,
+		},
+		{
+			name:    "91 nights",
+			checkIn: day(1), checkOut: day(1).AddDate(0, 0, 91), guests: 2,
+			wantErr: "Stays are limited to 90 nights",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := stay{
+				Plan:    models.RatePlan{ID: "plan", BaseRate: 10000, Currency: "USD"},
+				CheckIn: tt.checkIn, CheckOut: tt.checkOut, Guests: tt.guests,
+			}
+			quote, err := priceStay(s, tt.rules)
+			if tt.wantErr != "" {
+				var appErr *responses.AppError
+				if !errors.As(err, &appErr) || appErr.Code != responses.CodeBadRequest || appErr.Message != tt.wantErr {
+					t.Fatalf("priceStay error = %v, want bad request %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("priceStay: %v", err)
+			}
+			if tt.wantNights != nil {
+				nights := make([]int64, 0, len(quote.Nights))
+				for _, n := range quote.Nights {
+					nights = append(nights, n.Amount)
+				}
+				if !reflect.DeepEqual(nights, tt.wantNights) {
+					t.Errorf("nights = %v, want %v", nights, tt.wantNights)
+				}
+			}
+			if quote.Subtotal != tt.wantSubtotal || quote.Total != tt.wantTotal {
+				t.Errorf("subtotal, total = %d, %d, want %d, %d", quote.Subtotal, quote.Total, tt.wantSubtotal, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestPriceStayRecordsRules(t *testing.T) {
+	rules := []models.PricingRule{
+		{Name: "summer", Type: models.RuleSeason, Multiplier: 1.5},
+		{Name: "weekend", Type: models.RuleDayOfWeek, Multiplier: 1.2, DaysOfWeek: []int{6}},
+		{ID: "week", Name: "week", Type: models.RuleLengthOfStay, MinNights: 1, DiscountPercent: 10},
+	}
+	s := stay{Plan: models.RatePlan{BaseRate: 10000}, CheckIn: day(6), CheckOut: day(8), Guests: 2}
+	quote, err := priceStay(s, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRules := [][]string{{"summer"}, {"summer", "weekend"}}
+	for i, night := range quote.Nights {
+		if !reflect.DeepEqual(night.Rules, wantRules[i]) {
+			t.Errorf("night %d rules = %v, want %v", i, night.Rules, wantRules[i])
+		}
+	}
+	want := []models.PriceAdjustment{{RuleID: "week", Name: "week", Amount: -3300}}
+	if !reflect.DeepEqual(quote.Adjustments, want) {
+		t.Errorf("adjustments = %+v, want %+v", quote.Adjustments, want)
+	}
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var (
+	PROMOTION_MODEL      = "promotions"
+	REDEMPTION_MODEL     = "promotion_redemptions"
+	PROMOTION_USES_MODEL = "promotion_user_uses"
+)
+
+// PromotionDTO creates a promotion and, on PUT, replaces it.
+type PromotionDTO struct {
+	Code           string     `json:"code"           validate:"required,alphanum,min=3,max=32"`
+	Name           string     `json:"name"           validate:"required"`
+	DiscountType   string     `json:"discountType"   validate:"required,oneof=percent fixed"`
+	Percent        float64    `json:"percent"        validate:"omitempty,gt=0,max=100"`
+	Amount         int64      `json:"amount"         validate:"omitempty,gt=0"`
+	Currency       string     `json:"currency"       validate:"omitempty,iso4217"`
+	StartsAt       *time.Time `json:"startsAt"`
+	EndsAt         *time.Time `json:"endsAt"`
+	MaxUses        int        `json:"maxUses"        validate:"omitempty,min=1"`
+	MaxUsesPerUser int        `json:"maxUsesPerUser" validate:"omitempty,min=1"`
+	RoomCategories []string   `json:"roomCategories"`
+	MinNights      int        `json:"minNights"      validate:"omitempty,min=1"`
+	Active         *bool      `json:"active"`
+}
+
+type PromotionUsageDTO struct {
+	Currency string `json:"currency" bson:"_id"`
+	Uses     int    `json:"uses"     bson:"uses"`
+	Discount int64  `json:"discount" bson:"discount"`
+}
+
+func CreatePromotion(c *fiber.Ctx) error {
+	promotionCollection := common.GetDBCollection(PROMOTION_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var dto PromotionDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	promotion, err := promotionFromDTO(dto)
+	if err != nil {
+		return err
+	}
+	promotion.CreatedAt = promotion.UpdatedAt
+
+	result, err := promotionCollection.InsertOne(c.UserContext(), promotion)
+	if err != nil {
+		return responses.FromDB(err, "Promotion")
+	}
+	promotion.ID = hexID(result.InsertedID)
+	utils.Audit(c, PROMOTION_MODEL, promotion.ID, nil, promotion)
+
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Promotion created successfully", Data: &fiber.Map{"promotion": promotion}})
+}
+
+func GetPromotions(c *fiber.Ctx) error {
+	promotionCollection := common.GetDBCollection(PROMOTION_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	filter := bson.M{}
+	if active := c.Query("active"); active != "" {
+		filter["active"] = active == "true"
+	}
+	cursor, err := promotionCollection.Find(c.UserContext(), filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return responses.Internal(err)
+	}
+	promotions := make([]models.Promotion, 0)
+	if err := cursor.All(c.UserContext(), &promotions); err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Promotions fetched successfully", Data: &fiber.Map{"promotions": promotions}})
+}
+
+func GetPromotion(c *fiber.Ctx) error {
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	promotion, err := findPromotion(c, objectId)
+	if err != nil {
+		return err
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Promotion fetched successfully", Data: &fiber.Map{"promotion": promotion}})
+}
+
+// UpdatePromotion replaces a promotion's terms, its usage count is kept.
+func UpdatePromotion(c *fiber.Ctx) error {
+	promotionCollection := common.GetDBCollection(PROMOTION_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var dto PromotionDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	existing, err := findPromotion(c, objectId)
+	if err != nil {
+		return err
+	}
+	promotion, err := promotionFromDTO(dto)
+	if err != nil {
+		return err
+	}
+	promotion.UsedCount = existing.UsedCount
+	promotion.CreatedAt = existing.CreatedAt
+
+	result, err := promotionCollection.ReplaceOne(c.UserContext(), bson.M{"_id": objectId}, promotion)
+	if err != nil {
+		return responses.FromDB(err, "Promotion")
+	}
+	utils.Audit(c, PROMOTION_MODEL, existing.ID, existing, promotion)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Promotion update was successful", Data: &fiber.Map{"promotion": result}})
+}
+
+// DeletePromotion removes a promotion, its redemptions stay for reporting.
+func DeletePromotion(c *fiber.Ctx) error {
+	promotionCollection := common.GetDBCollection(PROMOTION_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	promotion, err := findPromotion(c, objectId)
+	if err != nil {
+		return err
+	}
+
+	result, err := promotionCollection.DeleteOne(c.UserContext(), bson.M{"_id": objectId})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, PROMOTION_MODEL, promotion.ID, promotion, nil)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Promotion deleted successfully", Data: &fiber.Map{"data": result}})
+}
+
+// GetPromotionUsage reports how often a promotion was redeemed, by whom and for
+// how much, with discount totals per charged currency.
+func GetPromotionUsage(c *fiber.Ctx) error {
+	redemptionCollection := common.GetDBCollection(REDEMPTION_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	id := c.Params("id")
+	if _, err := parseObjectID(id); err != nil {
+		return err
+	}
+
+	cursor, err := redemptionCollection.Aggregate(c.UserContext(), bson.A{
+		bson.M{"$match": bson.M{"promotionId": id}},
+		bson.M{"$group": bson.M{"_id": "$discount.currency", "uses": bson.M{"$sum": 1}, "discount": bson.M{"$sum": "$discount.amount"}}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	totals := make([]PromotionUsageDTO, 0)
+	if err := cursor.All(c.UserContext(), &totals); err != nil {
+		return responses.Internal(err)
+	}
+	users, err := redemptionCollection.Distinct(c.UserContext(), "userId", bson.M{"promotionId": id})
+	if err != nil {
+		return responses.Internal(err)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "redeemedAt", Value: -1}}).SetLimit(100)
+	cursor, err = redemptionCollection.Find(c.UserContext(), bson.M{"promotionId": id}, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	redemptions := make([]models.Redemption, 0)
+	if err := cursor.All(c.UserContext(), &redemptions); err != nil {
+		return responses.Internal(err)
+	}
+
+	uses := 0
+	for _, t := range totals {
+		uses += t.Uses
+	}
+	return c.Status(http.StatusOK).JSON(responses.APIResponse{
+		Status:  http.StatusOK,
+		Message: "Promotion usage fetched successfully",
+		Data: &fiber.Map{
+			"uses":        uses,
+			"uniqueUsers": len(users),
+			"totals":      totals,
+			"redemptions": redemptions,
+		},
+	})
+}
+
+func promotionFromDTO(dto PromotionDTO) (models.Promotion, error) {
+	switch dto.DiscountType {
+	case models.DiscountPercent:
+		if dto.Percent == 0 {
+			return models.Promotion{}, responses.BadRequest("Percentage promotions need percent")
+		}
+	case models.DiscountFixed:
+		if dto.Amount == 0 || dto.Currency == "" {
+			return models.Promotion{}, responses.BadRequest("Fixed promotions need amount and currency")
+		}
+	}
+	if dto.StartsAt != nil && dto.EndsAt != nil && !dto.EndsAt.After(*dto.StartsAt) {
+		return models.Promotion{}, responses.BadRequest("endsAt must be after startsAt")
+	}
+	return models.Promotion{
+		Code:           strings.ToUpper(dto.Code),
+		Name:           dto.Name,
+		DiscountType:   dto.DiscountType,
+		Percent:        dto.Percent,
+		Amount:         dto.Amount,
+		Currency:       strings.ToUpper(dto.Currency),
+		StartsAt:       dto.StartsAt,
+		EndsAt:         dto.EndsAt,
+		MaxUses:        dto.MaxUses,
+		MaxUsesPerUser: dto.MaxUsesPerUser,
+		RoomCategories: dto.RoomCategories,
+		MinNights:      dto.MinNights,
+		Active:         dto.Active == nil || *dto.Active,
+		UpdatedAt:      time.Now(),
+	}, nil
+}
+
+func findPromotion(c *fiber.Ctx, objectId primitive.ObjectID) (models.Promotion, error) {
+	var promotion models.Promotion
+	err := common.GetDBCollection(PROMOTION_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&promotion)
+	if err != nil {
+		return models.Promotion{}, responses.FromDB(err, "Promotion")
+	}
+	return promotion, nil
+}
+
+// findPromotionByCode returns the promotion for a code a guest entered if it can
+// be used right now.
+func findPromotionByCode(c *fiber.Ctx, code string) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := common.GetDBCollection(PROMOTION_MODEL).
+		FindOne(c.UserContext(), bson.M{"code": strings.ToUpper(strings.TrimSpace(code))}).
+		Decode(&promotion)
+	if err != nil {
+		appErr := responses.FromDB(err, "Promotion")
+		if appErr.Code == responses.CodeNotFound {
+			return nil, responses.BadRequest("Promo code is not valid")
+		}
+		return nil, appErr
+	}
+	now := time.Now()
+	switch {
+	case !promotion.Active:
+		return nil, responses.BadRequest("Promo code is not valid")
+	case promotion.StartsAt != nil && now.Before(*promotion.StartsAt):
+		return nil, responses.BadRequest("Promo code is not active yet")
+	case promotion.EndsAt != nil && now.After(*promotion.EndsAt):
+		return nil, responses.BadRequest("Promo code has expired")
+	case promotion.MaxUses > 0 && promotion.UsedCount >= promotion.MaxUses:
+		return nil, responses.Conflict("Promo code has been fully redeemed")
+	}
+	return &promotion, nil
+}
+
+// applyPromotion takes the promotion off a quote still in its rate plan's currency.
+// The discount never exceeds the total.
+func applyPromotion(ctx context.Context, quote models.PriceQuote, s stay) (models.PriceQuote, error) {
+	promotion := s.Promotion
+	if len(promotion.RoomCategories) > 0 && !containsString(promotion.RoomCategories, s.Room.RoomCategory) {
+		return models.PriceQuote{}, responses.BadRequest("Promo code does not apply to this room")
+	}
+	if len(quote.Nights) < promotion.MinNights {
+		return models.PriceQuote{}, responses.BadRequest(fmt.Sprintf("Promo code needs a stay of at least %d nights", promotion.MinNights))
+	}
+
+	var discount int64
+	switch promotion.DiscountType {
+	case models.DiscountPercent:
+		discount = models.FromMajor(models.ToMajor(quote.Total, quote.Currency)*promotion.Percent/100, quote.Currency)
+	case models.DiscountFixed:
+		rates, err := loadExchangeRates(ctx)
+		if err != nil {
+			return models.PriceQuote{}, responses.Internal(err)
+		}
+		if discount, err = rates.convert(promotion.Amount, promotion.Currency, quote.Currency); err != nil {
+			return models.PriceQuote{}, err
+		}
+	}
+	if discount > quote.Total {
+		discount = quote.Total
+	}
+	quote.Adjustments = append(quote.Adjustments, models.PriceAdjustment{
+		RuleID: promotion.ID,
+		Name:   "Promo " + promotion.Code,
+		Amount: -discount,
+	})
+	quote.Total -= discount
+	return quote, nil
+}
+
+// redeemPromotion takes one use of a promotion for the redemption's user and
+// records it. Both caps are enforced atomically so concurrent bookings cannot
+// exceed them; called in the booking's transaction, it is undone with it.
+func redeemPromotion(ctx context.Context, promotion *models.Promotion, redemption models.Redemption) error {
+	objectId, err := parseObjectID(promotion.ID)
+	if err != nil {
+		return err
+	}
+	if promotion.MaxUsesPerUser > 0 {
+		if err := takeUserPromotionUse(ctx, promotion, redemption.UserID); err != nil {
+			return err
+		}
+	}
+
+	filter := bson.M{"_id": objectId}
+	if promotion.MaxUses > 0 {
+		filter["usedCount"] = bson.M{"$lt": promotion.MaxUses}
+	}
+	result, err := common.GetDBCollection(PROMOTION_MODEL).UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"usedCount": 1}})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	if result.MatchedCount == 0 {
+		return responses.Conflict("Promo code has been fully redeemed")
+	}
+	if _, err := common.GetDBCollection(REDEMPTION_MODEL).InsertOne(ctx, redemption); err != nil {
+		return responses.Internal(err)
+	}
+	return nil
+}
+
+// takeUserPromotionUse counts one more use of promotion by userID unless the
+// user has reached its cap. A user's counter starts from the redemptions made
+// before counters were kept.
+func takeUserPromotionUse(ctx context.Context, promotion *models.Promotion, userID string) error {
+	usesCollection := common.GetDBCollection(PROMOTION_USES_MODEL)
+	key := bson.M{"promotionId": promotion.ID, "userId": userID}
+	err := usesCollection.FindOne(ctx, key).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		used, err := common.GetDBCollection(REDEMPTION_MODEL).CountDocuments(ctx, key)
+		if err != nil {
+			return responses.Internal(err)
+		}
+		_, err = usesCollection.UpdateOne(ctx, key,
+			bson.M{"$setOnInsert": bson.M{"count": used}}, options.Update().SetUpsert(true))
+		if err != nil {
+			return responses.Internal(err)
+		}
+	} else if err != nil {
+		return responses.Internal(err)
+	}
+
+	filter := bson.M{"promotionId": promotion.ID, "userId": userID, "count": bson.M{"$lt": promotion.MaxUsesPerUser}}
+	result, err := usesCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"count": 1}})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	if result.MatchedCount == 0 {
+		return responses.Conflict("You have already used this promo code")
+	}
+	return nil
+}
+
+// releasePromotion gives back the use a cancelled booking took.
+func releasePromotion(ctx context.Context, applied *models.AppliedPromotion, bookingID string) error {
+	objectId, err := primitive.ObjectIDFromHex(applied.PromotionID)
+	if err != nil {
+		return err
+	}
+	_, err = common.GetDBCollection(PROMOTION_MODEL).UpdateOne(ctx,
+		bson.M{"_id": objectId, "usedCount": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"usedCount": -1}})
+	if err != nil {
+		return err
+	}
+	var redemption models.Redemption
+	err = common.GetDBCollection(REDEMPTION_MODEL).
+		FindOneAndDelete(ctx, bson.M{"promotionId": applied.PromotionID, "bookingId": bookingID}).
+		Decode(&redemption)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = common.GetDBCollection(PROMOTION_USES_MODEL).UpdateOne(ctx,
+		bson.M{"promotionId": applied.PromotionID, "userId": redemption.UserID, "count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"count": -1}})
+	return err
+}
+
+// appliedPromotion reads the discount a promotion gave off a localized quote.
+func appliedPromotion(promotion *models.Promotion, quote models.PriceQuote) *models.AppliedPromotion {
+	applied := &models.AppliedPromotion{PromotionID: promotion.ID, Code: promotion.Code, Discount: models.Money{Currency: quote.Currency}}
+	for _, a := range quote.Adjustments {
+		if a.RuleID == promotion.ID {
+			applied.Discount.Amount = -a.Amount
+		}
+	}
+	return applied
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var RATE_PLAN_MODEL = "rate_plans"
+
+type CreateRatePlanDTO struct {
+	RoomCategory string `json:"roomCategory" validate:"required"`
+	Name         string `json:"name"         validate:"required"`
+	BaseRate     int64  `json:"baseRate"     validate:"required,gt=0"`
+	Currency     string `json:"currency"     validate:"required,iso4217"`
+	Board        string `json:"board"        validate:"required,oneof=room_only breakfast"`
+	Refundable   bool   `json:"refundable"`
+	Active       *bool  `json:"active"`
+}
+
+type UpdateRatePlanDTO struct {
+	Name       string `json:"name"       bson:"name,omitempty"`
+	BaseRate   int64  `json:"baseRate"   bson:"baseRate,omitempty"   validate:"omitempty,gt=0"`
+	Currency   string `json:"currency"   bson:"currency,omitempty"   validate:"omitempty,iso4217"`
+	Board      string `json:"board"      bson:"board,omitempty"      validate:"omitempty,oneof=room_only breakfast"`
+	Refundable *bool  `json:"refundable" bson:"refundable,omitempty"`
+	Active     *bool  `json:"active"     bson:"active,omitempty"`
+}
+
+type GetRatePlansDTO struct {
+	RoomCategory string `query:"roomCategory"`
+	Active       *bool  `query:"active"`
+}
+
+func CreateRatePlan(c *fiber.Ctx) error {
+	ratePlanCollection := common.GetDBCollection(RATE_PLAN_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var dto CreateRatePlanDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	plan := models.RatePlan{
+		RoomCategory: dto.RoomCategory,
+		Name:         dto.Name,
+		BaseRate:     dto.BaseRate,
+		Currency:     strings.ToUpper(dto.Currency),
+		Board:        dto.Board,
+		Refundable:   dto.Refundable,
+		Active:       dto.Active == nil || *dto.Active,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	result, err := ratePlanCollection.InsertOne(c.UserContext(), plan)
+	if err != nil {
+		return responses.FromDB(err, "Rate plan")
+	}
+	plan.ID = hexID(result.InsertedID)
+	utils.Audit(c, RATE_PLAN_MODEL, plan.ID, nil, plan)
+
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Rate plan created successfully", Data: &fiber.Map{"ratePlan": plan}})
+}
+
+// GetRatePlans lists rate plans, optionally for one room category or by active flag.
+func GetRatePlans(c *fiber.Ctx) error {
+	ratePlanCollection := common.GetDBCollection(RATE_PLAN_MODEL)
+	var q GetRatePlansDTO
+	if err := c.QueryParser(&q); err != nil {
+		return responses.BadRequest("Invalid query parameters")
+	}
+	filter := bson.M{}
+	if q.RoomCategory != "" {
+		filter["roomCategory"] = q.RoomCategory
+	}
+	if q.Active != nil {
+		filter["active"] = *q.Active
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "roomCategory", Value: 1}, {Key: "baseRate", Value: 1}})
+	cursor, err := ratePlanCollection.Find(c.UserContext(), filter, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	plans := make([]models.RatePlan, 0)
+	if err := cursor.All(c.UserContext(), &plans); err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Rate plans fetched successfully", Data: &fiber.Map{"ratePlans": plans}})
+}
+
+func GetRatePlan(c *fiber.Ctx) error {
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	plan, err := findRatePlan(c, objectId)
+	if err != nil {
+		return err
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Rate plan fetched successfully", Data: &fiber.Map{"ratePlan": plan}})
+}
+
+func UpdateRatePlan(c *fiber.Ctx) error {
+	ratePlanCollection := common.GetDBCollection(RATE_PLAN_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var b UpdateRatePlanDTO
+	if err := parseBody(c, &b); err != nil {
+		return err
+	}
+	b.Currency = strings.ToUpper(b.Currency)
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	plan, err := findRatePlan(c, objectId)
+	if err != nil {
+		return err
+	}
+
+	update, err := toSetDocument(b)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	update["updatedAt"] = time.Now()
+	result, err := ratePlanCollection.UpdateOne(c.UserContext(), bson.M{"_id": objectId}, bson.M{"$set": update})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, RATE_PLAN_MODEL, plan.ID, plan, b)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Rate plan update was successful", Data: &fiber.Map{"ratePlan": result}})
+}
+
+// DeleteRatePlan removes a plan, bookings keep the quote they were made with.
+func DeleteRatePlan(c *fiber.Ctx) error {
+	ratePlanCollection := common.GetDBCollection(RATE_PLAN_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	plan, err := findRatePlan(c, objectId)
+	if err != nil {
+		return err
+	}
+
+	result, err := ratePlanCollection.DeleteOne(c.UserContext(), bson.M{"_id": objectId})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, RATE_PLAN_MODEL, plan.ID, plan, nil)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Rate plan deleted successfully", Data: &fiber.Map{"data": result}})
+}
+
+func findRatePlan(c *fiber.Ctx, objectId primitive.ObjectID) (models.RatePlan, error) {
+	var plan models.RatePlan
+	err := common.GetDBCollection(RATE_PLAN_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&plan)
+	if err != nil {
+		return models.RatePlan{}, responses.FromDB(err, "Rate plan")
+	}
+	return plan, nil
+}
@@ -7,10 +7,8 @@ import (
 	"github.com/chiboycalix/hotel-booking-system-backend/models"
 	"github.com/chiboycalix/hotel-booking-system-backend/responses"
 	"github.com/chiboycalix/hotel-booking-system-backend/utils"
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var ROOM_MODEL = "rooms"
@@ -51,62 +49,38 @@ type GetRoomDTO struct {
 
 func CreateRoom(c *fiber.Ctx) error {
 	roomCollection := common.GetDBCollection(ROOM_MODEL)
-	var createRoomDto CreateRoomDTO
-	if err := c.BodyParser(&createRoomDto); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": "Please provide request body"}})
-	}
-	var tokenString = c.Get("Authorization")
-	isAdmin, err := utils.IsAdmin(tokenString, common.EnvJWTSecret(), c)
-	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-	}
-	if !isAdmin {
-		return c.Status(http.StatusUnauthorized).
-			JSON(responses.APIResponse{Status: http.StatusUnauthorized, Message: "Unauthorized", Data: &fiber.Map{"error": "Unauthorized"}})
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
 	}
-	if validationErr := validate.Struct(&createRoomDto); validationErr != nil {
-		for _, err := range validationErr.(validator.ValidationErrors) {
-			return c.Status(http.StatusBadRequest).
-				JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Invalid request", Data: &fiber.Map{"error": err.Field() + " is required"}})
-		}
-	}
-
-	formHeader, err := c.FormFile("roomImage")
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-	}
-
-	formFile, err := formHeader.Open()
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+	var createRoomDto CreateRoomDTO
+	if err := parseBody(c, &createRoomDto); err != nil {
+		return err
 	}
 
-	uploadUrl, err := utils.NewMediaUpload().FileUpload(models.File{File: formFile})
+	uploadUrl, err := uploadFormImage(c, "roomImage")
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return err
 	}
 
 	createRoomDto.RoomImage = uploadUrl
-	result, err := roomCollection.InsertOne(c.Context(), createRoomDto)
+	result, err := roomCollection.InsertOne(c.UserContext(), createRoomDto)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.FromDB(err, "Room")
 	}
+	utils.Audit(c, ROOM_MODEL, hexID(result.InsertedID), nil, createRoomDto)
 	return c.Status(http.StatusCreated).
 		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Room created successfully", Data: &fiber.Map{"room": result}})
 }
 
 func GetRoom(c *fiber.Ctx) error {
 	roomCollection := common.GetDBCollection(ROOM_MODEL)
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
 	var room models.Room
-	if err := roomCollection.FindOne(c.Context(), models.Room{ID: c.Params("id")}).Decode(&room); err != nil {
-		return c.Status(http.StatusNotFound).
-			JSON(responses.APIResponse{Status: http.StatusNotFound, Message: "Room not found", Data: &fiber.Map{"error": err.Error()}})
+	if err := roomCollection.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&room); err != nil {
+		return responses.FromDB(err, "Room")
 	}
 	return c.Status(http.StatusOK).
 		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Room found", Data: &fiber.Map{"room": room}})
@@ -115,19 +89,17 @@ func GetRoom(c *fiber.Ctx) error {
 func GetAllRooms(c *fiber.Ctx) error {
 	roomCollection := common.GetDBCollection(ROOM_MODEL)
 	rooms := make([]GetRoomDTO, 0)
-	cursor, err := roomCollection.Find(c.Context(), bson.M{})
+	cursor, err := roomCollection.Find(c.UserContext(), bson.M{})
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
 
 	// iterate over the cursor
-	for cursor.Next(c.Context()) {
+	for cursor.Next(c.UserContext()) {
 		room := GetRoomDTO{}
 		err := cursor.Decode(&room)
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).
-				JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+			return responses.Internal(err)
 		}
 		rooms = append(rooms, room)
 	}
@@ -138,38 +110,23 @@ func GetAllRooms(c *fiber.Ctx) error {
 
 func UpdateRoom(c *fiber.Ctx) error {
 	roomCollection := common.GetDBCollection(ROOM_MODEL)
-	var b UpdateRoomDTO
-	if err := c.BodyParser(&b); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid body"}})
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
 	}
-	var tokenString = c.Get("Authorization")
-	isAdmin, err := utils.IsAdmin(tokenString, common.EnvJWTSecret(), c)
-	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-	}
-	if !isAdmin {
-		return c.Status(http.StatusUnauthorized).
-			JSON(responses.APIResponse{Status: http.StatusUnauthorized, Message: "Unauthorized", Data: &fiber.Map{"error": "Unauthorized"}})
-	}
-	id := c.Params("id")
-	if id == "" {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Id is required"}})
+	var b UpdateRoomDTO
+	if err := parseBody(c, &b); err != nil {
+		return err
 	}
-	objectId, err := primitive.ObjectIDFromHex(id)
+	objectId, err := paramObjectID(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
 	room := GetRoomDTO{}
 
-	err = roomCollection.FindOne(c.Context(), bson.M{"_id": objectId}).Decode(&room)
+	err = roomCollection.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&room)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.FromDB(err, "Room")
 	}
 	if b.RoomBlock == "" {
 		b.RoomBlock = room.RoomBlock
@@ -191,40 +148,29 @@ func UpdateRoom(c *fiber.Ctx) error {
 	}
 
 	if b.RoomImage != "" {
-		var url models.Url
-		url.Url = b.RoomImage
-		uploadUrl, err := utils.NewMediaUpload().RemoteUpload(url)
+		uploadUrl, err := uploadRemoteImage(c, b.RoomImage)
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).
-				JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+			return err
 		}
 		b.RoomImage = uploadUrl
 	} else {
-		formHeader, err := c.FormFile("roomImage")
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-		}
-		formFile, err := formHeader.Open()
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-		}
 		// if image
-		uploadUrl, err := utils.NewMediaUpload().FileUpload(models.File{File: formFile})
+		uploadUrl, err := uploadFormImage(c, "roomImage")
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+			return err
 		}
 		b.RoomImage = uploadUrl
 	}
 
 	result, err := roomCollection.UpdateOne(
-		c.Context(),
+		c.UserContext(),
 		bson.M{"_id": objectId},
 		bson.M{"$set": b},
 	)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Failed to update room", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
+	utils.Audit(c, ROOM_MODEL, room.ID, room, b)
 
 	return c.Status(http.StatusOK).
 		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Room update was successful", Data: &fiber.Map{"room": result}})
@@ -232,32 +178,27 @@ func UpdateRoom(c *fiber.Ctx) error {
 
 func DeleteRoom(c *fiber.Ctx) error {
 	roomCollection := common.GetDBCollection(ROOM_MODEL)
-	id := c.Params("id")
-	var tokenString = c.Get("Authorization")
-	isAdmin, err := utils.IsAdmin(tokenString, common.EnvJWTSecret(), c)
-	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-	}
-	if !isAdmin {
-		return c.Status(http.StatusUnauthorized).
-			JSON(responses.APIResponse{Status: http.StatusUnauthorized, Message: "Unauthorized", Data: &fiber.Map{"error": "Unauthorized"}})
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
 	}
-	if id == "" {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Id is required"}})
-	}
-	objectId, err := primitive.ObjectIDFromHex(id)
+	objectId, err := paramObjectID(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
-	result, err := roomCollection.DeleteOne(c.Context(), bson.M{"_id": objectId})
+	room := GetRoomDTO{}
+	if err := roomCollection.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&room); err != nil {
+		return responses.FromDB(err, "Room")
+	}
+
+	result, err := roomCollection.DeleteOne(c.UserContext(), bson.M{"_id": objectId})
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Fail to delete room"}})
+		return responses.Internal(err)
+	}
+	if result.DeletedCount == 0 {
+		return responses.NotFound("Room not found")
 	}
+	utils.Audit(c, ROOM_MODEL, room.ID, room, nil)
 	return c.Status(http.StatusOK).
 		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Room deleted successfully", Data: &fiber.Map{"data": result}})
 }
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var TAX_RULE_MODEL = "tax_rules"
+
+// TaxRuleDTO creates a tax or fee and, on PUT, replaces it.
+type TaxRuleDTO struct {
+	Name           string   `json:"name"           validate:"required"`
+	Basis          string   `json:"basis"          validate:"required,oneof=percent per_night per_person_night per_stay"`
+	Rate           float64  `json:"rate"           validate:"omitempty,gt=0,max=100"`
+	Amount         int64    `json:"amount"         validate:"omitempty,gt=0"`
+	Currency       string   `json:"currency"       validate:"omitempty,iso4217"`
+	Inclusive      bool     `json:"inclusive"`
+	RoomCategories []string `json:"roomCategories"`
+	Active         *bool    `json:"active"`
+}
+
+func CreateTaxRule(c *fiber.Ctx) error {
+	taxCollection := common.GetDBCollection(TAX_RULE_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var dto TaxRuleDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	rule, err := taxRuleFromDTO(dto)
+	if err != nil {
+		return err
+	}
+	rule.CreatedAt = rule.UpdatedAt
+
+	result, err := taxCollection.InsertOne(c.UserContext(), rule)
+	if err != nil {
+		return responses.FromDB(err, "Tax rule")
+	}
+	rule.ID = hexID(result.InsertedID)
+	utils.Audit(c, TAX_RULE_MODEL, rule.ID, nil, rule)
+
+	return c.Status(http.StatusCreated).
+		JSON(responses.APIResponse{Status: http.StatusCreated, Message: "Tax rule created successfully", Data: &fiber.Map{"taxRule": rule}})
+}
+
+func GetTaxRules(c *fiber.Ctx) error {
+	taxCollection := common.GetDBCollection(TAX_RULE_MODEL)
+	if _, err := utils.RequireStaff(c); err != nil {
+		return err
+	}
+	filter := bson.M{}
+	if category := c.Query("roomCategory"); category != "" {
+		filter["roomCategories"] = bson.M{"$in": bson.A{category}}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := taxCollection.Find(c.UserContext(), filter, opts)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	rules := make([]models.TaxRule, 0)
+	if err := cursor.All(c.UserContext(), &rules); err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Tax rules fetched successfully", Data: &fiber.Map{"taxRules": rules}})
+}
+
+// UpdateTaxRule replaces a rule, bookings keep the taxes they were quoted with.
+func UpdateTaxRule(c *fiber.Ctx) error {
+	taxCollection := common.GetDBCollection(TAX_RULE_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var dto TaxRuleDTO
+	if err := parseBody(c, &dto); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	existing, err := findTaxRule(c, objectId)
+	if err != nil {
+		return err
+	}
+	rule, err := taxRuleFromDTO(dto)
+	if err != nil {
+		return err
+	}
+	rule.CreatedAt = existing.CreatedAt
+
+	result, err := taxCollection.ReplaceOne(c.UserContext(), bson.M{"_id": objectId}, rule)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, TAX_RULE_MODEL, existing.ID, existing, rule)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Tax rule update was successful", Data: &fiber.Map{"taxRule": result}})
+}
+
+func DeleteTaxRule(c *fiber.Ctx) error {
+	taxCollection := common.GetDBCollection(TAX_RULE_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+	rule, err := findTaxRule(c, objectId)
+	if err != nil {
+		return err
+	}
+
+	result, err := taxCollection.DeleteOne(c.UserContext(), bson.M{"_id": objectId})
+	if err != nil {
+		return responses.Internal(err)
+	}
+	utils.Audit(c, TAX_RULE_MODEL, rule.ID, rule, nil)
+
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Tax rule deleted successfully", Data: &fiber.Map{"data": result}})
+}
+
+// taxRuleFromDTO checks that the fields the rule's basis needs are set.
+func taxRuleFromDTO(dto TaxRuleDTO) (models.TaxRule, error) {
+	if dto.Basis == models.TaxPercent {
+		if dto.Rate == 0 {
+			return models.TaxRule{}, responses.BadRequest("Percentage taxes need rate")
+		}
+		dto.Amount, dto.Currency = 0, ""
+	} else {
+		if dto.Amount == 0 || dto.Currency == "" {
+			return models.TaxRule{}, responses.BadRequest("Fixed taxes and fees need amount and currency")
+		}
+		if dto.Inclusive {
+			return models.TaxRule{}, responses.BadRequest("Only percentage taxes can be included in the room price")
+		}
+		dto.Rate = 0
+	}
+	categories := dto.RoomCategories
+	if categories == nil {
+		categories = []string{}
+	}
+
+	return models.TaxRule{
+		Name:           dto.Name,
+		Basis:          dto.Basis,
+		Rate:           dto.Rate,
+		Amount:         dto.Amount,
+		Currency:       strings.ToUpper(dto.Currency),
+		Inclusive:      dto.Inclusive,
+		RoomCategories: categories,
+		Active:         dto.Active == nil || *dto.Active,
+		UpdatedAt:      time.Now(),
+	}, nil
+}
+
+func findTaxRule(c *fiber.Ctx, objectId primitive.ObjectID) (models.TaxRule, error) {
+	var rule models.TaxRule
+	err := common.GetDBCollection(TAX_RULE_MODEL).FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&rule)
+	if err != nil {
+		return models.TaxRule{}, responses.FromDB(err, "Tax rule")
+	}
+	return rule, nil
+}
+
+// taxRulesFor loads the active taxes and fees for a room category.
+func taxRulesFor(ctx context.Context, roomCategory string) ([]models.TaxRule, error) {
+	filter := bson.M{
+		"active": true,
+		"$or": bson.A{
+			bson.M{"roomCategories": bson.M{"$size": 0}},
+			bson.M{"roomCategories": roomCategory},
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := common.GetDBCollection(TAX_RULE_MODEL).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]models.TaxRule, 0)
+	err = cursor.All(ctx, &rules)
+	return rules, err
+}
+
+// applyTaxes adds the taxes and fees of a stay to its quote. Percentages are of
+// the total after discounts; inclusive ones are broken out of it and exclusive
+// ones added on top, as are the fixed amounts.
+func applyTaxes(ctx context.Context, quote models.PriceQuote, s stay) (models.PriceQuote, error) {
+	rules, err := taxRulesFor(ctx, s.Room.RoomCategory)
+	if err != nil {
+		return models.PriceQuote{}, responses.Internal(err)
+	}
+	quote.Taxes = make([]models.TaxLine, 0, len(rules))
+	if len(rules) == 0 {
+		return quote, nil
+	}
+	rates, err := loadExchangeRates(ctx)
+	if err != nil {
+		return models.PriceQuote{}, responses.Internal(err)
+	}
+
+	taxable := quote.Total
+	nights := int64(len(quote.Nights))
+	for _, r := range rules {
+		line := models.TaxLine{TaxRuleID: r.ID, Name: r.Name, Basis: r.Basis, Rate: r.Rate, Inclusive: r.Inclusive}
+		switch r.Basis {
+		case models.TaxPercent:
+			if r.Inclusive {
+				line.Amount = taxable - int64(math.Round(float64(taxable)/(1+r.Rate/100)))
+			} else {
+				line.Amount = int64(math.Round(float64(taxable) * r.Rate / 100))
+			}
+		default:
+			amount, err := rates.convert(r.Amount, r.Currency, quote.Currency)
+			if err != nil {
+				return models.PriceQuote{}, err
+			}
+			switch r.Basis {
+			case models.TaxPerNight:
+				amount *= nights
+			case models.TaxPerPersonNight:
+				amount *= nights * int64(quote.Guests)
+			}
+			line.Amount = amount
+		}
+		quote.Taxes = append(quote.Taxes, line)
+		if !line.Inclusive {
+			quote.TaxTotal += line.Amount
+		}
+	}
+	quote.Total += quote.TaxTotal
+	return quote, nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var errNoImage = responses.NewError(http.StatusBadRequest, responses.CodeValidation, "Image is required")
+
+// uploadFormImage uploads the multipart file in field and returns its url,
+// errNoImage is returned when the request carries no such file.
+func uploadFormImage(c *fiber.Ctx, field string) (string, error) {
+	formHeader, err := c.FormFile(field)
+	if errors.Is(err, fasthttp.ErrMissingFile) || errors.Is(err, fasthttp.ErrNoMultipartForm) || (err == nil && formHeader == nil) {
+		return "", errNoImage
+	}
+	if err != nil {
+		return "", responses.BadRequest("Invalid " + field + " file")
+	}
+
+	formFile, err := formHeader.Open()
+	if err != nil {
+		return "", responses.Internal(err)
+	}
+	defer formFile.Close()
+
+	uploadUrl, err := utils.NewMediaUpload().FileUpload(c.UserContext(), models.File{File: formFile})
+	if err != nil {
+		return "", responses.Upstream("Failed to upload image", err)
+	}
+	return uploadUrl, nil
+}
+
+// uploadRemoteImage copies an image from a remote url into our media storage.
+func uploadRemoteImage(c *fiber.Ctx, url string) (string, error) {
+	uploadUrl, err := utils.NewMediaUpload().RemoteUpload(c.UserContext(), models.Url{Url: url})
+	if err != nil {
+		return "", responses.Upstream("Failed to upload image", err)
+	}
+	return uploadUrl, nil
+}
@@ -5,63 +5,63 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
 	"github.com/chiboycalix/hotel-booking-system-backend/responses"
 	"github.com/chiboycalix/hotel-booking-system-backend/utils"
 )
 
 type UsersDTO struct {
 	ID          string `json:"id"          bson:"_id"`
-	Email       string `json:"email"       bson:"email"`
+	Email       string `json:"email"       bson:"email"       encrypt:"lookup"`
 	Role        string `json:"role"        bson:"role"`
 	FirstName   string `json:"firstName"   bson:"firstName"`
 	LastName    string `json:"lastName"    bson:"lastName"`
-	PhoneNumber int64  `json:"phoneNumber" bson:"phoneNumber"`
-	Location    string `json:"location"    bson:"location"`
-	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth"`
+	PhoneNumber string `json:"phoneNumber" bson:"phoneNumber" encrypt:"lookup"`
+	Location    string `json:"location"    bson:"location"    encrypt:"random"`
+	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth" encrypt:"random"`
+	Locale      string `json:"locale"      bson:"locale"`
 	IsVerified  bool   `json:"isVerified"  bson:"isVerified"`
 }
 
 type UpdateUserDTO struct {
 	FirstName   string `json:"firstName"   bson:"firstName"`
 	LastName    string `json:"lastName"    bson:"lastName"`
-	PhoneNumber int64  `json:"phoneNumber" bson:"phoneNumber"`
-	Location    string `json:"location"    bson:"location"`
-	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth"`
+	PhoneNumber string `json:"phoneNumber" bson:"phoneNumber" encrypt:"lookup"`
+	Location    string `json:"location"    bson:"location"    encrypt:"random"`
+	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth" encrypt:"random"`
+	Locale      string `json:"locale"      bson:"locale"      validate:"omitempty,bcp47_language_tag"`
+}
+
+type UpdateUserRoleDTO struct {
+	Role string `json:"role" bson:"role" validate:"required,oneof=GUEST STAFF ADMIN"`
 }
 
 const USERS_MODEL = "users"
 
 func GetAllUsers(c *fiber.Ctx) error {
 	coll := common.GetDBCollection(USERS_MODEL)
-	var tokenString = c.Get("Authorization")
-	isAdmin, err := utils.IsAdmin(tokenString, common.EnvJWTSecret(), c)
-	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
-	}
-	if !isAdmin {
-		return c.Status(http.StatusUnauthorized).
-			JSON(responses.APIResponse{Status: http.StatusUnauthorized, Message: "Unauthorized", Data: &fiber.Map{"error": "Unauthorized"}})
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
 	}
 
 	// find all users
 	users := make([]UsersDTO, 0)
-	cursor, err := coll.Find(c.Context(), bson.M{})
+	cursor, err := coll.Find(c.UserContext(), bson.M{})
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
 
 	// iterate over the cursor
-	for cursor.Next(c.Context()) {
+	for cursor.Next(c.UserContext()) {
 		user := UsersDTO{}
 		err := cursor.Decode(&user)
 		if err != nil {
-			return c.Status(http.StatusInternalServerError).
-				JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+			return responses.Internal(err)
+		}
+		if err := openFields(&user); err != nil {
+			return err
 		}
 		users = append(users, user)
 	}
@@ -74,23 +74,19 @@ func GetUser(c *fiber.Ctx) error {
 	coll := common.GetDBCollection(USERS_MODEL)
 
 	// find the user
-	id := c.Params("id")
-	if id == "" {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Id is required"}})
-	}
-	objectId, err := primitive.ObjectIDFromHex(id)
+	objectId, err := paramObjectID(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
 	user := UsersDTO{}
 
-	err = coll.FindOne(c.Context(), bson.M{"_id": objectId}).Decode(&user)
+	err = coll.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&user)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.FromDB(err, "User")
+	}
+	if err := openFields(&user); err != nil {
+		return err
 	}
 
 	return c.Status(http.StatusOK).
@@ -100,60 +96,87 @@ func GetUser(c *fiber.Ctx) error {
 func UpdateUser(c *fiber.Ctx) error {
 	userCollection := common.GetDBCollection(USERS_MODEL)
 	b := new(UpdateUserDTO)
-	if err := c.BodyParser(b); err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid body"}})
+	if err := parseBody(c, b); err != nil {
+		return err
 	}
 
-	id := c.Params("id")
-	if id == "" {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Id is required"}})
-	}
-	objectId, err := primitive.ObjectIDFromHex(id)
+	objectId, err := paramObjectID(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
-	result, err := userCollection.UpdateOne(c.Context(), bson.M{"_id": objectId}, bson.M{"$set": b})
+	user := UsersDTO{}
+	if err := userCollection.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&user); err != nil {
+		return responses.FromDB(err, "User")
+	}
+
+	if err := sealFields(b); err != nil {
+		return err
+	}
+	result, err := userCollection.UpdateOne(c.UserContext(), bson.M{"_id": objectId}, bson.M{"$set": b})
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).
-			JSON(responses.APIResponse{Status: http.StatusInternalServerError, Message: "Failed to update user", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
+	utils.Audit(c, USERS_MODEL, user.ID, user, b)
 
 	return c.Status(http.StatusOK).
 		JSON(responses.APIResponse{Status: http.StatusOK, Message: "User update was successful", Data: &fiber.Map{"user": result}})
 }
 
 func DeleteUser(c *fiber.Ctx) error {
-	id := c.Params("id")
 	userCollection := common.GetDBCollection(USERS_MODEL)
-	var tokenString = c.Get("Authorization")
-	isAdmin, err := utils.IsAdmin(tokenString, common.EnvJWTSecret(), c)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	objectId, err := paramObjectID(c)
+	if err != nil {
+		return err
+	}
+
+	user := UsersDTO{}
+	if err := userCollection.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&user); err != nil {
+		return responses.FromDB(err, "User")
+	}
+
+	result, err := userCollection.DeleteOne(c.UserContext(), bson.M{"_id": objectId})
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": err.Error()}})
+		return responses.Internal(err)
 	}
-	if !isAdmin {
-		return c.Status(http.StatusUnauthorized).
-			JSON(responses.APIResponse{Status: http.StatusUnauthorized, Message: "Unauthorized", Data: &fiber.Map{"error": "Unauthorized"}})
+	if result.DeletedCount == 0 {
+		return responses.NotFound("User not found")
 	}
-	if id == "" {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Id is required"}})
+	utils.Audit(c, USERS_MODEL, user.ID, user, nil)
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "User deleted successfully", Data: &fiber.Map{"data": result}})
+}
+
+// UpdateUserRole lets admins grant or revoke staff and admin roles.
+func UpdateUserRole(c *fiber.Ctx) error {
+	userCollection := common.GetDBCollection(USERS_MODEL)
+	if _, err := utils.RequireAdmin(c); err != nil {
+		return err
+	}
+	var b UpdateUserRoleDTO
+	if err := parseBody(c, &b); err != nil {
+		return err
 	}
-	objectId, err := primitive.ObjectIDFromHex(id)
+	objectId, err := paramObjectID(c)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Invalid Id"}})
+		return err
 	}
 
-	result, err := userCollection.DeleteOne(c.Context(), bson.M{"_id": objectId})
+	user := UsersDTO{}
+	if err := userCollection.FindOne(c.UserContext(), bson.M{"_id": objectId}).Decode(&user); err != nil {
+		return responses.FromDB(err, "User")
+	}
+
+	update := bson.M{"role": b.Role, "isAdmin": b.Role == models.RoleAdmin}
+	result, err := userCollection.UpdateOne(c.UserContext(), bson.M{"_id": objectId}, bson.M{"$set": update})
 	if err != nil {
-		return c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Something went wrong", Data: &fiber.Map{"error": "Fail to delete user"}})
+		return responses.Internal(err)
 	}
+	utils.AuditAction(c, "change-role", USERS_MODEL, user.ID, user, update)
+
 	return c.Status(http.StatusOK).
-		JSON(responses.APIResponse{Status: http.StatusOK, Message: "User deleted successfully", Data: &fiber.Map{"data": result}})
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "User role updated", Data: &fiber.Map{"user": result}})
 }
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+)
+
+var validate = newValidator()
+
+// newValidator reports fields by their json name so clients can map errors back to inputs.
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+		if name == "-" || name == "" {
+			return fld.Name
+		}
+		return name
+	})
+	return v
+}
+
+// parseBody decodes the request body into out and validates it.
+func parseBody(c *fiber.Ctx, out interface{}) error {
+	if err := c.BodyParser(out); err != nil {
+		return responses.BadRequest("Invalid request body")
+	}
+	return validateStruct(out)
+}
+
+func validateStruct(s interface{}) error {
+	if err := validate.Struct(s); err != nil {
+		return responses.Validation(err)
+	}
+	return nil
+}
+
+// paramObjectID reads the :id route param as a Mongo ObjectID.
+func paramObjectID(c *fiber.Ctx) (primitive.ObjectID, error) {
+	return parseObjectID(c.Params("id"))
+}
+
+// hexID renders an InsertedID (or any stored id) as the hex string we expose.
+func hexID(id interface{}) string {
+	if oid, ok := id.(primitive.ObjectID); ok {
+		return oid.Hex()
+	}
+	s, _ := id.(string)
+	return s
+}
+
+func parseObjectID(id string) (primitive.ObjectID, error) {
+	if id == "" {
+		return primitive.NilObjectID, responses.BadRequest("Id is required")
+	}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, responses.BadRequest("Invalid Id")
+	}
+	return objectId, nil
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+var PAYMENT_EVENT_MODEL = "payment_events"
+
+// PaymentWebhook receives a gateway's notice that a payment or refund changed.
+// Each event is stored once under its id and applied in a transaction; when that
+// fails the gateway gets an error and retries, and a retried or duplicate event
+// that was already applied is acknowledged without applying it again.
+func PaymentWebhook(c *fiber.Ctx) error {
+	provider, err := utils.PaymentProviderByName(c.Params("provider"))
+	if err != nil {
+		return responses.NotFound("Unknown payment provider")
+	}
+	// fasthttp reuses the body buffer after the handler returns
+	body := append([]byte(nil), c.Body()...)
+	if err := provider.VerifyWebhook(func(key string) string { return c.Get(key) }, body); err != nil {
+		return responses.Unauthorized("Invalid webhook signature")
+	}
+	event, err := provider.ParseWebhook(body)
+	if err != nil || event.ID == "" {
+		return responses.BadRequest("Invalid webhook payload")
+	}
+
+	record, err := storePaymentEvent(c.UserContext(), provider.Name(), event, body)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	if record.Status == models.EventProcessed || record.Status == models.EventIgnored {
+		return c.Status(http.StatusOK).
+			JSON(responses.APIResponse{Status: http.StatusOK, Message: "Event already processed", Data: &fiber.Map{"status": record.Status}})
+	}
+	status, err := processPaymentEvent(c.UserContext(), record)
+	if err != nil {
+		return responses.Internal(err)
+	}
+	return c.Status(http.StatusOK).
+		JSON(responses.APIResponse{Status: http.StatusOK, Message: "Event " + status, Data: &fiber.Map{"status": status}})
+}
+
+// storePaymentEvent records an event the first time it arrives, later
+// deliveries return the stored record.
+func storePaymentEvent(ctx context.Context, provider string, event utils.WebhookEvent, body []byte) (models.PaymentEvent, error) {
+	eventCollection := common.GetDBCollection(PAYMENT_EVENT_MODEL)
+	record := models.PaymentEvent{
+		Provider:   provider,
+		EventID:    event.ID,
+		Type:       event.Type,
+		PaymentRef: event.PaymentRef,
+		Payload:    string(body),
+		Status:     models.EventReceived,
+		ReceivedAt: time.Now(),
+	}
+	result, err := eventCollection.InsertOne(ctx, record)
+	if err == nil {
+		record.ID = hexID(result.InsertedID)
+		return record, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return models.PaymentEvent{}, err
+	}
+	var existing models.PaymentEvent
+	err = eventCollection.FindOne(ctx, bson.M{"provider": provider, "eventId": event.ID}).Decode(&existing)
+	return existing, err
+}
+
+// processPaymentEvent applies a stored event and records the outcome on it. The
+// payment, its booking and the event change together or not at all.
+func processPaymentEvent(ctx context.Context, record models.PaymentEvent) (string, error) {
+	objectId, err := primitive.ObjectIDFromHex(record.ID)
+	if err != nil {
+		return "", err
+	}
+	var status string
+	err = func() error {
+		provider, err := utils.PaymentProviderByName(record.Provider)
+		if err != nil {
+			return err
+		}
+		event, err := provider.ParseWebhook([]byte(record.Payload))
+		if err != nil {
+			return err
+		}
+		return common.WithTransaction(ctx, func(ctx context.Context) error {
+			if status, err = applyPaymentEvent(ctx, record.Provider, event); err != nil {
+				return err
+			}
+			return markPaymentEvent(ctx, objectId, status, "")
+		})
+	}()
+	if err != nil {
+		common.Logger(ctx).Error("payment event failed", "provider", record.Provider, "eventId", record.EventID, "error", err)
+		if markErr := markPaymentEvent(ctx, objectId, models.EventFailed, err.Error()); markErr != nil {
+			common.Logger(ctx).Error("failed to record payment event failure", "eventId", record.EventID, "error", markErr)
+		}
+		return models.EventFailed, err
+	}
+	return status, nil
+}
+
+// applyPaymentEvent updates the payment an event is about, events for payments
+// we don't know and types we don't handle are ignored.
+func applyPaymentEvent(ctx context.Context, provider string, event utils.WebhookEvent) (string, error) {
+	if event.Intent == nil && event.Refund == nil {
+		return models.EventIgnored, nil
+	}
+	var payment models.Payment
+	err := common.GetDBCollection(PAYMENT_MODEL).
+		FindOne(ctx, bson.M{"provider": provider, "providerRef": event.PaymentRef}).
+		Decode(&payment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		common.Logger(ctx).Warn("payment event for unknown payment", "provider", provider, "eventId", event.ID, "ref", event.PaymentRef)
+		return models.EventIgnored, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if event.Intent != nil {
+		_, err = applyIntent(ctx, payment, *event.Intent)
+	} else {
+		err = applyRefund(ctx, payment, *event.Refund)
+	}
+	if err != nil {
+		return "", err
+	}
+	return models.EventProcessed, nil
+}
+
+// applyRefund records a refund's latest status, refunds made from the gateway's
+// dashboard are added as they are reported. Each change is conditional on the
+// refund as it was read, a miss means it changed meanwhile and is read again.
+func applyRefund(ctx context.Context, payment models.Payment, result utils.RefundResult) error {
+	paymentCollection := common.GetDBCollection(PAYMENT_MODEL)
+	objectId, err := primitive.ObjectIDFromHex(payment.ID)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		var filter, update bson.M
+		var existing *models.Refund
+		for i := range payment.Refunds {
+			if payment.Refunds[i].ProviderRef == result.Ref {
+				existing = &payment.Refunds[i]
+			}
+		}
+		if existing == nil {
+			refund := models.Refund{
+				ProviderRef: result.Ref,
+				Amount:      result.Amount,
+				Status:      result.Status,
+				Reason:      "reported by " + payment.Provider,
+				CreatedAt:   time.Now(),
+			}
+			filter = bson.M{"_id": objectId, "refunds.providerRef": bson.M{"$ne": refund.ProviderRef}}
+			update = bson.M{"$push": bson.M{"refunds": refund}, "$set": bson.M{"updatedAt": time.Now()}}
+			if refundCounts(refund.Status) {
+				update["$inc"] = bson.M{"refunded": refund.Amount}
+			}
+		} else {
+			filter = bson.M{"_id": objectId, "refunds": bson.M{"$elemMatch": bson.M{"providerRef": result.Ref, "status": existing.Status}}}
+			update = bson.M{"$set": bson.M{"refunds.$.status": result.Status, "updatedAt": time.Now()}}
+			switch {
+			case refundCounts(existing.Status) && !refundCounts(result.Status):
+				update["$inc"] = bson.M{"refunded": -existing.Amount}
+			case !refundCounts(existing.Status) && refundCounts(result.Status):
+				update["$inc"] = bson.M{"refunded": existing.Amount}
+			}
+		}
+		updated, err := paymentCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if updated.MatchedCount > 0 {
+			_, err = settleRefundStatus(ctx, objectId)
+			return err
+		}
+		if err := paymentCollection.FindOne(ctx, bson.M{"_id": objectId}).Decode(&payment); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("refund %s of payment %s kept changing while it was applied", result.Ref, payment.ID)
+}
+
+func markPaymentEvent(ctx context.Context, objectId primitive.ObjectID, status, reason string) error {
+	update := bson.M{
+		"$set": bson.M{"status": status, "error": reason, "processedAt": time.Now()},
+		"$inc": bson.M{"attempts": 1},
+	}
+	_, err := common.GetDBCollection(PAYMENT_EVENT_MODEL).UpdateOne(ctx, bson.M{"_id": objectId}, update)
+	return err
+}
+
+// ReplayPaymentEvents processes stored events again, oldest first; applying an
+// event twice leaves the same state, so processed events may be replayed too.
+// It returns how many were replayed and how many of those failed.
+func ReplayPaymentEvents(ctx context.Context, filter bson.M) (replayed, failed int, err error) {
+	opts := options.Find().SetSort(bson.D{{Key: "receivedAt", Value: 1}})
+	cursor, err := common.GetDBCollection(PAYMENT_EVENT_MODEL).Find(ctx, filter, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	events := make([]models.PaymentEvent, 0)
+	if err := cursor.All(ctx, &events); err != nil {
+		return 0, 0, err
+	}
+	for _, record := range events {
+		replayed++
+		if _, err := processPaymentEvent(ctx, record); err != nil {
+			failed++
+		}
+	}
+	return replayed, failed, nil
+}
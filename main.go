@@ -1,24 +1,35 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/providers/google"
 
 	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/chiboycalix/hotel-booking-system-backend/middleware"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
 	"github.com/chiboycalix/hotel-booking-system-backend/router"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
 )
 
+const shutdownTimeout = 15 * time.Second
+
 func main() {
 	err := run()
 	if err != nil {
-		panic(err)
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
 	}
 }
 
@@ -29,17 +40,85 @@ func run() error {
 		return err
 	}
 
+	// init logger
+	common.InitLogger()
+
+	// load the keys sealing personal data
+	err = utils.LoadDataKeys()
+	if err != nil {
+		return err
+	}
+
+	// refuse to take payments through a missing or unconfigured gateway
+	err = utils.CheckPaymentProvider()
+	if err != nil {
+		return err
+	}
+
 	// init db
 	err = common.InitDB()
 	if err != nil {
 		return err
 	}
 
-	// defer closing db
-	defer common.CloseDB()
+	// defer closing db, after the server has drained
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := common.CloseDB(ctx); err != nil {
+			slog.Error("error closing db", "error", err)
+		}
+	}()
+
+	// bookings need transactions, a standalone server can't run them
+	err = common.CheckTransactions(context.Background())
+	if err != nil {
+		return err
+	}
+
+	// init indexes
+	err = handlers.EnsureIndexes(context.Background())
+	if err != nil {
+		return err
+	}
+
+	// users written before phoneNumber was encrypted hold it as a number
+	migrated, err := handlers.MigrateLegacyPhoneNumbers(context.Background())
+	if err != nil {
+		return err
+	}
+	if migrated > 0 {
+		slog.Info("migrated legacy phone numbers", "users", migrated)
+	}
+
+	// parse email templates
+	if err := utils.LoadEmailTemplates(); err != nil {
+		return err
+	}
+
+	// build the mail transport, an unknown or incomplete one fails here
+	if _, err := utils.ActiveMailer(); err != nil {
+		return err
+	}
+
+	// init tracing
+	shutdownTracing, err := common.InitTracing(context.Background())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("error flushing traces", "error", err)
+		}
+	}()
+	common.RegisterOccupancyGauge(handlers.RoomOccupancy)
 
 	// create app
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		ErrorHandler: responses.ErrorHandler,
+	})
 	goth.UseProviders(
 		google.New(
 			os.Getenv("GOOGLE_CLIENT_ID"),
@@ -47,10 +126,17 @@ func run() error {
 			"https://localhost:8011/callback",
 		),
 	)
+	// probes and scrapes are registered before the logger so they don't flood the logs
+	router.HealthRoutes(app)
+	router.MetricsRoutes(app)
 	// add basic middleware
-	app.Use(logger.New())
+	app.Use(middleware.RequestID())
+	app.Use(middleware.Telemetry())
+	app.Use(middleware.RequestLogger())
+	app.Use(middleware.Audit())
 	app.Use(cors.New(cors.Config{
-		AllowHeaders:     "Origin,Content-Type,Accept,Content-Length,Accept-Language,Accept-Encoding,Connection,Access-Control-Allow-Origin,Access-Control-Allow-Credentials",
+		AllowHeaders:     "Origin,Content-Type,Accept,Content-Length,Accept-Language,Accept-Encoding,Connection,Access-Control-Allow-Origin,Access-Control-Allow-Credentials,Authorization,X-Request-ID,Idempotency-Key",
+		ExposeHeaders:    "X-Request-ID,Idempotent-Replayed",
 		AllowOrigins:     "*",
 		AllowCredentials: true,
 		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
@@ -61,12 +147,79 @@ func run() error {
 	router.AuthRoutes(app)
 	router.ListingRoutes(app)
 	router.RoomRoutes(app)
+	router.RatePlanRoutes(app)
+	router.PricingRuleRoutes(app)
+	router.TaxRuleRoutes(app)
+	router.ExchangeRateRoutes(app)
+	router.PromotionRoutes(app)
 	router.BookingsRoutes(app)
+	router.BookingGroupRoutes(app)
+	router.PaymentRoutes(app)
+	router.WebhookRoutes(app)
+	router.InvoiceRoutes(app)
+	router.GuestRoutes(app)
+	router.AuditRoutes(app)
+	router.OutboxRoutes(app)
+	router.EmailTemplateRoutes(app)
 	// start server
 	var port string
 	if port = os.Getenv("PORT"); port == "" {
 		port = "8011"
 	}
-	log.Fatal(app.Listen(":" + port))
-	return nil
+
+	// background jobs stop together with the server, and the db is only closed
+	// (deferred above, so after this) once they have returned
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	var jobs sync.WaitGroup
+	defer func() {
+		stopJobs()
+		jobs.Wait()
+	}()
+	background := func(job func(ctx context.Context)) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(jobsCtx)
+		}()
+	}
+	background(func(ctx context.Context) {
+		common.RunEvery(ctx, time.Hour, "purge-identity-documents", handlers.PurgeExpiredDocuments)
+	})
+	background(func(ctx context.Context) {
+		common.RunEvery(ctx, time.Minute, "expire-booking-holds", handlers.ExpireBookingHolds)
+	})
+	background(func(ctx context.Context) {
+		common.RunEvery(ctx, time.Hour, "send-arrival-reminders", handlers.SendArrivalReminders)
+	})
+	background(func(ctx context.Context) {
+		common.RunEvery(ctx, time.Hour, "send-thank-you-emails", handlers.SendThankYouEmails)
+	})
+	background(func(ctx context.Context) {
+		utils.RunOutboxWorkers(ctx, common.OutboxWorkers())
+	})
+
+	return serve(ctx, app, ":"+port)
+}
+
+// serve runs the app until ctx is cancelled by SIGINT/SIGTERM, then stops accepting
+// connections and waits up to shutdownTimeout for in-flight requests to finish.
+func serve(ctx context.Context, app *fiber.App, addr string) error {
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(addr)
+	}()
+
+	select {
+	case err := <-listenErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down server")
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		return err
+	}
+	return <-listenErr
 }
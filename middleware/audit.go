@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+// auditSkipPaths are mutating endpoints that change nothing worth auditing.
+var auditSkipPaths = map[string]bool{
+	"/auth/login": true,
+}
+
+var auditActions = map[string]string{
+	fiber.MethodPost:   "create",
+	fiber.MethodPut:    "update",
+	fiber.MethodPatch:  "update",
+	fiber.MethodDelete: "delete",
+}
+
+// Audit appends an audit entry for every mutating request once it has been handled.
+// Handlers describe the entity and its before/after state with utils.Audit; requests
+// without that still get an entry naming the route, actor and outcome.
+func Audit() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		action, mutating := auditActions[c.Method()]
+		if !mutating || auditSkipPaths[c.Path()] {
+			return c.Next()
+		}
+
+		if err := c.Next(); err != nil {
+			if herr := c.App().ErrorHandler(c, err); herr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		ctx := c.UserContext()
+		entry := models.AuditEntry{
+			ActorID:   common.UserID(ctx),
+			Action:    action,
+			Entity:    strings.SplitN(strings.TrimPrefix(c.Route().Path, "/"), "/", 2)[0],
+			EntityID:  c.Params("id"),
+			Method:    c.Method(),
+			Path:      c.Path(),
+			Status:    c.Response().StatusCode(),
+			IP:        c.IP(),
+			RequestID: common.RequestID(ctx),
+			CreatedAt: time.Now(),
+		}
+		entries := []models.AuditEntry{entry}
+		if records := utils.AuditRecords(c); len(records) > 0 {
+			entries = entries[:0]
+			for _, record := range records {
+				e := entry
+				if record.Action != "" {
+					e.Action = record.Action
+				}
+				e.Entity = record.Entity
+				e.EntityID = record.EntityID
+				changes, err := utils.DiffDocuments(record.Before, record.After)
+				if err != nil {
+					common.Logger(ctx).Error("audit diff failed", "error", err)
+				}
+				e.Changes = changes
+				entries = append(entries, e)
+			}
+		}
+
+		// the response is already decided, a failed write is logged rather than surfaced
+		writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		for _, e := range entries {
+			if err := utils.WriteAudit(writeCtx, e); err != nil {
+				common.Logger(ctx).Error("audit write failed", "error", err, "entity", e.Entity, "entityId", e.EntityID)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/responses"
+	"github.com/chiboycalix/hotel-booking-system-backend/utils"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+// Idempotency makes a route safe to retry. A request sent with an
+// Idempotency-Key runs once per caller and key; retries get the stored
+// response back with Idempotent-Replayed set, a retry while the first attempt
+// is still running is refused, and so is the key reused for another request.
+// Only successful responses are kept, after a failure the key can be retried.
+// A request that holds its key past IDEMPOTENCY_LEASE_SECONDS without finishing
+// is taken for dead, and a retry takes the key over.
+//
+// Keys are scoped to the authenticated caller, so the header is ignored on
+// requests without a valid token; those are handled as usual, like requests
+// without the header, and the handler rejects them.
+func Idempotency() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(idempotencyHeader)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > 255 {
+			return responses.BadRequest("Idempotency-Key must be at most 255 characters")
+		}
+
+		// keys are per caller, anonymous callers would all share one namespace
+		claims, err := utils.ValidateToken(utils.BearerToken(c), common.EnvJWTSecret())
+		if err != nil || claims.ID == "" {
+			return c.Next()
+		}
+		ctx := c.UserContext()
+		fingerprint := utils.RequestFingerprint(c.Method(), c.Path(), c.Body())
+		record, reserved, err := utils.ReserveIdempotencyKey(ctx, claims.ID, key, fingerprint)
+		if err != nil {
+			return responses.Internal(err)
+		}
+		if !reserved {
+			switch {
+			case record.Fingerprint != fingerprint:
+				return responses.NewError(http.StatusUnprocessableEntity, responses.CodeConflict, "Idempotency-Key was already used for a different request")
+			case record.Status == models.IdempotencyInProgress:
+				return responses.Conflict("A request with this Idempotency-Key is still being processed")
+			}
+			c.Set("Idempotent-Replayed", "true")
+			c.Set(fiber.HeaderContentType, record.ContentType)
+			return c.Status(record.StatusCode).Send(record.Body)
+		}
+
+		if err := c.Next(); err != nil {
+			if herr := c.App().ErrorHandler(c, err); herr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		// the response is already decided, a failed write is logged rather than surfaced
+		writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		status := c.Response().StatusCode()
+		if status >= 200 && status < 300 {
+			body := append([]byte(nil), c.Response().Body()...)
+			contentType := string(c.Response().Header.ContentType())
+			err = utils.CompleteIdempotencyKey(writeCtx, record, status, contentType, body)
+		} else {
+			err = utils.ReleaseIdempotencyKey(writeCtx, record)
+		}
+		if err != nil {
+			common.Logger(ctx).Error("idempotency write failed", "error", err, "key", key)
+		}
+		return nil
+	}
+}
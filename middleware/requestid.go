@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID reuses the caller's X-Request-ID (or generates one), echoes it in the
+// response and stores it in the user context for logging.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = utils.UUIDv4()
+		}
+		c.Set(RequestIDHeader, id)
+		c.SetUserContext(common.WithRequestID(c.UserContext(), id))
+		return c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type AuditEntry struct {
+	ID        string        `json:"id"        bson:"_id,omitempty"`
+	ActorID   string        `json:"actorId"   bson:"actorId"`
+	Action    string        `json:"action"    bson:"action"` // create, update, delete, ...
+	Entity    string        `json:"entity"    bson:"entity"` // rooms, bookings, users, ...
+	EntityID  string        `json:"entityId"  bson:"entityId"`
+	Changes   []AuditChange `json:"changes"   bson:"changes"`
+	Method    string        `json:"method"    bson:"method"`
+	Path      string        `json:"path"      bson:"path"`
+	Status    int           `json:"status"    bson:"status"`
+	IP        string        `json:"ip"        bson:"ip"`
+	RequestID string        `json:"requestId" bson:"requestId"`
+	CreatedAt time.Time     `json:"createdAt" bson:"createdAt"`
+}
+
+type AuditChange struct {
+	Field  string      `json:"field"  bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after"  bson:"after"`
+}
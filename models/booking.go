@@ -2,12 +2,59 @@ package models
 
 import "time"
 
+// booking statuses, bookings made before payments were taken have none. New
+// bookings are held until paid, a hold that runs out expires and frees the room.
+const (
+	BookingHeld           = "held"
+	BookingExpired        = "expired"
+	BookingPendingPayment = "pending_payment"
+	BookingConfirmed      = "confirmed"
+	BookingCancelled      = "cancelled"
+)
+
 type Booking struct {
-	ID                 string    `json:"id" bson:"_id"`
-	RoomID             Room      `json:"roomId" bson:"roomId"`
-	GuestID            User      `json:"guestId" bson:"guestId"`
-	CheckIn            time.Time `json:"checkIn" bson:"checkIn"`
-	CheckOut           time.Time `json:"checkOut" bson:"checkOut"`
-	BookingDate        time.Time `json:"bookingDate" bson:"bookingDate"`
-	BookingUpdatedDate time.Time `json:"bookingUpdatedDate" bson:"bookingUpdatedDate"`
+	ID                 string            `json:"id" bson:"_id"`
+	RoomID             Room              `json:"roomId" bson:"roomId"`
+	GroupID            string            `json:"groupId" bson:"groupId,omitempty"`
+	GuestID            User              `json:"guestId" bson:"guestId"`
+	CheckIn            time.Time         `json:"checkIn" bson:"checkIn"`
+	CheckOut           time.Time         `json:"checkOut" bson:"checkOut"`
+	Guests             []BookingGuest    `json:"guests" bson:"guests"`
+	Quote              PriceQuote        `json:"quote" bson:"quote"`
+	Promotion          *AppliedPromotion `json:"promotion" bson:"promotion,omitempty"`
+	Status             string            `json:"status" bson:"status"`
+	HoldExpiresAt      *time.Time        `json:"holdExpiresAt" bson:"holdExpiresAt"`
+	ConfirmedAt        *time.Time        `json:"confirmedAt" bson:"confirmedAt"`
+	CancelledAt        *time.Time        `json:"cancelledAt" bson:"cancelledAt"`
+	CheckedInAt        *time.Time        `json:"checkedInAt" bson:"checkedInAt"`
+	CheckedInBy        string            `json:"checkedInBy" bson:"checkedInBy"`
+	CheckedOutAt       *time.Time        `json:"checkedOutAt" bson:"checkedOutAt"`
+	CheckedOutBy       string            `json:"checkedOutBy" bson:"checkedOutBy"`
+	Changes            []BookingChange   `json:"changes" bson:"changes"`
+	ReminderSentAt     *time.Time        `json:"reminderSentAt" bson:"reminderSentAt"`
+	ThankYouSentAt     *time.Time        `json:"thankYouSentAt" bson:"thankYouSentAt"`
+	BookingDate        time.Time         `json:"bookingDate" bson:"bookingDate"`
+	BookingUpdatedDate time.Time         `json:"bookingUpdatedDate" bson:"bookingUpdatedDate"`
+}
+
+// BookingTerms are the parts of a booking a modification can change.
+type BookingTerms struct {
+	RoomID     string    `json:"roomId"     bson:"roomId"`
+	CheckIn    time.Time `json:"checkIn"    bson:"checkIn"`
+	CheckOut   time.Time `json:"checkOut"   bson:"checkOut"`
+	Guests     int       `json:"guests"     bson:"guests"`
+	RatePlanID string    `json:"ratePlanId" bson:"ratePlanId"`
+	Total      int64     `json:"total"      bson:"total"`
+}
+
+// BookingChange is one modification of a booking. Difference is the change in
+// total, in the booking's currency; Refunded is what was paid back because of it.
+type BookingChange struct {
+	Before     BookingTerms `json:"before"     bson:"before"`
+	After      BookingTerms `json:"after"      bson:"after"`
+	Difference int64        `json:"difference" bson:"difference"`
+	Refunded   int64        `json:"refunded"   bson:"refunded"`
+	Currency   string       `json:"currency"   bson:"currency"`
+	ChangedBy  string       `json:"changedBy"  bson:"changedBy"`
+	ChangedAt  time.Time    `json:"changedAt"  bson:"changedAt"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	GroupActive    = "active"
+	GroupCancelled = "cancelled"
+)
+
+// BookingGroup ties together the bookings of several rooms made at once, e.g.
+// by a tour operator or for a wedding. Each room line is a booking of its own,
+// owned by the group leader, who is billed for the whole group.
+type BookingGroup struct {
+	ID          string     `json:"id"          bson:"_id,omitempty"`
+	Name        string     `json:"name"        bson:"name"`
+	LeaderID    string     `json:"leaderId"    bson:"leaderId"`
+	BookingIDs  []string   `json:"bookingIds"  bson:"bookingIds"`
+	Currency    string     `json:"currency"    bson:"currency"`
+	Status      string     `json:"status"      bson:"status"`
+	CreatedBy   string     `json:"createdBy"   bson:"createdBy"`
+	CreatedAt   time.Time  `json:"createdAt"   bson:"createdAt"`
+	CancelledAt *time.Time `json:"cancelledAt" bson:"cancelledAt"`
+	CancelledBy string     `json:"cancelledBy" bson:"cancelledBy"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// EmailTemplate is an admin's replacement for parts of an embedded email
+// template in one locale, "" being the default language. Empty fields keep
+// the embedded subject, HTML or text.
+type EmailTemplate struct {
+	ID        string    `json:"id"        bson:"_id,omitempty"`
+	Name      string    `json:"name"      bson:"name"`   // e.g. booking-confirmed
+	Locale    string    `json:"locale"    bson:"locale"` // e.g. fr, fr-ca
+	Subject   string    `json:"subject"   bson:"subject"`
+	HTML      string    `json:"html"      bson:"html"`
+	Text      string    `json:"text"      bson:"text"`
+	UpdatedBy string    `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
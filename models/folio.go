@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// folio line types
+const (
+	FolioRoom       = "room"
+	FolioAdjustment = "adjustment" // discounts and promotions on the stay
+	FolioTax        = "tax"
+	FolioExtra      = "extra"
+	FolioPayment    = "payment"
+	FolioRefund     = "refund"
+)
+
+// FolioCharge is an extra posted to a booking by staff, e.g. minibar or
+// laundry. Amounts are in minor units of the booking's currency; voided charges
+// stay on record but leave the folio.
+type FolioCharge struct {
+	ID          string     `json:"id"          bson:"_id,omitempty"`
+	BookingID   string     `json:"bookingId"   bson:"bookingId"`
+	Category    string     `json:"category"    bson:"category"`
+	Description string     `json:"description" bson:"description"`
+	Quantity    int        `json:"quantity"    bson:"quantity"`
+	UnitAmount  int64      `json:"unitAmount"  bson:"unitAmount"`
+	Currency    string     `json:"currency"    bson:"currency"`
+	PostedBy    string     `json:"postedBy"    bson:"postedBy"`
+	PostedAt    time.Time  `json:"postedAt"    bson:"postedAt"`
+	VoidedBy    string     `json:"voidedBy"    bson:"voidedBy"`
+	VoidedAt    *time.Time `json:"voidedAt"    bson:"voidedAt"`
+}
+
+// FolioLine is one entry of a folio. Charges are positive and payments
+// negative, Balance is what is owed after the line.
+type FolioLine struct {
+	Date        time.Time `json:"date"        bson:"date"`
+	Type        string    `json:"type"        bson:"type"`
+	Description string    `json:"description" bson:"description"`
+	Quantity    int       `json:"quantity"    bson:"quantity"`
+	UnitAmount  int64     `json:"unitAmount"  bson:"unitAmount"`
+	Amount      int64     `json:"amount"      bson:"amount"`
+	Balance     int64     `json:"balance"     bson:"balance"`
+	Reference   string    `json:"reference"   bson:"reference"`
+}
+
+// Folio is the account of a booking: everything charged and paid, in date
+// order. IncludedTaxes are part of the room charges and shown for information.
+type Folio struct {
+	BookingID     string      `json:"bookingId"     bson:"bookingId"`
+	Currency      string      `json:"currency"      bson:"currency"`
+	Lines         []FolioLine `json:"lines"         bson:"lines"`
+	IncludedTaxes []TaxLine   `json:"includedTaxes" bson:"includedTaxes"`
+	Charges       int64       `json:"charges"       bson:"charges"`
+	Paid          int64       `json:"paid"          bson:"paid"`
+	Balance       int64       `json:"balance"       bson:"balance"`
+}
@@ -1,10 +1,54 @@
 package models
 
+import "time"
+
+const (
+	AgeGroupAdult = "adult"
+	AgeGroupChild = "child"
+)
+
+// Guest is a person staying at the hotel. Walk-ins have no account, UserID links
+// the guest to a registered user when there is one.
 type Guest struct {
-	ID        string `json:"id" bson:"_id"`
-	FirstName string `json:"firstName" bson:"firstName"`
-	LastName  string `json:"lastName" bson:"lastName"`
-	Email     string `json:"email" bson:"email"`
-	Phone     string `json:"phone" bson:"phone"`
-	RoomID    string `json:"roomId" bson:"roomId"`
+	ID          string             `json:"id"          bson:"_id,omitempty"`
+	UserID      string             `json:"userId"      bson:"userId,omitempty"`
+	FirstName   string             `json:"firstName"   bson:"firstName"`
+	LastName    string             `json:"lastName"    bson:"lastName"`
+	Email       string             `json:"email"       bson:"email"       encrypt:"lookup"`
+	Phone       string             `json:"phone"       bson:"phone"       encrypt:"lookup"`
+	DateOfBirth string             `json:"dateOfBirth" bson:"dateOfBirth" encrypt:"random"`
+	Documents   []IdentityDocument `json:"documents,omitempty" bson:"documents,omitempty"`
+	CreatedBy   string             `json:"createdBy"   bson:"createdBy"`
+	CreatedAt   time.Time          `json:"createdAt"   bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"   bson:"updatedAt"`
+}
+
+// BookingGuest is a guest staying under a booking.
+type BookingGuest struct {
+	GuestID   string `json:"guestId"   bson:"guestId"   validate:"required"`
+	AgeGroup  string `json:"ageGroup"  bson:"ageGroup"  validate:"required,oneof=adult child"`
+	IsPrimary bool   `json:"isPrimary" bson:"isPrimary"`
+}
+
+const (
+	DocumentPassport        = "passport"
+	DocumentNationalID      = "national_id"
+	DocumentDriversLicense  = "drivers_license"
+	DocumentResidencePermit = "residence_permit"
+)
+
+// IdentityDocument is an ID or passport recorded at check-in. Number is encrypted
+// at rest and the document is purged once PurgeAfter has passed.
+type IdentityDocument struct {
+	ID            string    `json:"id"          bson:"id"`
+	Type          string    `json:"type"        bson:"type"`
+	Number        string    `json:"number"      bson:"number"      encrypt:"random"`
+	Nationality   string    `json:"nationality" bson:"nationality"`
+	ExpiryDate    time.Time `json:"expiryDate"  bson:"expiryDate"`
+	ImageURL      string    `json:"imageUrl"    bson:"imageUrl"`
+	ImagePublicID string    `json:"-"           bson:"imagePublicId"`
+	BookingID     string    `json:"bookingId"   bson:"bookingId"`
+	CapturedBy    string    `json:"capturedBy"  bson:"capturedBy"`
+	CapturedAt    time.Time `json:"capturedAt"  bson:"capturedAt"`
+	PurgeAfter    time.Time `json:"purgeAfter"  bson:"purgeAfter"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyRecord is a request made under an Idempotency-Key and, once
+// handled, the response a retry of it gets back.
+type IdempotencyRecord struct {
+	ID          string    `json:"id"          bson:"_id,omitempty"`
+	Key         string    `json:"key"         bson:"key"`
+	UserID      string    `json:"userId"      bson:"userId"`
+	Fingerprint string    `json:"fingerprint" bson:"fingerprint"`
+	Status      string    `json:"status"      bson:"status"`
+	LeaseID     string    `json:"-"           bson:"leaseId"`     // the attempt holding an in-progress key
+	LockedUntil time.Time `json:"lockedUntil" bson:"lockedUntil"` // when a retry may take an in-progress key over
+	StatusCode  int       `json:"statusCode"  bson:"statusCode"`
+	ContentType string    `json:"contentType" bson:"contentType"`
+	Body        []byte    `json:"-"           bson:"body"`
+	CreatedAt   time.Time `json:"createdAt"   bson:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"   bson:"expiresAt"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// invoice kinds, each numbered in its own yearly sequence
+const (
+	KindInvoice = "invoice"
+	KindReceipt = "receipt"
+)
+
+// Invoice is an invoice or receipt for a booking, or for all bookings of a group
+// when GroupID is set. It keeps the folio as it was
+// when issued, so the document can be reproduced exactly later.
+type Invoice struct {
+	ID        string    `json:"id"        bson:"_id,omitempty"`
+	Number    string    `json:"number"    bson:"number"`
+	Kind      string    `json:"kind"      bson:"kind"`
+	BookingID string    `json:"bookingId" bson:"bookingId"`
+	GroupID   string    `json:"groupId"   bson:"groupId,omitempty"`
+	UserID    string    `json:"userId"    bson:"userId"`
+	BilledTo  string    `json:"billedTo"  bson:"billedTo"`
+	Folio     Folio     `json:"folio"     bson:"folio"`
+	IssuedBy  string    `json:"issuedBy"  bson:"issuedBy"`
+	IssuedAt  time.Time `json:"issuedAt"  bson:"issuedAt"`
+}
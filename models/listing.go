@@ -4,7 +4,8 @@ type Listing struct {
 	ID             string   `json:"id" bson:"_id"`
 	Location       string   `json:"location" bson:"location"`
 	RoomName       string   `json:"roomName" bson:"roomName"`
-	RoomPrice      int64    `json:"roomPrice" bson:"roomPrice"`
+	RoomPrice      int64    `json:"roomPrice" bson:"roomPrice"` // minor units of Currency
+	Currency       string   `json:"currency" bson:"currency"`
 	RoomImage      string   `json:"roomImage" bson:"roomImage"`
 	RoomBedType    string   `json:"roomBedType" bson:"roomBedType"`
 	RoomFacilities []string `json:"roomFacilities" bson:"roomFacilities"`
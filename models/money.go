@@ -0,0 +1,48 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Money is an amount in the minor unit of an ISO 4217 currency, 1050 USD is $10.50.
+type Money struct {
+	Amount   int64  `json:"amount"   bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+// currencies whose minor unit is not a hundredth
+var minorUnitExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// MinorUnitExponent is the number of decimals of a currency, 2 for most.
+func MinorUnitExponent(currency string) int {
+	if exp, ok := minorUnitExponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// ToMajor turns minor units into a decimal amount, 1050 USD gives 10.5.
+func ToMajor(amount int64, currency string) float64 {
+	return float64(amount) / math.Pow10(MinorUnitExponent(currency))
+}
+
+// FromMajor rounds a decimal amount to minor units.
+func FromMajor(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(MinorUnitExponent(currency))))
+}
+
+// ExchangeRate is how many units of Currency one unit of the property's base
+// currency buys.
+type ExchangeRate struct {
+	ID        string    `json:"id"        bson:"_id,omitempty"`
+	Currency  string    `json:"currency"  bson:"currency"`
+	Rate      float64   `json:"rate"      bson:"rate"`
+	Source    string    `json:"source"    bson:"source"` // manual or csv
+	UpdatedBy string    `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
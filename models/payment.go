@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// payment kinds
+const (
+	PaymentDeposit = "deposit" // part of the total, the rest is settled at the hotel
+	PaymentFull    = "full"    // full prepayment
+)
+
+// payment statuses, gateways report the first five
+const (
+	PaymentPending           = "pending"    // waiting for the guest to pay
+	PaymentAuthorized        = "authorized" // funds held, to be captured
+	PaymentSucceeded         = "succeeded"
+	PaymentFailed            = "failed"
+	PaymentCancelled         = "cancelled"
+	PaymentPartiallyRefunded = "partially_refunded"
+	PaymentRefunded          = "refunded"
+)
+
+// Payment is a charge against a booking through a payment gateway. Amounts are
+// in minor units of Amount.Currency; Captured is what was actually taken and
+// Refunded what has been given back of it.
+type Payment struct {
+	ID           string    `json:"id"           bson:"_id,omitempty"`
+	BookingID    string    `json:"bookingId"    bson:"bookingId"`
+	UserID       string    `json:"userId"       bson:"userId"`
+	Provider     string    `json:"provider"     bson:"provider"`
+	ProviderRef  string    `json:"providerRef"  bson:"providerRef"`
+	Kind         string    `json:"kind"         bson:"kind"`
+	Status       string    `json:"status"       bson:"status"`
+	Amount       Money     `json:"amount"       bson:"amount"`
+	Captured     int64     `json:"captured"     bson:"captured"`
+	Refunded     int64     `json:"refunded"     bson:"refunded"`
+	Refunds      []Refund  `json:"refunds"      bson:"refunds"`
+	ClientSecret string    `json:"clientSecret" bson:"clientSecret"`
+	CheckoutURL  string    `json:"checkoutUrl"  bson:"checkoutUrl"`
+	Failure      string    `json:"failure"      bson:"failure"`
+	CreatedAt    time.Time `json:"createdAt"    bson:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"    bson:"updatedAt"`
+}
+
+// Refund is money returned on a payment.
+type Refund struct {
+	ProviderRef string    `json:"providerRef" bson:"providerRef"`
+	Amount      int64     `json:"amount"      bson:"amount"`
+	Status      string    `json:"status"      bson:"status"`
+	Reason      string    `json:"reason"      bson:"reason"`
+	CreatedBy   string    `json:"createdBy"   bson:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"   bson:"createdAt"`
+}
+
+// Balance is what the payment contributes to its booking right now.
+func (p Payment) Balance() int64 {
+	switch p.Status {
+	case PaymentAuthorized:
+		return p.Amount.Amount
+	case PaymentSucceeded, PaymentPartiallyRefunded, PaymentRefunded:
+		return p.Captured - p.Refunded
+	}
+	return 0
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// payment event statuses
+const (
+	EventReceived  = "received"
+	EventProcessed = "processed"
+	EventIgnored   = "ignored" // not about a payment we know, or a type we don't handle
+	EventFailed    = "failed"  // processing failed, the gateway's retry or a replay picks it up
+)
+
+// PaymentEvent is a webhook call from a payment gateway, stored as received so
+// it is processed once and can be replayed. EventID is unique per provider.
+type PaymentEvent struct {
+	ID          string     `json:"id"          bson:"_id,omitempty"`
+	Provider    string     `json:"provider"    bson:"provider"`
+	EventID     string     `json:"eventId"     bson:"eventId"`
+	Type        string     `json:"type"        bson:"type"`
+	PaymentRef  string     `json:"paymentRef"  bson:"paymentRef"`
+	Payload     string     `json:"payload"     bson:"payload"`
+	Status      string     `json:"status"      bson:"status"`
+	Error       string     `json:"error"       bson:"error"`
+	Attempts    int        `json:"attempts"    bson:"attempts"`
+	ReceivedAt  time.Time  `json:"receivedAt"  bson:"receivedAt"`
+	ProcessedAt *time.Time `json:"processedAt" bson:"processedAt"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// kinds of pricing rule
+const (
+	RuleSeason       = "season"         // multiplier for nights within a date range
+	RuleDayOfWeek    = "day_of_week"    // multiplier for nights on given weekdays
+	RuleMinStay      = "min_stay"       // stays must be at least MinNights long
+	RuleLengthOfStay = "length_of_stay" // DiscountPercent off stays of MinNights or more
+	RuleOccupancy    = "occupancy"      // ExtraGuestAmount per night for each guest above BaseGuests
+)
+
+// PricingRule adjusts the base rate of rate plans. Empty RoomCategory and
+// RatePlanID apply the rule to every plan; StartDate and EndDate, when set,
+// limit it to nights (or for min stay, check-ins) in that range inclusive.
+type PricingRule struct {
+	ID               string     `json:"id"               bson:"_id,omitempty"`
+	Name             string     `json:"name"             bson:"name"`
+	Type             string     `json:"type"             bson:"type"`
+	RoomCategory     string     `json:"roomCategory"     bson:"roomCategory"`
+	RatePlanID       string     `json:"ratePlanId"       bson:"ratePlanId"`
+	StartDate        *time.Time `json:"startDate"        bson:"startDate"`
+	EndDate          *time.Time `json:"endDate"          bson:"endDate"`
+	DaysOfWeek       []int      `json:"daysOfWeek"       bson:"daysOfWeek"` // 0 is Sunday
+	Multiplier       float64    `json:"multiplier"       bson:"multiplier"`
+	MinNights        int        `json:"minNights"        bson:"minNights"`
+	DiscountPercent  float64    `json:"discountPercent"  bson:"discountPercent"`
+	BaseGuests       int        `json:"baseGuests"       bson:"baseGuests"`
+	ExtraGuestAmount int64      `json:"extraGuestAmount" bson:"extraGuestAmount"`
+	Priority         int        `json:"priority"         bson:"priority"` // the highest priority season wins
+	Active           bool       `json:"active"           bson:"active"`
+	CreatedAt        time.Time  `json:"createdAt"        bson:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"        bson:"updatedAt"`
+}
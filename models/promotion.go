@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// how a promotion discounts a stay
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+)
+
+// Promotion is a marketing code such as SUMMER20. Zero caps and minimums mean
+// no limit, an empty RoomCategories list allows every category. Fixed
+// discounts are in minor units of Currency.
+type Promotion struct {
+	ID             string     `json:"id"             bson:"_id,omitempty"`
+	Code           string     `json:"code"           bson:"code"`
+	Name           string     `json:"name"           bson:"name"`
+	DiscountType   string     `json:"discountType"   bson:"discountType"`
+	Percent        float64    `json:"percent"        bson:"percent"`
+	Amount         int64      `json:"amount"         bson:"amount"`
+	Currency       string     `json:"currency"       bson:"currency"`
+	StartsAt       *time.Time `json:"startsAt"       bson:"startsAt"`
+	EndsAt         *time.Time `json:"endsAt"         bson:"endsAt"`
+	MaxUses        int        `json:"maxUses"        bson:"maxUses"`
+	MaxUsesPerUser int        `json:"maxUsesPerUser" bson:"maxUsesPerUser"`
+	RoomCategories []string   `json:"roomCategories" bson:"roomCategories"`
+	MinNights      int        `json:"minNights"      bson:"minNights"`
+	Active         bool       `json:"active"         bson:"active"`
+	UsedCount      int        `json:"usedCount"      bson:"usedCount"`
+	CreatedAt      time.Time  `json:"createdAt"      bson:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"      bson:"updatedAt"`
+}
+
+// AppliedPromotion is the promotion a booking was made with.
+type AppliedPromotion struct {
+	PromotionID string `json:"promotionId" bson:"promotionId"`
+	Code        string `json:"code"        bson:"code"`
+	Discount    Money  `json:"discount"    bson:"discount"` // in the charged currency
+}
+
+// PromotionUses counts a user's uses of a promotion, the per user cap is
+// enforced on it atomically. It is unique per promotion and user.
+type PromotionUses struct {
+	PromotionID string `json:"promotionId" bson:"promotionId"`
+	UserID      string `json:"userId"      bson:"userId"`
+	Count       int    `json:"count"       bson:"count"`
+}
+
+// Redemption records one use of a promotion, it backs caps and usage reports.
+type Redemption struct {
+	ID          string    `json:"id"          bson:"_id,omitempty"`
+	PromotionID string    `json:"promotionId" bson:"promotionId"`
+	Code        string    `json:"code"        bson:"code"`
+	UserID      string    `json:"userId"      bson:"userId"`
+	BookingID   string    `json:"bookingId"   bson:"bookingId"`
+	Discount    Money     `json:"discount"    bson:"discount"`
+	RedeemedAt  time.Time `json:"redeemedAt"  bson:"redeemedAt"`
+}
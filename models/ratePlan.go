@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// what a rate plan includes besides the room
+const (
+	BoardRoomOnly  = "room_only"
+	BoardBreakfast = "breakfast"
+)
+
+// RatePlan prices a room category. Amounts are in minor units of Currency
+// (cents, kobo) so they add up without rounding errors.
+type RatePlan struct {
+	ID           string    `json:"id"           bson:"_id,omitempty"`
+	RoomCategory string    `json:"roomCategory" bson:"roomCategory"`
+	Name         string    `json:"name"         bson:"name"`
+	BaseRate     int64     `json:"baseRate"     bson:"baseRate"` // per night
+	Currency     string    `json:"currency"     bson:"currency"` // ISO 4217
+	Board        string    `json:"board"        bson:"board"`
+	Refundable   bool      `json:"refundable"   bson:"refundable"`
+	Active       bool      `json:"active"       bson:"active"`
+	CreatedAt    time.Time `json:"createdAt"    bson:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"    bson:"updatedAt"`
+}
+
+// NightlyRate is the price of one night of a stay, Date is the night's check-in day.
+// Rules names the pricing rules that moved Amount away from BaseAmount.
+type NightlyRate struct {
+	Date       time.Time `json:"date"       bson:"date"`
+	BaseAmount int64     `json:"baseAmount" bson:"baseAmount"`
+	Amount     int64     `json:"amount"     bson:"amount"`
+	Rules      []string  `json:"rules"      bson:"rules"`
+}
+
+// PriceAdjustment is a change to the whole stay, negative for discounts.
+type PriceAdjustment struct {
+	RuleID string `json:"ruleId" bson:"ruleId"`
+	Name   string `json:"name"   bson:"name"`
+	Amount int64  `json:"amount" bson:"amount"`
+}
+
+// PriceQuote is the price of a stay under a rate plan, stored on the booking as
+// it was quoted so later rate changes don't alter what the guest agreed to.
+// Subtotal sums the nights and Total adds the adjustments and the exclusive taxes
+// (TaxTotal) to it, all in Currency, the currency the guest is charged in. Base
+// is Total in the property's base currency and ExchangeRate the units of
+// Currency per unit of the rate plan's currency, the rate the lines were
+// converted at.
+type PriceQuote struct {
+	RatePlanID   string            `json:"ratePlanId"  bson:"ratePlanId"`
+	Currency     string            `json:"currency"    bson:"currency"`
+	Board        string            `json:"board"       bson:"board"`
+	Refundable   bool              `json:"refundable"  bson:"refundable"`
+	Guests       int               `json:"guests"      bson:"guests"`
+	Nights       []NightlyRate     `json:"nights"      bson:"nights"`
+	Subtotal     int64             `json:"subtotal"    bson:"subtotal"`
+	Adjustments  []PriceAdjustment `json:"adjustments" bson:"adjustments"`
+	Taxes        []TaxLine         `json:"taxes"       bson:"taxes"`
+	TaxTotal     int64             `json:"taxTotal"    bson:"taxTotal"`
+	Total        int64             `json:"total"       bson:"total"`
+	Charged      Money             `json:"charged"      bson:"charged"`
+	Base         Money             `json:"base"         bson:"base"`
+	ExchangeRate float64           `json:"exchangeRate" bson:"exchangeRate"`
+	QuotedAt     time.Time         `json:"quotedAt"    bson:"quotedAt"`
+}
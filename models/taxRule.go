@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// what a tax or fee is charged on
+const (
+	TaxPercent        = "percent"          // Rate percent of the accommodation total
+	TaxPerNight       = "per_night"        // Amount for each night
+	TaxPerPersonNight = "per_person_night" // Amount for each guest and night, e.g. city tax
+	TaxPerStay        = "per_stay"         // Amount once per booking
+)
+
+// TaxRule is a tax (VAT, city tax) or fee (service charge) added to stays.
+// Inclusive percentage taxes are already part of the room price and are only
+// broken out, exclusive ones are added on top. Fixed amounts are in minor units
+// of Currency. An empty RoomCategories list applies the rule to every room.
+type TaxRule struct {
+	ID             string    `json:"id"             bson:"_id,omitempty"`
+	Name           string    `json:"name"           bson:"name"`
+	Basis          string    `json:"basis"          bson:"basis"`
+	Rate           float64   `json:"rate"           bson:"rate"`
+	Amount         int64     `json:"amount"         bson:"amount"`
+	Currency       string    `json:"currency"       bson:"currency"`
+	Inclusive      bool      `json:"inclusive"      bson:"inclusive"`
+	RoomCategories []string  `json:"roomCategories" bson:"roomCategories"`
+	Active         bool      `json:"active"         bson:"active"`
+	CreatedAt      time.Time `json:"createdAt"      bson:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"      bson:"updatedAt"`
+}
+
+// TaxLine is a tax or fee as charged on a quote, kept on the booking so old
+// totals stay correct after rules change.
+type TaxLine struct {
+	TaxRuleID string  `json:"taxRuleId" bson:"taxRuleId"`
+	Name      string  `json:"name"      bson:"name"`
+	Basis     string  `json:"basis"     bson:"basis"`
+	Rate      float64 `json:"rate"      bson:"rate"`
+	Inclusive bool    `json:"inclusive" bson:"inclusive"`
+	Amount    int64   `json:"amount"    bson:"amount"`
+}
@@ -1,15 +1,25 @@
 package models
 
+// roles stored on User.Role; admins also carry IsAdmin
+const (
+	RoleGuest = "GUEST"
+	RoleStaff = "STAFF" // front desk
+	RoleAdmin = "ADMIN"
+)
+
+// User holds personal data encrypted at rest, fields tagged `encrypt` are sealed
+// with utils.SealFields before they are written and opened after they are read.
 type User struct {
 	ID          string `json:"id"          bson:"_id"`
-	Email       string `json:"email"       bson:"email"`
+	Email       string `json:"email"       bson:"email"       encrypt:"lookup"`
 	Password    string `json:"password"    bson:"password"`
 	Role        string `json:"role"        bson:"role"`
 	FirstName   string `json:"firstName"   bson:"firstName"`
 	LastName    string `json:"lastName"    bson:"lastName"`
-	PhoneNumber int64  `json:"phoneNumber" bson:"phoneNumber"`
-	Location    string `json:"location"    bson:"location"`
-	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth"`
+	PhoneNumber string `json:"phoneNumber" bson:"phoneNumber" encrypt:"lookup"` // a JSON number before it was encrypted, now a string
+	Location    string `json:"location"    bson:"location"    encrypt:"random"`
+	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth" encrypt:"random"`
+	Locale      string `json:"locale"      bson:"locale"` // BCP 47 tag emails are written in, e.g. fr or fr-CA
 	IsVerified  bool   `json:"isVerified"  bson:"isVerified"`
 	IsAdmin     bool   `json:"isAdmin"     bson:"isAdmin"`
 }
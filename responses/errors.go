@@ -0,0 +1,184 @@
+package responses
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+)
+
+// machine-readable error codes returned in the "error.code" field
+const (
+	CodeBadRequest   = "BAD_REQUEST"
+	CodeValidation   = "VALIDATION_FAILED"
+	CodeUnauthorized = "UNAUTHORIZED"
+	CodeForbidden    = "FORBIDDEN"
+	CodeNotFound     = "NOT_FOUND"
+	CodeConflict     = "CONFLICT"
+	CodeUpstream     = "UPSTREAM_ERROR"
+	CodeInternal     = "INTERNAL_ERROR"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type ErrorBody struct {
+	Code   string       `json:"code"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// AppError is an error that knows how it should be rendered to the client.
+// Handlers return it and ErrorHandler turns it into an APIResponse.
+type AppError struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+func NewError(status int, code, message string) *AppError {
+	return &AppError{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *AppError {
+	return NewError(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+func Unauthorized(message string) *AppError {
+	return NewError(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *AppError {
+	return NewError(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *AppError {
+	return NewError(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *AppError {
+	return NewError(http.StatusConflict, CodeConflict, message)
+}
+
+// Upstream reports a failure of an external service (mail, media, payments).
+func Upstream(message string, err error) *AppError {
+	return &AppError{Status: http.StatusBadGateway, Code: CodeUpstream, Message: message, Err: err}
+}
+
+// Internal hides err from the client; it is only logged by ErrorHandler.
+func Internal(err error) *AppError {
+	return &AppError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error", Err: err}
+}
+
+// Validation collects every failed field of a validator error into one response.
+func Validation(err error) *AppError {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return &AppError{Status: http.StatusBadRequest, Code: CodeValidation, Message: "Invalid request", Err: err}
+	}
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, FieldError{Field: fe.Field(), Rule: fe.Tag(), Message: fieldMessage(fe)})
+	}
+	return &AppError{Status: http.StatusBadRequest, Code: CodeValidation, Message: "Invalid request", Fields: fields}
+}
+
+// FromDB maps driver errors to application errors, entity names the missing document.
+// Application errors, e.g. returned from inside a transaction, pass through.
+func FromDB(err error, entity string) *AppError {
+	var appErr *AppError
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return NotFound(entity + " not found")
+	case mongo.IsDuplicateKeyError(err):
+		return Conflict(entity + " already exists")
+	default:
+		return Internal(err)
+	}
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fe.Field() + " is required"
+	case "email":
+		return fe.Field() + " must be a valid email"
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s]", fe.Field(), fe.Param())
+	case "min", "gte":
+		return fmt.Sprintf("%s must be at least %s", fe.Field(), fe.Param())
+	case "max", "lte":
+		return fmt.Sprintf("%s must be at most %s", fe.Field(), fe.Param())
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", fe.Field(), fe.Param())
+	case "gtfield":
+		return fmt.Sprintf("%s must be after %s", fe.Field(), fe.Param())
+	default:
+		return fe.Field() + " is invalid"
+	}
+}
+
+// ErrorHandler is the app wide fiber error handler.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var appErr *AppError
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &appErr):
+	case errors.As(err, &fiberErr):
+		appErr = NewError(fiberErr.Code, codeForStatus(fiberErr.Code), fiberErr.Message)
+	default:
+		appErr = Internal(err)
+	}
+
+	if appErr.Status >= http.StatusInternalServerError {
+		common.Logger(c.UserContext()).Error("request failed",
+			"method", c.Method(), "path", c.Path(), "status", appErr.Status, "error", appErr)
+	}
+
+	return c.Status(appErr.Status).JSON(APIResponse{
+		Status:  appErr.Status,
+		Message: appErr.Message,
+		Error:   &ErrorBody{Code: appErr.Code, Fields: appErr.Fields},
+	})
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
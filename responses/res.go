@@ -6,4 +6,5 @@ type APIResponse struct {
 	Status  int        `json:"status"`
 	Message string     `json:"message"`
 	Data    *fiber.Map `json:"data"`
+	Error   *ErrorBody `json:"error,omitempty"`
 }
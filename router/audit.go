@@ -0,0 +1,11 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func AuditRoutes(app *fiber.App) {
+	auditGroup := app.Group("/audit")
+	auditGroup.Get("/", handlers.GetAuditLogs)
+}
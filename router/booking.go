@@ -2,13 +2,28 @@ package router
 
 import (
 	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/chiboycalix/hotel-booking-system-backend/middleware"
 	"github.com/gofiber/fiber/v2"
 )
 
 func BookingsRoutes(app *fiber.App) {
 	bookingGroup := app.Group("/bookings")
-	bookingGroup.Post("/", handlers.CreateBooking)
+	bookingGroup.Post("/", middleware.Idempotency(), handlers.CreateBooking)
 	bookingGroup.Get("/", handlers.GetAllBookings)
+	bookingGroup.Get("/me", handlers.GetMyBookings)
+	bookingGroup.Get("/:id", handlers.GetBooking)
 	bookingGroup.Put("/:id", handlers.UpdateBooking)
+	bookingGroup.Put("/:id/guests", handlers.UpdateBookingGuests)
+	bookingGroup.Post("/:id/confirm", handlers.ConfirmBooking)
+	bookingGroup.Post("/:id/cancel", handlers.CancelBooking)
+	bookingGroup.Post("/:id/check-in", handlers.CheckInBooking)
+	bookingGroup.Post("/:id/check-out", handlers.CheckOutBooking)
+	bookingGroup.Post("/:id/payments", middleware.Idempotency(), handlers.CreateBookingPayment)
+	bookingGroup.Get("/:id/payments", handlers.GetBookingPayments)
+	bookingGroup.Get("/:id/folio", handlers.GetFolio)
+	bookingGroup.Post("/:id/folio/charges", handlers.PostFolioCharge)
+	bookingGroup.Delete("/:id/folio/charges/:chargeId", handlers.VoidFolioCharge)
+	bookingGroup.Post("/:id/invoices", handlers.IssueInvoice)
+	bookingGroup.Get("/:id/invoices", handlers.GetBookingInvoices)
 	bookingGroup.Delete("/:id", handlers.DeleteBooking)
 }
@@ -0,0 +1,16 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/chiboycalix/hotel-booking-system-backend/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func BookingGroupRoutes(app *fiber.App) {
+	groupRoutes := app.Group("/booking-groups")
+	groupRoutes.Post("/", middleware.Idempotency(), handlers.CreateBookingGroup)
+	groupRoutes.Get("/:id", handlers.GetBookingGroup)
+	groupRoutes.Post("/:id/cancel", handlers.CancelBookingGroup)
+	groupRoutes.Post("/:id/invoices", handlers.IssueGroupInvoice)
+	groupRoutes.Get("/:id/invoices", handlers.GetGroupInvoices)
+}
@@ -0,0 +1,13 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func EmailTemplateRoutes(app *fiber.App) {
+	emailTemplateGroup := app.Group("/email-templates")
+	emailTemplateGroup.Get("/", handlers.GetEmailTemplates)
+	emailTemplateGroup.Put("/:name", handlers.SaveEmailTemplate)
+	emailTemplateGroup.Delete("/:name", handlers.DeleteEmailTemplate)
+}
@@ -0,0 +1,14 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func ExchangeRateRoutes(app *fiber.App) {
+	exchangeRateGroup := app.Group("/exchange-rates")
+	exchangeRateGroup.Get("/", handlers.GetExchangeRates)
+	exchangeRateGroup.Post("/import", handlers.ImportExchangeRates)
+	exchangeRateGroup.Put("/:currency", handlers.SetExchangeRate)
+	exchangeRateGroup.Delete("/:currency", handlers.DeleteExchangeRate)
+}
@@ -1 +1,18 @@
 package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func GuestRoutes(app *fiber.App) {
+	guestGroup := app.Group("/guests")
+	guestGroup.Post("/", handlers.CreateGuest)
+	guestGroup.Get("/", handlers.SearchGuests)
+	guestGroup.Get("/:id", handlers.GetGuest)
+	guestGroup.Put("/:id", handlers.UpdateGuest)
+	guestGroup.Put("/:id/link", handlers.LinkGuest)
+	guestGroup.Post("/:id/documents", handlers.CaptureIdentityDocument)
+	guestGroup.Get("/:id/documents", handlers.GetIdentityDocuments)
+	guestGroup.Delete("/:id", handlers.DeleteGuest)
+}
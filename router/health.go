@@ -0,0 +1,11 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func HealthRoutes(app *fiber.App) {
+	app.Get("/healthz", handlers.Healthz)
+	app.Get("/readyz", handlers.Readyz)
+}
@@ -0,0 +1,12 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func InvoiceRoutes(app *fiber.App) {
+	invoiceGroup := app.Group("/invoices")
+	invoiceGroup.Get("/:id/pdf", handlers.DownloadInvoice)
+	invoiceGroup.Post("/:id/email", handlers.EmailInvoice)
+}
@@ -0,0 +1,12 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func OutboxRoutes(app *fiber.App) {
+	outboxGroup := app.Group("/outbox")
+	outboxGroup.Get("/", handlers.GetOutboxMessages)
+	outboxGroup.Post("/:id/retry", handlers.RetryOutboxMessage)
+}
@@ -0,0 +1,15 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/chiboycalix/hotel-booking-system-backend/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func PaymentRoutes(app *fiber.App) {
+	paymentGroup := app.Group("/payments")
+	paymentGroup.Get("/", handlers.GetPayments)
+	paymentGroup.Post("/:id/confirm", middleware.Idempotency(), handlers.ConfirmPayment)
+	paymentGroup.Post("/:id/capture", middleware.Idempotency(), handlers.CapturePayment)
+	paymentGroup.Post("/:id/refund", middleware.Idempotency(), handlers.RefundPayment)
+}
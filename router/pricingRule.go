@@ -0,0 +1,14 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func PricingRuleRoutes(app *fiber.App) {
+	pricingRuleGroup := app.Group("/pricing-rules")
+	pricingRuleGroup.Post("/", handlers.CreatePricingRule)
+	pricingRuleGroup.Get("/", handlers.GetPricingRules)
+	pricingRuleGroup.Put("/:id", handlers.UpdatePricingRule)
+	pricingRuleGroup.Delete("/:id", handlers.DeletePricingRule)
+}
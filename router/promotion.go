@@ -0,0 +1,16 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func PromotionRoutes(app *fiber.App) {
+	promotionGroup := app.Group("/promotions")
+	promotionGroup.Post("/", handlers.CreatePromotion)
+	promotionGroup.Get("/", handlers.GetPromotions)
+	promotionGroup.Get("/:id", handlers.GetPromotion)
+	promotionGroup.Get("/:id/usage", handlers.GetPromotionUsage)
+	promotionGroup.Put("/:id", handlers.UpdatePromotion)
+	promotionGroup.Delete("/:id", handlers.DeletePromotion)
+}
@@ -0,0 +1,15 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func RatePlanRoutes(app *fiber.App) {
+	ratePlanGroup := app.Group("/rate-plans")
+	ratePlanGroup.Post("/", handlers.CreateRatePlan)
+	ratePlanGroup.Get("/", handlers.GetRatePlans)
+	ratePlanGroup.Get("/:id", handlers.GetRatePlan)
+	ratePlanGroup.Put("/:id", handlers.UpdateRatePlan)
+	ratePlanGroup.Delete("/:id", handlers.DeleteRatePlan)
+}
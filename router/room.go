@@ -10,6 +10,7 @@ func RoomRoutes(app *fiber.App) {
 	listingGroup.Post("/", handlers.CreateRoom)
 	listingGroup.Get("/", handlers.GetAllRooms)
 	listingGroup.Get("/:id", handlers.GetRoom)
+	listingGroup.Get("/:id/quote", handlers.GetRoomQuote)
 	listingGroup.Put("/:id", handlers.UpdateRoom)
 	listingGroup.Delete("/:id", handlers.DeleteRoom)
 }
@@ -0,0 +1,14 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TaxRuleRoutes(app *fiber.App) {
+	taxRuleGroup := app.Group("/tax-rules")
+	taxRuleGroup.Post("/", handlers.CreateTaxRule)
+	taxRuleGroup.Get("/", handlers.GetTaxRules)
+	taxRuleGroup.Put("/:id", handlers.UpdateTaxRule)
+	taxRuleGroup.Delete("/:id", handlers.DeleteTaxRule)
+}
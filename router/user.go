@@ -10,5 +10,6 @@ func UserRoute(app *fiber.App) {
 	userGroup.Get("/", handlers.GetAllUsers)
 	userGroup.Get("/:id", handlers.GetUser)
 	userGroup.Put("/:id", handlers.UpdateUser)
+	userGroup.Put("/:id/role", handlers.UpdateUserRole)
 	userGroup.Delete("/:id", handlers.DeleteUser)
 }
@@ -0,0 +1,13 @@
+package router
+
+import (
+	"github.com/chiboycalix/hotel-booking-system-backend/handlers"
+	"github.com/gofiber/fiber/v2"
+)
+
+// WebhookRoutes are called by third parties, they authenticate with signatures
+// instead of tokens.
+func WebhookRoutes(app *fiber.App) {
+	webhookGroup := app.Group("/webhooks")
+	webhookGroup.Post("/payments/:provider", handlers.PaymentWebhook)
+}
@@ -0,0 +1,13 @@
+// Package templates holds the email templates, embedded in the binary so it
+// does not depend on the directory it is started from.
+//
+// Each email is name.html with a plain-text name.txt alongside it, and
+// name.<locale>.html and name.<locale>.txt for other languages, e.g.
+// forget-password.fr.html. A .txt may define a "subject" template to give a
+// language its own subject line.
+package templates
+
+import "embed"
+
+//go:embed *.html *.txt
+var FS embed.FS
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+)
+
+const AUDIT_MODEL = "audit_logs"
+
+const auditLocalsKey = "audit"
+
+// redactedFields never have their values copied into the audit trail.
+var redactedFields = map[string]bool{"password": true}
+
+// AuditRecord is what a handler knows about its change; the audit middleware
+// completes it with actor, request and status details.
+type AuditRecord struct {
+	Action   string
+	Entity   string
+	EntityID string
+	Before   interface{}
+	After    interface{}
+}
+
+// Audit attaches the entity touched by the current request and its state before
+// and after the change. Pass nil for before on creates and for after on deletes.
+// A request that changes several entities calls it once for each, every call
+// gets its own entry.
+func Audit(c *fiber.Ctx, entity, entityID string, before, after interface{}) {
+	addAuditRecord(c, &AuditRecord{Entity: entity, EntityID: entityID, Before: before, After: after})
+}
+
+// AuditAction is Audit with an explicit action, for changes that are not plain CRUD.
+func AuditAction(c *fiber.Ctx, action, entity, entityID string, before, after interface{}) {
+	addAuditRecord(c, &AuditRecord{Action: action, Entity: entity, EntityID: entityID, Before: before, After: after})
+}
+
+func addAuditRecord(c *fiber.Ctx, record *AuditRecord) {
+	c.Locals(auditLocalsKey, append(AuditRecords(c), record))
+}
+
+// AuditRecords returns what the current request's handler audited, in order.
+func AuditRecords(c *fiber.Ctx) []*AuditRecord {
+	records, _ := c.Locals(auditLocalsKey).([]*AuditRecord)
+	return records
+}
+
+// WriteAudit appends an entry to the audit trail, entries are never updated or removed.
+func WriteAudit(ctx context.Context, entry models.AuditEntry) error {
+	_, err := common.GetDBCollection(AUDIT_MODEL).InsertOne(ctx, entry)
+	return err
+}
+
+// DiffDocuments compares the bson form of before and after and returns the changed fields.
+// Encrypted fields are compared and recorded by their lookup value, never in plaintext.
+func DiffDocuments(before, after interface{}) ([]models.AuditChange, error) {
+	b, err := toDocument(maskSealed(before))
+	if err != nil {
+		return nil, err
+	}
+	a, err := toDocument(maskSealed(after))
+	if err != nil {
+		return nil, err
+	}
+
+	// updates are partial ($set), so only the fields written count as changed;
+	// creates and deletes report every field of the side that exists
+	source := a
+	if len(a) == 0 {
+		source = b
+	}
+	fields := make([]string, 0, len(source))
+	for k := range source {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	changes := make([]models.AuditChange, 0)
+	for _, field := range fields {
+		if field == "_id" || reflect.DeepEqual(b[field], a[field]) {
+			continue
+		}
+		change := models.AuditChange{Field: field, Before: b[field], After: a[field]}
+		if redactedFields[strings.ToLower(field)] {
+			change.Before, change.After = "[redacted]", "[redacted]"
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func toDocument(v interface{}) (bson.M, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return bson.M{}, nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	err = bson.Unmarshal(raw, &doc)
+	return doc, err
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+
+	brevo "github.com/getbrevo/brevo-go/lib"
+)
+
+// BrevoMailer sends through Brevo's transactional email API.
+type BrevoMailer struct {
+	client *brevo.APIClient
+}
+
+func NewBrevoMailer(apiKey string) *BrevoMailer {
+	cfg := brevo.NewConfiguration()
+	cfg.AddDefaultHeader("api-key", apiKey)
+	return &BrevoMailer{client: brevo.NewAPIClient(cfg)}
+}
+
+func (*BrevoMailer) Name() string { return "brevo" }
+
+func (b *BrevoMailer) Send(ctx context.Context, msg Message) error {
+	email := brevo.SendSmtpEmail{
+		Sender:      &brevo.SendSmtpEmailSender{Name: msg.From.Name, Email: msg.From.Email},
+		HtmlContent: msg.HTML,
+		TextContent: msg.Text,
+		Subject:     msg.Subject,
+	}
+	for _, to := range msg.To {
+		email.To = append(email.To, brevo.SendSmtpEmailTo{Name: to.Name, Email: to.Email})
+	}
+	for _, a := range msg.Attachments {
+		email.Attachment = append(email.Attachment, brevo.SendSmtpEmailAttachment{
+			Name:    a.Name,
+			Content: base64.StdEncoding.EncodeToString(a.Content),
+		})
+	}
+	_, _, err := b.client.TransactionalEmailsApi.SendTransacEmail(ctx, email)
+	return err
+}
@@ -4,60 +4,102 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"html/template"
-	"log"
+	"strings"
 
-	brevo "github.com/getbrevo/brevo-go/lib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/chiboycalix/hotel-booking-system-backend/common"
 	"github.com/chiboycalix/hotel-booking-system-backend/models"
 )
 
-type forgetPassword struct {
-	ID          string `json:"id"          bson:"_id"`
-	Email       string `json:"email"       bson:"email"`
-	FirstName   string `json:"firstName"   bson:"firstName"`
-	LastName    string `json:"lastName"    bson:"lastName"`
-	FrontendUrl string `json:"frontendUrl" bson:"frontendUrl"`
+// Recipient is an address an email goes to.
+type Recipient struct {
+	Name  string `json:"name"  bson:"name"`
+	Email string `json:"email" bson:"email"`
 }
 
-func SendMailService(user models.User, templatePath string, subject string) error {
+// UserRecipient addresses an email to a user under their full name.
+func UserRecipient(user models.User) Recipient {
+	return Recipient{Name: strings.TrimSpace(user.FirstName + " " + user.LastName), Email: user.Email}
+}
+
+// Attachment is a file sent along with an email.
+type Attachment struct {
+	Name    string `json:"name" bson:"name"`
+	Content []byte `json:"-"    bson:"content"`
+}
+
+// Email is a message rendered from a template with Data.
+type Email struct {
+	To          []Recipient
+	Subject     string // used when the template has no subject for Locale
+	Template    string // name of the template, e.g. booking-confirmed
+	Locale      string // language of the recipient, e.g. fr-CA, the default when empty
+	Data        interface{}
+	Attachments []Attachment
+}
+
+// RenderEmail renders an email's template in the recipient's language into a
+// message from the service's sender, with a plain-text alternative when the
+// template has one.
+func RenderEmail(ctx context.Context, mail Email) (Message, error) {
+	t, err := resolveEmailTemplate(ctx, mail.Template, mail.Locale)
+	if err != nil {
+		return Message{}, err
+	}
+	msg := Message{
+		Template:    mail.Template,
+		From:        Recipient{Name: "Hotel Booking System", Email: common.SenderEmail()},
+		To:          mail.To,
+		Subject:     mail.Subject,
+		Attachments: mail.Attachments,
+	}
 	var body bytes.Buffer
-	t, err := template.ParseFiles(templatePath)
+	if err := t.html.Execute(&body, mail.Data); err != nil {
+		return Message{}, fmt.Errorf("rendering template %s: %w", mail.Template, err)
+	}
+	msg.HTML = body.String()
+	if t.text != nil {
+		if msg.Text, err = executeText(t.text, mail.Data); err != nil {
+			return Message{}, fmt.Errorf("rendering template %s text: %w", mail.Template, err)
+		}
+	}
+	if t.subject != nil {
+		if msg.Subject, err = executeText(t.subject, mail.Data); err != nil {
+			return Message{}, fmt.Errorf("rendering template %s subject: %w", mail.Template, err)
+		}
+	}
+	return msg, nil
+}
+
+// SendMessage sends a rendered message through the active mailer. Handlers queue
+// email with EnqueueEmail instead, the outbox workers send it.
+func SendMessage(ctx context.Context, msg Message) (err error) {
+	ctx, span := common.Tracer.Start(ctx, "mail.Send", trace.WithAttributes(
+		attribute.String("email.template", msg.Template),
+		attribute.String("email.transport", common.MailTransport()),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		common.EmailsSent.WithLabelValues(msg.Template, common.ResultLabel(err)).Inc()
+	}()
+
+	transport, err := ActiveMailer()
 	if err != nil {
-		log.Fatal("error parsing template")
 		return err
 	}
-	t.Execute(
-		&body,
-		forgetPassword{
-			ID:          user.ID,
-			Email:       user.Email,
-			FirstName:   user.FirstName,
-			LastName:    user.LastName,
-			FrontendUrl: common.FrontendUrl(),
-		},
-	)
-
-	var ctx context.Context
-	cfg := brevo.NewConfiguration()
-	cfg.AddDefaultHeader("api-key", common.BrevoAPIKey())
-	br := brevo.NewAPIClient(cfg)
-	_, _, err = br.TransactionalEmailsApi.SendTransacEmail(ctx, brevo.SendSmtpEmail{
-		Sender: &brevo.SendSmtpEmailSender{
-			Name:  "Hotel Booking System",
-			Email: common.SenderEmail(),
-		},
-		To: []brevo.SendSmtpEmailTo{
-			{Name: "chi", Email: user.Email},
-		},
-		HtmlContent: body.String(),
-		Subject:     subject,
-	})
+	err = transport.Send(ctx, msg)
+	logger := common.Logger(ctx).With("template", msg.Template, "transport", transport.Name())
 	if err != nil {
-		fmt.Println("Error ", err)
+		logger.Error("email not sent", "error", err)
 		return err
 	}
-	fmt.Println("Email sent successfully")
+	logger.Info("email sent")
 	return nil
 }
@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+)
+
+// sealed values look like "<prefix>:<key id>:<base64 nonce+ciphertext>"
+const (
+	randomPrefix = "enc"
+	lookupPrefix = "lkp"
+	legacyKeyID  = "v1"
+)
+
+var errNoEncryptionKey = errors.New("DATA_ENCRYPTION_KEYS (or DATA_ENCRYPTION_KEY) must hold base64 encoded 32 byte keys")
+
+type dataKey struct {
+	id        string
+	random    cipher.AEAD
+	lookup    cipher.AEAD
+	nonceHMAC []byte
+}
+
+type keyring struct {
+	active *dataKey
+	byID   map[string]*dataKey
+}
+
+var (
+	keysOnce sync.Once
+	keys     *keyring
+	keysErr  error
+)
+
+// LoadDataKeys parses the configured encryption keys, main calls it at start up
+// so a bad key fails fast instead of on the first write.
+func LoadDataKeys() error {
+	keysOnce.Do(func() {
+		keys, keysErr = parseKeyring(common.DataEncryptionKeys(), common.DataEncryptionKey())
+	})
+	return keysErr
+}
+
+func parseKeyring(list, legacy string) (*keyring, error) {
+	ring := &keyring{byID: map[string]*dataKey{}}
+	add := func(id, encoded string) error {
+		if id == "" || strings.ContainsAny(id, ":,") {
+			return fmt.Errorf("invalid encryption key id %q", id)
+		}
+		if _, ok := ring.byID[id]; ok {
+			return fmt.Errorf("encryption key id %q is listed twice", id)
+		}
+		key, err := newDataKey(id, encoded)
+		if err != nil {
+			return err
+		}
+		ring.byID[id] = key
+		if ring.active == nil {
+			ring.active = key
+		}
+		return nil
+	}
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("encryption key %q must be written as id:base64key", entry)
+		}
+		if err := add(strings.TrimSpace(id), strings.TrimSpace(encoded)); err != nil {
+			return nil, err
+		}
+	}
+	if legacy != "" && ring.byID[legacyKeyID] == nil {
+		if err := add(legacyKeyID, legacy); err != nil {
+			return nil, err
+		}
+	}
+	if ring.active == nil {
+		return nil, errNoEncryptionKey
+	}
+	return ring, nil
+}
+
+// newDataKey derives a separate key for deterministic encryption and for its
+// synthetic nonces so the three uses never share key material.
+func newDataKey(id, encoded string) (*dataKey, error) {
+	master, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(master) != 32 {
+		return nil, fmt.Errorf("encryption key %q: %w", id, errNoEncryptionKey)
+	}
+	random, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	lookup, err := newGCM(deriveKey(master, "lookup-encryption"))
+	if err != nil {
+		return nil, err
+	}
+	return &dataKey{id: id, random: random, lookup: lookup, nonceHMAC: deriveKey(master, "lookup-nonce")}, nil
+}
+
+func deriveKey(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func loadedKeys() (*keyring, error) {
+	if err := LoadDataKeys(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// EncryptString seals plaintext with AES-256-GCM and a random nonce under the
+// active key. The empty string stays empty so optional fields remain optional.
+func EncryptString(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	ring, err := loadedKeys()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, ring.active.random.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return seal(randomPrefix, ring.active.id, ring.active.random, nonce, plaintext), nil
+}
+
+// EncryptLookup seals plaintext deterministically: under one key the same
+// plaintext always gives the same value, so it can be matched in queries.
+func EncryptLookup(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	ring, err := loadedKeys()
+	if err != nil {
+		return "", err
+	}
+	return encryptLookup(ring.active, plaintext), nil
+}
+
+func encryptLookup(key *dataKey, plaintext string) string {
+	mac := hmac.New(sha256.New, key.nonceHMAC)
+	mac.Write([]byte(plaintext))
+	nonce := mac.Sum(nil)[:key.lookup.NonceSize()]
+	return seal(lookupPrefix, key.id, key.lookup, nonce, plaintext)
+}
+
+func seal(prefix, keyID string, aead cipher.AEAD, nonce []byte, plaintext string) string {
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + ":" + keyID + ":" + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// DecryptString opens a value sealed by EncryptString or EncryptLookup under any
+// known key. Values that were never sealed, written before a field was encrypted,
+// are returned unchanged.
+func DecryptString(value string) (string, error) {
+	prefix, keyID, payload, ok := splitSealed(value)
+	if !ok {
+		return value, nil
+	}
+	ring, err := loadedKeys()
+	if err != nil {
+		return "", err
+	}
+	key := ring.byID[keyID]
+	if key == nil {
+		return "", fmt.Errorf("unknown encryption key %q", keyID)
+	}
+	aead := key.random
+	if prefix == lookupPrefix {
+		aead = key.lookup
+	}
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < aead.NonceSize() {
+		return "", errors.New("encrypted value is truncated")
+	}
+	plaintext, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// LookupValues returns every stored form plaintext may have: its lookup value
+// under each known key, so rows not yet re-encrypted after a rotation still
+// match, and the plaintext itself for rows written before encryption.
+func LookupValues(plaintext string) ([]string, error) {
+	ring, err := loadedKeys()
+	if err != nil {
+		return nil, err
+	}
+	values := []string{plaintext}
+	if plaintext == "" {
+		return values, nil
+	}
+	for _, key := range ring.byID {
+		values = append(values, encryptLookup(key, plaintext))
+	}
+	return values, nil
+}
+
+// ResealValue re-encrypts value under the active key in the given mode, it
+// reports false when the value is already sealed that way.
+func ResealValue(mode, value string) (string, bool, error) {
+	if value == "" {
+		return value, false, nil
+	}
+	ring, err := loadedKeys()
+	if err != nil {
+		return "", false, err
+	}
+	prefix, keyID, _, ok := splitSealed(value)
+	if ok && keyID == ring.active.id && prefix == prefixForMode(mode) {
+		return value, false, nil
+	}
+	plaintext, err := DecryptString(value)
+	if err != nil {
+		return "", false, err
+	}
+	sealed, err := sealMode(mode, plaintext)
+	if err != nil {
+		return "", false, err
+	}
+	return sealed, true, nil
+}
+
+func sealMode(mode, plaintext string) (string, error) {
+	if mode == EncryptModeLookup {
+		return EncryptLookup(plaintext)
+	}
+	return EncryptString(plaintext)
+}
+
+func prefixForMode(mode string) string {
+	if mode == EncryptModeLookup {
+		return lookupPrefix
+	}
+	return randomPrefix
+}
+
+func splitSealed(value string) (prefix, keyID, payload string, ok bool) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || (parts[0] != randomPrefix && parts[0] != lookupPrefix) {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
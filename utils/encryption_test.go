@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+// useKeys loads the keys in list, written like DATA_ENCRYPTION_KEYS, for the rest of the test.
+func useKeys(t *testing.T, list string) {
+	t.Helper()
+	ring, err := parseKeyring(list, "")
+	if err != nil {
+		t.Fatalf("parseKeyring(%q): %v", list, err)
+	}
+	keysOnce.Do(func() {})
+	prevKeys, prevErr := keys, keysErr
+	keys, keysErr = ring, nil
+	t.Cleanup(func() { keys, keysErr = prevKeys, prevErr })
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	useKeys(t, "k1:"+testKey(1))
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"empty", ""},
+		{"ascii", "guest@example.com"},
+		{"unicode", "Chídí Ọ̀kàfọ̀"},
+		{"looks sealed", "enc:k1:abc"},
+	}
+	for _, tt := range tests {
+		for mode, encrypt := range map[string]func(string) (string, error){"random": EncryptString, "lookup": EncryptLookup} {
+			t.Run(tt.name+"/"+mode, func(t *testing.T) {
+				sealed, err := encrypt(tt.plaintext)
+				if err != nil {
+					t.Fatalf("encrypt: %v", err)
+				}
+				if tt.plaintext != "" && sealed == tt.plaintext {
+					t.Fatalf("value was not sealed")
+				}
+				opened, err := DecryptString(sealed)
+				if err != nil {
+					t.Fatalf("DecryptString: %v", err)
+				}
+				if opened != tt.plaintext {
+					t.Fatalf("DecryptString = %q, want %q", opened, tt.plaintext)
+				}
+			})
+		}
+	}
+}
+
+func TestEncryptStringUsesFreshNonces(t *testing.T) {
+	useKeys(t, "k1:"+testKey(1))
+	first, err := EncryptString("+2348012345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := EncryptString("+2348012345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("EncryptString gave %q twice", first)
+	}
+}
+
+func TestEncryptLookupIsStable(t *testing.T) {
+	tests := []struct {
+		name  string
+		keys  [2]string
+		a, b  string
+		equal bool
+	}{
+		{"same key same value", [2]string{"k1:" + testKey(1), "k1:" + testKey(1)}, "+2348012345678", "+2348012345678", true},
+		{"same key other value", [2]string{"k1:" + testKey(1), "k1:" + testKey(1)}, "+2348012345678", "+2348012345679", false},
+		{"other key same value", [2]string{"k1:" + testKey(1), "k1:" + testKey(2)}, "+2348012345678", "+2348012345678", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useKeys(t, tt.keys[0])
+			a, err := EncryptLookup(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			useKeys(t, tt.keys[1])
+			b, err := EncryptLookup(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (a == b) != tt.equal {
+				t.Fatalf("EncryptLookup(%q) = %q, EncryptLookup(%q) = %q, want equal %v", tt.a, a, tt.b, b, tt.equal)
+			}
+			if !strings.HasPrefix(a, lookupPrefix+":k1:") {
+				t.Fatalf("EncryptLookup = %q, want the %s prefix and key id", a, lookupPrefix)
+			}
+		})
+	}
+}
+
+func TestLookupValuesMatchEveryKey(t *testing.T) {
+	useKeys(t, "k2:"+testKey(2))
+	current, err := EncryptLookup("+2348012345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useKeys(t, "k1:"+testKey(1))
+	old, err := EncryptLookup("+2348012345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	useKeys(t, "k2:"+testKey(2)+",k1:"+testKey(1))
+	values, err := LookupValues("+2348012345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"+2348012345678", current, old} {
+		found := false
+		for _, v := range values {
+			found = found || v == want
+		}
+		if !found {
+			t.Errorf("LookupValues = %q, missing %q", values, want)
+		}
+	}
+}
+
+func TestDecryptStringFailures(t *testing.T) {
+	useKeys(t, "k1:"+testKey(1))
+	random, err := EncryptString("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup, err := EncryptLookup("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, payload, _ := splitSealed(random)
+	raw, _ := base64.StdEncoding.DecodeString(payload)
+	raw[len(raw)-1] ^= 1
+	tampered := "enc:k1:" + base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name  string
+		keys  string
+		value string
+	}{
+		{"wrong key, random", "k1:" + testKey(2), random},
+		{"wrong key, lookup", "k1:" + testKey(2), lookup},
+		{"unknown key id", "k2:" + testKey(1), random},
+		{"tampered ciphertext", "k1:" + testKey(1), tampered},
+		{"truncated", "k1:" + testKey(1), "enc:k1:AAAA"},
+		{"not base64", "k1:" + testKey(1), "enc:k1:***"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useKeys(t, tt.keys)
+			if got, err := DecryptString(tt.value); err == nil {
+				t.Fatalf("DecryptString(%q) = %q, want an error", tt.value, got)
+			}
+		})
+	}
+}
+
+func TestDecryptStringPassesPlaintextThrough(t *testing.T) {
+	useKeys(t, "k1:"+testKey(1))
+	for _, value := range []string{"", "guest@example.com", "enc:only-two", "other:k1:payload"} {
+		got, err := DecryptString(value)
+		if err != nil || got != value {
+			t.Errorf("DecryptString(%q) = %q, %v, want it unchanged", value, got, err)
+		}
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name       string
+		list       string
+		legacy     string
+		wantActive string
+		wantErr    bool
+	}{
+		{"first key is active", "k2:" + testKey(2) + ", k1:" + testKey(1), "", "k2", false},
+		{"legacy key only", "", testKey(1), legacyKeyID, false},
+		{"legacy key alongside list", "k2:" + testKey(2), testKey(1), "k2", false},
+		{"no keys", "", "", "", true},
+		{"missing id", testKey(1), "", "", true},
+		{"short key", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "", "", true},
+		{"duplicate id", "k1:" + testKey(1) + ",k1:" + testKey(2), "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring, err := parseKeyring(tt.list, tt.legacy)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseKeyring succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseKeyring: %v", err)
+			}
+			if ring.active.id != tt.wantActive {
+				t.Fatalf("active key = %q, want %q", ring.active.id, tt.wantActive)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+)
+
+// FakeGateway is an in-memory gateway for local development and tests. Intents
+// succeed at once, or are authorized when captured later, unless Decline is set.
+type FakeGateway struct {
+	mu      sync.Mutex
+	intents map[string]*PaymentIntent
+	refunds int
+	byKey   map[string]RefundResult // refunds by idempotency key
+	Decline bool
+}
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{intents: map[string]*PaymentIntent{}, byKey: map[string]RefundResult{}}
+}
+
+func (*FakeGateway) Name() string { return "fake" }
+
+func (g *FakeGateway) CreateIntent(_ context.Context, req PaymentIntentRequest) (PaymentIntent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ref := "fake_" + req.Reference
+	if intent, ok := g.intents[ref]; ok {
+		return *intent, nil
+	}
+	intent := &PaymentIntent{Ref: ref, Amount: req.Amount, ClientSecret: ref + "_secret"}
+	switch {
+	case g.Decline:
+		intent.Status, intent.Failure = models.PaymentFailed, "card declined"
+	case req.CaptureLater:
+		intent.Status = models.PaymentAuthorized
+	default:
+		intent.Status, intent.Captured = models.PaymentSucceeded, req.Amount
+	}
+	g.intents[ref] = intent
+	return *intent, nil
+}
+
+func (g *FakeGateway) GetIntent(_ context.Context, ref string) (PaymentIntent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	intent, ok := g.intents[ref]
+	if !ok {
+		return PaymentIntent{}, fmt.Errorf("no such payment intent %q", ref)
+	}
+	return *intent, nil
+}
+
+func (g *FakeGateway) Capture(_ context.Context, ref string, amount int64) (PaymentIntent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	intent, ok := g.intents[ref]
+	if !ok {
+		return PaymentIntent{}, fmt.Errorf("no such payment intent %q", ref)
+	}
+	if intent.Status != models.PaymentAuthorized {
+		return PaymentIntent{}, fmt.Errorf("payment intent %q is %s, not authorized", ref, intent.Status)
+	}
+	if amount == 0 || amount > intent.Amount {
+		amount = intent.Amount
+	}
+	intent.Status, intent.Captured = models.PaymentSucceeded, amount
+	return *intent, nil
+}
+
+func (g *FakeGateway) Refund(_ context.Context, ref string, amount int64, key string) (RefundResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	intent, ok := g.intents[ref]
+	if !ok {
+		return RefundResult{}, fmt.Errorf("no such payment intent %q", ref)
+	}
+	if refund, ok := g.byKey[key]; ok && key != "" {
+		return refund, nil
+	}
+	if amount == 0 || amount > intent.Captured {
+		amount = intent.Captured
+	}
+	g.refunds++
+	refund := RefundResult{Ref: fmt.Sprintf("fake_refund_%d", g.refunds), Status: "succeeded", Amount: amount}
+	g.byKey[key] = refund
+	return refund, nil
+}
+
+// fakeEvent is the body of a fake gateway webhook, Type is "payment" or "refund".
+type fakeEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Ref       string `json:"ref"`
+	Status    string `json:"status"`
+	Amount    int64  `json:"amount"`
+	Captured  int64  `json:"captured"`
+	RefundRef string `json:"refundRef"`
+}
+
+// VerifyWebhook checks X-Fake-Signature, the hex HMAC-SHA256 of the body under
+// FAKE_WEBHOOK_SECRET.
+func (*FakeGateway) VerifyWebhook(header func(string) string, body []byte) error {
+	if !validHMAC(sha256.New, common.FakeWebhookSecret(), body, header("X-Fake-Signature")) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (*FakeGateway) ParseWebhook(body []byte) (WebhookEvent, error) {
+	var payload fakeEvent
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return WebhookEvent{}, err
+	}
+	event := WebhookEvent{ID: payload.ID, Type: payload.Type, PaymentRef: payload.Ref}
+	switch payload.Type {
+	case "payment":
+		event.Intent = &PaymentIntent{Ref: payload.Ref, Status: payload.Status, Amount: payload.Amount, Captured: payload.Captured}
+	case "refund":
+		event.Refund = &RefundResult{Ref: payload.RefundRef, Status: payload.Status, Amount: payload.Amount}
+	}
+	return event, nil
+}
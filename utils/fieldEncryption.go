@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// modes of the `encrypt` struct tag on string fields
+const (
+	EncryptModeRandom = "random" // AES-GCM with a random nonce, cannot be queried
+	EncryptModeLookup = "lookup" // deterministic, can be matched with LookupFilter
+)
+
+// SealFields encrypts, in place, the string fields of the struct v points to that
+// carry an `encrypt` tag, including those of nested structs and slices. Nested
+// slices and pointers are copied before they are changed, so sealing a shallow
+// copy of a value leaves the original readable.
+//
+// Every non-empty value is sealed, even one that already looks sealed: values
+// come from requests, and a client could otherwise store plaintext, or a value
+// that fails to open, by sending "enc:..." itself. Stored values are
+// re-encrypted with ResealDocument instead.
+func SealFields(v interface{}) error {
+	return transformPointer(v, func(mode, value string) (string, error) {
+		if value == "" {
+			return value, nil
+		}
+		return sealMode(mode, value)
+	})
+}
+
+// OpenFields decrypts, in place, the fields SealFields encrypted.
+func OpenFields(v interface{}) error {
+	return transformPointer(v, func(_, value string) (string, error) {
+		return DecryptString(value)
+	})
+}
+
+// LookupFilter matches a field tagged `encrypt:"lookup"` against plaintext.
+func LookupFilter(plaintext string) (bson.M, error) {
+	values, err := LookupValues(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"$in": values}, nil
+}
+
+// maskSealed returns a copy of v whose encrypted fields hold their lookup value,
+// so the audit trail can tell a field changed without storing its plaintext.
+func maskSealed(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if !hasEncryptedFields(rv.Type()) {
+		return v
+	}
+	cp := reflect.New(rv.Type()).Elem()
+	cp.Set(rv)
+	err := transformFields(cp, func(_, value string) (string, error) {
+		plaintext, err := DecryptString(value)
+		if err != nil {
+			return "", err
+		}
+		return EncryptLookup(plaintext)
+	})
+	if err != nil {
+		return "[encrypted]"
+	}
+	return cp.Interface()
+}
+
+func transformPointer(v interface{}, fn func(mode, value string) (string, error)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("field encryption needs a non nil pointer, got %T", v)
+	}
+	return transformFields(rv.Elem(), fn)
+}
+
+func transformFields(v reflect.Value, fn func(mode, value string) (string, error)) error {
+	if !hasEncryptedFields(v.Type()) {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		cp := reflect.New(v.Type().Elem())
+		cp.Elem().Set(v.Elem())
+		v.Set(cp)
+		return transformFields(cp.Elem(), fn)
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return nil
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(cp, v)
+		v.Set(cp)
+		for i := 0; i < cp.Len(); i++ {
+			if err := transformFields(cp.Index(i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fv := v.Field(i)
+			if mode := field.Tag.Get("encrypt"); mode != "" && fv.Kind() == reflect.String {
+				out, err := fn(mode, fv.String())
+				if err != nil {
+					return fmt.Errorf("%s: %w", field.Name, err)
+				}
+				fv.SetString(out)
+				continue
+			}
+			if err := transformFields(fv, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// encryptedField is the bson path of an encrypted field, arrays along the path
+// are walked element by element.
+type encryptedField struct {
+	path []string
+	mode string
+}
+
+var fieldCache sync.Map // reflect.Type -> []encryptedField
+
+func hasEncryptedFields(t reflect.Type) bool {
+	return len(encryptedFields(t)) > 0
+}
+
+func encryptedFields(t reflect.Type) []encryptedField {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]encryptedField)
+	}
+	fields := collectEncryptedFields(t, nil, map[reflect.Type]bool{})
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func collectEncryptedFields(t reflect.Type, prefix []string, seen map[reflect.Type]bool) []encryptedField {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	var fields []encryptedField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		path := append(append([]string{}, prefix...), bsonName(field))
+		if mode := field.Tag.Get("encrypt"); mode != "" && field.Type.Kind() == reflect.String {
+			fields = append(fields, encryptedField{path: path, mode: mode})
+			continue
+		}
+		fields = append(fields, collectEncryptedFields(field.Type, path, seen)...)
+	}
+	return fields
+}
+
+func bsonName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("bson"), ",", 2)[0]
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// ResealDocument re-encrypts the encrypted fields of a raw document, as
+// described by the tags of model, under the active key. It returns the top
+// level fields that changed, ready for $set. Numbers stored before a field was
+// encrypted are sealed as strings.
+func ResealDocument(doc bson.M, model interface{}) (bson.M, error) {
+	changed := bson.M{}
+	for _, field := range encryptedFields(reflect.TypeOf(model)) {
+		top := field.path[0]
+		value, ok := doc[top]
+		if !ok {
+			continue
+		}
+		out, dirty, err := resealPath(value, field.path[1:], field.mode)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", strings.Join(field.path, "."), err)
+		}
+		if dirty {
+			doc[top] = out
+			changed[top] = out
+		}
+	}
+	return changed, nil
+}
+
+func resealPath(value interface{}, path []string, mode string) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return v, false, nil
+	case bson.A:
+		dirty := false
+		for i := range v {
+			out, d, err := resealPath(v[i], path, mode)
+			if err != nil {
+				return nil, false, err
+			}
+			v[i], dirty = out, dirty || d
+		}
+		return v, dirty, nil
+	case bson.M:
+		if len(path) == 0 {
+			return v, false, nil
+		}
+		child, ok := v[path[0]]
+		if !ok {
+			return v, false, nil
+		}
+		out, dirty, err := resealPath(child, path[1:], mode)
+		if err != nil {
+			return nil, false, err
+		}
+		v[path[0]] = out
+		return v, dirty, nil
+	case primitive.D:
+		if len(path) == 0 {
+			return v, false, nil
+		}
+		dirty := false
+		for i := range v {
+			if v[i].Key != path[0] {
+				continue
+			}
+			out, d, err := resealPath(v[i].Value, path[1:], mode)
+			if err != nil {
+				return nil, false, err
+			}
+			v[i].Value, dirty = out, d
+		}
+		return v, dirty, nil
+	}
+	if len(path) != 0 {
+		return value, false, nil
+	}
+
+	plain, ok := value.(string)
+	if !ok {
+		if plain, ok = LegacyNumber(value); !ok {
+			return value, false, nil
+		}
+	}
+	out, dirty, err := ResealValue(mode, plain)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, isString := value.(string); !isString {
+		dirty = true
+	}
+	return out, dirty, nil
+}
+
+// LegacyNumber renders a number stored before its field became an encrypted
+// string, such as a user's phoneNumber. Numeric zero was how an unset number
+// was stored and gives "". It reports false when value is not a number.
+func LegacyNumber(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case int32:
+		return legacyDigits(int64(v)), true
+	case int64:
+		return legacyDigits(v), true
+	case float64:
+		return legacyDigits(int64(v)), true
+	}
+	return "", false
+}
+
+func legacyDigits(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
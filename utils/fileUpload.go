@@ -2,12 +2,13 @@ package utils
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/cloudinary/cloudinary-go"
+	"github.com/cloudinary/cloudinary-go/api"
 	"github.com/cloudinary/cloudinary-go/api/uploader"
 	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/codes"
 
 	"github.com/chiboycalix/hotel-booking-system-backend/common"
 	"github.com/chiboycalix/hotel-booking-system-backend/models"
@@ -16,8 +17,8 @@ import (
 var validate = validator.New()
 
 type mediaUpload interface {
-	FileUpload(file models.File) (string, error)
-	RemoteUpload(url models.Url) (string, error)
+	FileUpload(ctx context.Context, file models.File) (string, error)
+	RemoteUpload(ctx context.Context, url models.Url) (string, error)
 }
 
 type media struct{}
@@ -26,7 +27,7 @@ func NewMediaUpload() mediaUpload {
 	return &media{}
 }
 
-func (*media) FileUpload(file models.File) (string, error) {
+func (*media) FileUpload(ctx context.Context, file models.File) (string, error) {
 	// validate
 	err := validate.Struct(file)
 	if err != nil {
@@ -34,49 +35,100 @@ func (*media) FileUpload(file models.File) (string, error) {
 	}
 
 	// upload
-	uploadUrl, err := ImageUploadHelper(file.File)
+	uploadUrl, err := ImageUploadHelper(ctx, file.File)
+	common.MediaUploads.WithLabelValues("file", common.ResultLabel(err)).Inc()
 	if err != nil {
 		return "", err
 	}
 	return uploadUrl, nil
 }
 
-func (*media) RemoteUpload(url models.Url) (string, error) {
-	fmt.Println(url.Url, "url")
+func (*media) RemoteUpload(ctx context.Context, url models.Url) (string, error) {
+	common.Logger(ctx).Debug("uploading remote media", "url", url.Url)
 	err := validate.Struct(url)
 	if err != nil {
 		return "", err
 	}
 
-	uploadUrl, errUrl := ImageUploadHelper(url.Url)
-	if errUrl != nil {
+	uploadUrl, err := ImageUploadHelper(ctx, url.Url)
+	common.MediaUploads.WithLabelValues("remote", common.ResultLabel(err)).Inc()
+	if err != nil {
 		return "", err
 	}
 	return uploadUrl, nil
 }
 
-func ImageUploadHelper(input interface{}) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func ImageUploadHelper(ctx context.Context, input interface{}) (url string, err error) {
+	result, err := upload(ctx, input, uploader.UploadParams{Folder: common.CloudinaryUploadFolder()})
+	if err != nil {
+		return "", err
+	}
+	return result.SecureURL, nil
+}
+
+// PrivateUploadHelper stores sensitive scans (e.g. identity documents) as private
+// assets that can only be fetched through signed urls.
+func PrivateUploadHelper(ctx context.Context, input interface{}) (url string, publicID string, err error) {
+	result, err := upload(ctx, input, uploader.UploadParams{
+		Folder: common.CloudinaryUploadFolder() + "/private",
+		Type:   privateDelivery,
+	})
+	common.MediaUploads.WithLabelValues("private", common.ResultLabel(err)).Inc()
+	if err != nil {
+		return "", "", err
+	}
+	return result.SecureURL, result.PublicID, nil
+}
+
+// DestroyPrivateUpload permanently removes an asset stored by PrivateUploadHelper.
+func DestroyPrivateUpload(ctx context.Context, publicID string) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	ctx, span := common.Tracer.Start(ctx, "cloudinary.Destroy")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	cld, err := newCloudinary()
+	if err != nil {
+		return err
+	}
+	_, err = cld.Upload.Destroy(ctx, uploader.DestroyParams{PublicID: publicID, Type: string(privateDelivery), Invalidate: true})
+	return err
+}
+
+const privateDelivery = api.DeliveryType("private")
+
+func upload(ctx context.Context, input interface{}, params uploader.UploadParams) (result *uploader.UploadResult, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
+	ctx, span := common.Tracer.Start(ctx, "cloudinary.Upload")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
 
 	// create cloudinary instance
-	cld, err := cloudinary.NewFromParams(
-		common.CloudinaryCloudName(),
-		common.CloudinaryAPIKey(),
-		common.CloudinaryAPISecret(),
-	)
+	cld, err := newCloudinary()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// upload file
-	uploadParam, err := cld.Upload.Upload(
-		ctx,
-		input,
-		uploader.UploadParams{Folder: common.CloudinaryUploadFolder()},
+	return cld.Upload.Upload(ctx, input, params)
+}
+
+func newCloudinary() (*cloudinary.Cloudinary, error) {
+	return cloudinary.NewFromParams(
+		common.CloudinaryCloudName(),
+		common.CloudinaryAPIKey(),
+		common.CloudinaryAPISecret(),
 	)
-	if err != nil {
-		return "", err
-	}
-	return uploadParam.SecureURL, nil
 }
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+)
+
+const IDEMPOTENCY_MODEL = "idempotency_keys"
+
+// RequestFingerprint identifies a request by what it asks for, so a key reused
+// for a different request can be told apart from a retry.
+func RequestFingerprint(method, path string, body []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(method + " " + path + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// ReserveIdempotencyKey claims a key for a caller's request. When the key was
+// claimed before it returns the existing record and false instead, unless the
+// same request holds it in progress past its lease: then the attempt that held
+// it is taken to be dead and this one takes the key over.
+func ReserveIdempotencyKey(ctx context.Context, userID, key, fingerprint string) (models.IdempotencyRecord, bool, error) {
+	collection := common.GetDBCollection(IDEMPOTENCY_MODEL)
+	now := time.Now()
+	leaseID := primitive.NewObjectID().Hex()
+	record := models.IdempotencyRecord{
+		Key:         key,
+		UserID:      userID,
+		Fingerprint: fingerprint,
+		Status:      models.IdempotencyInProgress,
+		LeaseID:     leaseID,
+		LockedUntil: now.Add(common.IdempotencyLease()),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(common.IdempotencyTTL()),
+	}
+	_, err := collection.InsertOne(ctx, record)
+	if err == nil {
+		return record, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return models.IdempotencyRecord{}, false, err
+	}
+
+	var existing models.IdempotencyRecord
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"userId": userID, "key": key, "fingerprint": fingerprint, "status": models.IdempotencyInProgress,
+			"$or": bson.A{bson.M{"lockedUntil": bson.M{"$lte": now}}, bson.M{"lockedUntil": nil}},
+		},
+		bson.M{"$set": bson.M{"leaseId": leaseID, "lockedUntil": record.LockedUntil}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&existing)
+	if err == nil {
+		return existing, true, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return models.IdempotencyRecord{}, false, err
+	}
+	err = collection.FindOne(ctx, bson.M{"userId": userID, "key": key}).Decode(&existing)
+	return existing, false, err
+}
+
+// CompleteIdempotencyKey stores the response a request got for replay. It does
+// nothing when the request lost its key to a retry after its lease ran out.
+func CompleteIdempotencyKey(ctx context.Context, record models.IdempotencyRecord, statusCode int, contentType string, body []byte) error {
+	_, err := common.GetDBCollection(IDEMPOTENCY_MODEL).UpdateOne(ctx,
+		bson.M{"userId": record.UserID, "key": record.Key, "status": models.IdempotencyInProgress, "leaseId": record.LeaseID},
+		bson.M{"$set": bson.M{
+			"status":      models.IdempotencyCompleted,
+			"statusCode":  statusCode,
+			"contentType": contentType,
+			"body":        body,
+		}},
+	)
+	return err
+}
+
+// ReleaseIdempotencyKey frees a key whose request did not go through, so it
+// can be retried.
+func ReleaseIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) error {
+	_, err := common.GetDBCollection(IDEMPOTENCY_MODEL).DeleteOne(ctx,
+		bson.M{"userId": record.UserID, "key": record.Key, "status": models.IdempotencyInProgress, "leaseId": record.LeaseID})
+	return err
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer writes each message as an .eml file into a directory instead of
+// sending it, for development without a mail provider.
+type FileMailer struct {
+	dir string
+	mu  sync.Mutex
+	seq int
+}
+
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{dir: dir}
+}
+
+func (*FileMailer) Name() string { return "file" }
+
+func (f *FileMailer) Send(_ context.Context, msg Message) error {
+	body, err := msg.MIME()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.seq++
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().Format("20060102-150405"), f.seq)
+	f.mu.Unlock()
+	return os.WriteFile(filepath.Join(f.dir, name), body, 0o644)
+}
+
+// MemoryMailer keeps the messages it is given, for tests to inspect.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (*MemoryMailer) Name() string { return "memory" }
+
+func (m *MemoryMailer) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Reset forgets the messages sent so far.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+	"github.com/chiboycalix/hotel-booking-system-backend/templates"
+)
+
+const EMAIL_TEMPLATE_MODEL = "email_templates"
+
+// emailTemplate is an email in one language. Any part may be missing, and is
+// then taken from a less specific language.
+type emailTemplate struct {
+	subject *texttemplate.Template
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+}
+
+var (
+	emailTemplatesOnce sync.Once
+	emailTemplates     map[string]map[string]emailTemplate // name, then locale
+	emailTemplatesErr  error
+)
+
+// LoadEmailTemplates parses the embedded email templates. It is called at
+// startup so that a broken template stops the server instead of an email.
+func LoadEmailTemplates() error {
+	_, err := parsedEmailTemplates()
+	return err
+}
+
+func parsedEmailTemplates() (map[string]map[string]emailTemplate, error) {
+	emailTemplatesOnce.Do(func() {
+		emailTemplates, emailTemplatesErr = parseEmailTemplates(templates.FS)
+	})
+	return emailTemplates, emailTemplatesErr
+}
+
+// parseEmailTemplates reads name.html, name.txt and their name.<locale>
+// variants from fsys.
+func parseEmailTemplates(fsys fs.FS) (map[string]map[string]emailTemplate, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	type sources struct{ html, text string }
+	found := make(map[string]map[string]sources)
+	for _, entry := range entries {
+		file := entry.Name()
+		ext := path.Ext(file)
+		if entry.IsDir() || (ext != ".html" && ext != ".txt") {
+			continue
+		}
+		source, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		name, locale, _ := strings.Cut(strings.TrimSuffix(file, ext), ".")
+		locale = NormalizeLocale(locale)
+		if found[name] == nil {
+			found[name] = make(map[string]sources)
+		}
+		s := found[name][locale]
+		if ext == ".html" {
+			s.html = string(source)
+		} else {
+			s.text = string(source)
+		}
+		found[name][locale] = s
+	}
+
+	parsed := make(map[string]map[string]emailTemplate, len(found))
+	for name, locales := range found {
+		if locales[""].html == "" {
+			return nil, fmt.Errorf("email template %s has no %s.html", name, name)
+		}
+		parsed[name] = make(map[string]emailTemplate, len(locales))
+		for locale, s := range locales {
+			t, err := newEmailTemplate(name, "", s.html, s.text)
+			if err != nil {
+				return nil, err
+			}
+			parsed[name][locale] = t
+		}
+	}
+	return parsed, nil
+}
+
+// newEmailTemplate parses the given parts, leaving out empty ones. Without a
+// subject, one defined in the text as {{define "subject"}} is used.
+func newEmailTemplate(name, subject, html, text string) (emailTemplate, error) {
+	var t emailTemplate
+	var err error
+	if html != "" {
+		if t.html, err = htmltemplate.New(name).Parse(html); err != nil {
+			return emailTemplate{}, fmt.Errorf("parsing %s HTML: %w", name, err)
+		}
+	}
+	if text != "" {
+		if t.text, err = texttemplate.New(name).Parse(text); err != nil {
+			return emailTemplate{}, fmt.Errorf("parsing %s text: %w", name, err)
+		}
+		t.subject = t.text.Lookup("subject")
+	}
+	if subject != "" {
+		if t.subject, err = texttemplate.New(name).Parse(subject); err != nil {
+			return emailTemplate{}, fmt.Errorf("parsing %s subject: %w", name, err)
+		}
+	}
+	return t, nil
+}
+
+// ValidateEmailTemplate checks that an override is for a known template and parses.
+func ValidateEmailTemplate(override models.EmailTemplate) error {
+	parsed, err := parsedEmailTemplates()
+	if err != nil {
+		return err
+	}
+	if _, ok := parsed[override.Name]; !ok {
+		return fmt.Errorf("unknown email template %q", override.Name)
+	}
+	_, err = newEmailTemplate(override.Name, override.Subject, override.HTML, override.Text)
+	return err
+}
+
+// EmailTemplateLocales lists each embedded template with the locales it has a
+// variant for, "" being the default.
+func EmailTemplateLocales() (map[string][]string, error) {
+	parsed, err := parsedEmailTemplates()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string][]string, len(parsed))
+	for name, locales := range parsed {
+		for locale := range locales {
+			names[name] = append(names[name], locale)
+		}
+	}
+	return names, nil
+}
+
+// NormalizeLocale lower-cases a language tag and uses - as its separator, as
+// templates and overrides are stored: fr_CA gives fr-ca.
+func NormalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// localeFallbacks lists the locales an email is looked up in, most specific
+// first: fr-CA gives fr-ca, fr and the default "".
+func localeFallbacks(locale string) []string {
+	var fallbacks []string
+	for locale = NormalizeLocale(locale); locale != ""; {
+		fallbacks = append(fallbacks, locale)
+		i := strings.LastIndexByte(locale, '-')
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return append(fallbacks, "")
+}
+
+// emailTemplateOverrides loads the admin overrides of a template for locales.
+func emailTemplateOverrides(ctx context.Context, name string, locales []string) (map[string]emailTemplate, error) {
+	cursor, err := common.GetDBCollection(EMAIL_TEMPLATE_MODEL).Find(ctx, bson.M{"name": name, "locale": bson.M{"$in": locales}})
+	if err != nil {
+		return nil, err
+	}
+	var stored []models.EmailTemplate
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]emailTemplate, len(stored))
+	for _, o := range stored {
+		t, err := newEmailTemplate(o.Name, o.Subject, o.HTML, o.Text)
+		if err != nil {
+			return nil, err
+		}
+		overrides[o.Locale] = t
+	}
+	return overrides, nil
+}
+
+// resolveEmailTemplate picks each part of an email from the most specific
+// locale that has it, an admin override before the embedded template.
+func resolveEmailTemplate(ctx context.Context, name, locale string) (emailTemplate, error) {
+	parsed, err := parsedEmailTemplates()
+	if err != nil {
+		return emailTemplate{}, err
+	}
+	variants, ok := parsed[name]
+	if !ok {
+		return emailTemplate{}, fmt.Errorf("unknown email template %q", name)
+	}
+	locales := localeFallbacks(locale)
+	overrides, err := emailTemplateOverrides(ctx, name, locales)
+	if err != nil {
+		return emailTemplate{}, err
+	}
+
+	var chosen emailTemplate
+	for _, locale := range locales {
+		for _, t := range []emailTemplate{overrides[locale], variants[locale]} {
+			if chosen.subject == nil {
+				chosen.subject = t.subject
+			}
+			if chosen.html == nil {
+				chosen.html = t.html
+			}
+			if chosen.text == nil {
+				chosen.text = t.text
+			}
+		}
+	}
+	return chosen, nil
+}
+
+func executeText(t *texttemplate.Template, data interface{}) (string, error) {
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
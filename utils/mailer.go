@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+)
+
+// Message is a rendered email ready to go out, Template names the template it
+// was rendered from for logs and metrics.
+type Message struct {
+	Template    string       `json:"template"    bson:"template"`
+	From        Recipient    `json:"from"        bson:"from"`
+	To          []Recipient  `json:"to"          bson:"to"`
+	Subject     string       `json:"subject"     bson:"subject"`
+	HTML        string       `json:"-"           bson:"html"`
+	Text        string       `json:"-"           bson:"text"` // plain-text alternative, may be empty
+	Attachments []Attachment `json:"attachments" bson:"attachments"`
+}
+
+// Mailer delivers rendered messages.
+type Mailer interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	mailerOnce sync.Once
+	mailer     Mailer
+	mailerErr  error
+)
+
+// ActiveMailer is the transport chosen by MAIL_TRANSPORT, built on first use.
+// It fails when the transport is unknown or misses a setting it needs, main
+// builds it at start up so that shows at boot rather than on the first send.
+func ActiveMailer() (Mailer, error) {
+	mailerOnce.Do(func() {
+		switch transport := common.MailTransport(); transport {
+		case "brevo":
+			if common.BrevoAPIKey() == "" || common.SenderEmail() == "" {
+				mailerErr = fmt.Errorf("mail transport brevo needs BREVO_API_KEY and SENDER_EMAIL")
+				return
+			}
+			mailer = NewBrevoMailer(common.BrevoAPIKey())
+		case "smtp":
+			if common.SMTPHost() == "" {
+				mailerErr = fmt.Errorf("mail transport smtp needs SMTP_HOST")
+				return
+			}
+			mailer = NewSMTPMailer(common.SMTPHost(), common.SMTPPort(), common.SMTPUsername(), common.SMTPPassword())
+		case "file":
+			mailer = NewFileMailer(common.MailSinkDir())
+		case "memory":
+			mailer = NewMemoryMailer()
+		default:
+			mailerErr = fmt.Errorf("unknown mail transport %q", transport)
+		}
+	})
+	return mailer, mailerErr
+}
+
+// MIME writes the message in RFC 5322 form, as SMTP servers and mail clients read it.
+func (m Message) MIME() ([]byte, error) {
+	var out bytes.Buffer
+	to := make([]string, len(m.To))
+	for i, r := range m.To {
+		to[i] = r.address()
+	}
+	header := func(key, value string) { fmt.Fprintf(&out, "%s: %s\r\n", key, value) }
+	header("From", m.From.address())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	parts := multipart.NewWriter(&out)
+	header("Content-Type", `multipart/mixed; boundary="`+parts.Boundary()+`"`)
+	out.WriteString("\r\n")
+
+	if m.Text == "" {
+		if err := writeQuotedPrintablePart(parts, "text/html", m.HTML); err != nil {
+			return nil, err
+		}
+	} else {
+		// clients show the last alternative they can display, so HTML goes last
+		var alternatives bytes.Buffer
+		alt := multipart.NewWriter(&alternatives)
+		if err := writeQuotedPrintablePart(alt, "text/plain", m.Text); err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintablePart(alt, "text/html", m.HTML); err != nil {
+			return nil, err
+		}
+		if err := alt.Close(); err != nil {
+			return nil, err
+		}
+		body, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {`multipart/alternative; boundary="` + alt.Boundary() + `"`},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := body.Write(alternatives.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, a := range m.Attachments {
+		contentType := mime.TypeByExtension(filepath.Ext(a.Name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64Lines(part, a.Content); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (r Recipient) address() string {
+	return (&mail.Address{Name: r.Name, Address: r.Email}).String()
+}
+
+// writeQuotedPrintablePart adds a UTF-8 text part of contentType to parts.
+func writeQuotedPrintablePart(parts *multipart.Writer, contentType, content string) error {
+	part, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64Lines writes content base64 encoded in the 76 character lines MIME asks for.
+func writeBase64Lines(w io.Writer, content []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+)
+
+const OUTBOX_MODEL = "outbox"
+
+// outbox message statuses
+const (
+	OutboxPending    = "pending"
+	OutboxProcessing = "processing"
+	OutboxSent       = "sent"
+	OutboxDead       = "dead"
+)
+
+// outbox message kinds
+const OutboxEmail = "email"
+
+const (
+	outboxPollInterval = 2 * time.Second
+	// a message claimed longer ago than this by a worker that died is tried again
+	outboxLease      = 5 * time.Minute
+	outboxBaseDelay  = 30 * time.Second
+	outboxMaxBackoff = time.Hour
+)
+
+// OutboxMessage is a notification waiting to be delivered, or the record of one
+// that was. Messages that fail are retried with exponential backoff until
+// MaxAttempts, then kept as dead for an admin to look at and retry.
+type OutboxMessage struct {
+	ID            string     `json:"id"            bson:"_id,omitempty"`
+	Kind          string     `json:"kind"          bson:"kind"`
+	Email         *Message   `json:"email"         bson:"email,omitempty"`
+	Status        string     `json:"status"        bson:"status"`
+	Attempts      int        `json:"attempts"      bson:"attempts"`
+	MaxAttempts   int        `json:"maxAttempts"   bson:"maxAttempts"`
+	LastError     string     `json:"lastError"     bson:"lastError"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	LockedUntil   *time.Time `json:"lockedUntil"   bson:"lockedUntil"`
+	RequestID     string     `json:"requestId"     bson:"requestId"`
+	CreatedAt     time.Time  `json:"createdAt"     bson:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"     bson:"updatedAt"`
+	SentAt        *time.Time `json:"sentAt"        bson:"sentAt"`
+}
+
+// EnqueueEmail renders an email and queues it for the outbox workers. Called
+// with a transaction's ctx, the email is only sent if the transaction commits.
+func EnqueueEmail(ctx context.Context, mail Email) error {
+	msg, err := RenderEmail(ctx, mail)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = common.GetDBCollection(OUTBOX_MODEL).InsertOne(ctx, OutboxMessage{
+		Kind:          OutboxEmail,
+		Email:         &msg,
+		Status:        OutboxPending,
+		MaxAttempts:   common.OutboxMaxAttempts(),
+		NextAttemptAt: now,
+		RequestID:     common.RequestID(ctx),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	return err
+}
+
+// RunOutboxWorkers delivers queued messages with the given number of workers
+// until ctx is cancelled.
+func RunOutboxWorkers(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runOutboxWorker(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func runOutboxWorker(ctx context.Context) {
+	logger := common.Logger(ctx).With("job", "outbox")
+	for {
+		msg, err := claimOutboxMessage(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			logger.Error("outbox claim failed", "error", err)
+		case msg != nil:
+			deliverOutboxMessage(ctx, *msg)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(outboxPollInterval):
+		}
+	}
+}
+
+// claimOutboxMessage takes the oldest message due, or nil when none is.
+func claimOutboxMessage(ctx context.Context) (*OutboxMessage, error) {
+	now := time.Now()
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": OutboxPending, "nextAttemptAt": bson.M{"$lte": now}},
+		bson.M{"status": OutboxProcessing, "lockedUntil": bson.M{"$lte": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{"status": OutboxProcessing, "lockedUntil": now.Add(outboxLease), "updatedAt": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+		SetReturnDocument(options.After)
+	var msg OutboxMessage
+	err := common.GetDBCollection(OUTBOX_MODEL).FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// deliverOutboxMessage sends a claimed message and records the outcome on it.
+func deliverOutboxMessage(ctx context.Context, msg OutboxMessage) {
+	ctx = common.WithRequestID(ctx, msg.RequestID)
+	var err error
+	switch {
+	case msg.Kind == OutboxEmail && msg.Email != nil:
+		err = SendMessage(ctx, *msg.Email)
+	default:
+		err = fmt.Errorf("unknown outbox message kind %q", msg.Kind)
+	}
+
+	now := time.Now()
+	set := bson.M{"lockedUntil": nil, "updatedAt": now}
+	outcome := OutboxSent
+	switch {
+	case err == nil:
+		set["status"], set["sentAt"], set["lastError"] = OutboxSent, now, ""
+	case msg.Attempts >= msg.MaxAttempts:
+		outcome = OutboxDead
+		set["status"], set["lastError"] = OutboxDead, err.Error()
+		common.Logger(ctx).Error("outbox message dead-lettered", "id", msg.ID, "attempts", msg.Attempts, "error", err)
+	default:
+		outcome = "retry"
+		set["status"], set["lastError"] = OutboxPending, err.Error()
+		set["nextAttemptAt"] = now.Add(outboxBackoff(msg.Attempts))
+	}
+	common.OutboxDeliveries.WithLabelValues(msg.Kind, outcome).Inc()
+
+	objectId, convErr := primitive.ObjectIDFromHex(msg.ID)
+	if convErr != nil {
+		return
+	}
+	// recorded even when ctx is cancelled mid-delivery, so the send isn't repeated
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if _, err := common.GetDBCollection(OUTBOX_MODEL).UpdateOne(writeCtx, bson.M{"_id": objectId}, bson.M{"$set": set}); err != nil {
+		common.Logger(ctx).Error("outbox update failed", "id", msg.ID, "error", err)
+	}
+}
+
+// outboxBackoff is the wait after a message's attempt-th failure: 30s doubling
+// each time, up to an hour.
+func outboxBackoff(attempt int) time.Duration {
+	delay := outboxBaseDelay
+	for i := 1; i < attempt && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxBackoff {
+		delay = outboxMaxBackoff
+	}
+	return delay
+}
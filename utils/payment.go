@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+)
+
+// ErrCaptureUnsupported is returned by gateways that charge at once and cannot
+// hold funds for a later capture.
+var ErrCaptureUnsupported = errors.New("payment provider does not support separate capture")
+
+// ErrInvalidSignature is returned for webhook calls that were not signed by the gateway.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// PaymentProvider is a payment gateway. Amounts are in minor units of the
+// currency and references are our payment ids, so retried calls for the same
+// payment are not charged twice.
+type PaymentProvider interface {
+	Name() string
+	CreateIntent(ctx context.Context, req PaymentIntentRequest) (PaymentIntent, error)
+	GetIntent(ctx context.Context, ref string) (PaymentIntent, error)
+	// Capture takes amount of an authorized intent, 0 takes all of it.
+	Capture(ctx context.Context, ref string, amount int64) (PaymentIntent, error)
+	// Refund gives back amount of a captured intent, 0 gives back all of it. A
+	// retry with the same key returns the first refund instead of a second one.
+	Refund(ctx context.Context, ref string, amount int64, key string) (RefundResult, error)
+	// VerifyWebhook checks the signature of a webhook call, header reads its headers.
+	VerifyWebhook(header func(string) string, body []byte) error
+	// ParseWebhook reads a verified webhook body, events it does not handle come
+	// back with neither Intent nor Refund set.
+	ParseWebhook(body []byte) (WebhookEvent, error)
+}
+
+type PaymentIntentRequest struct {
+	Reference    string
+	Amount       int64
+	Currency     string
+	Email        string
+	Description  string
+	CaptureLater bool // authorize only, for deposits held until check-in
+}
+
+// PaymentIntent is the gateway's view of a payment, Status is one of the
+// models.Payment* statuses.
+type PaymentIntent struct {
+	Ref          string
+	Status       string
+	Amount       int64
+	Captured     int64
+	ClientSecret string // for the gateway's client side SDK
+	CheckoutURL  string // for gateways that redirect to a hosted page
+	Failure      string
+}
+
+type RefundResult struct {
+	Ref    string
+	Status string // pending, succeeded or failed
+	Amount int64
+}
+
+// WebhookEvent is a gateway's notice that a payment or refund changed.
+type WebhookEvent struct {
+	ID         string
+	Type       string
+	PaymentRef string // the gateway's reference of the payment concerned
+	Intent     *PaymentIntent
+	Refund     *RefundResult
+}
+
+// gatewayID reads ids gateways send either as numbers or as strings.
+type gatewayID string
+
+func (id *gatewayID) UnmarshalJSON(data []byte) error {
+	*id = gatewayID(strings.Trim(string(data), `"`))
+	if *id == "null" {
+		*id = ""
+	}
+	return nil
+}
+
+// validHMAC compares a hex encoded signature with the HMAC of body.
+func validHMAC(newHash func() hash.Hash, secret string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || secret == "" {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+var (
+	providersOnce sync.Once
+	providers     map[string]PaymentProvider
+)
+
+// PaymentProviderByName returns a configured gateway, payments keep the name
+// of the one they were made with.
+func PaymentProviderByName(name string) (PaymentProvider, error) {
+	providersOnce.Do(func() {
+		providers = map[string]PaymentProvider{}
+		// the fake gateway approves every charge, it never runs by accident
+		if common.FakePaymentsEnabled() {
+			providers["fake"] = NewFakeGateway()
+		}
+		if key := common.StripeSecretKey(); key != "" {
+			providers["stripe"] = NewStripeGateway(key)
+		}
+		if key := common.PaystackSecretKey(); key != "" {
+			providers["paystack"] = NewPaystackGateway(key)
+		}
+	})
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("payment provider %q is not configured", name)
+	}
+	return provider, nil
+}
+
+// ActivePaymentProvider is the gateway new payments go through.
+func ActivePaymentProvider() (PaymentProvider, error) {
+	return PaymentProviderByName(common.PaymentProvider())
+}
+
+// CheckPaymentProvider makes sure PAYMENT_PROVIDER names a configured gateway,
+// so a misconfigured server stops at startup instead of taking payments
+// through the wrong one.
+func CheckPaymentProvider() error {
+	name := common.PaymentProvider()
+	if name == "" {
+		return errors.New("PAYMENT_PROVIDER is not set, use stripe or paystack (fake needs ALLOW_FAKE_PAYMENTS=true)")
+	}
+	if _, err := ActivePaymentProvider(); err != nil {
+		if name == "fake" {
+			return errors.New("PAYMENT_PROVIDER=fake needs ALLOW_FAKE_PAYMENTS=true")
+		}
+		return fmt.Errorf("%w, set its secret key", err)
+	}
+	return nil
+}
+
+var gatewayClient = &http.Client{Timeout: 20 * time.Second}
+
+// gatewayCall traces and counts one call to a payment gateway.
+func gatewayCall(ctx context.Context, provider, operation string, call func(context.Context) error) (err error) {
+	ctx, span := common.Tracer.Start(ctx, provider+"."+operation, trace.WithAttributes(
+		attribute.String("payment.provider", provider),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		common.PaymentOperations.WithLabelValues(provider, operation, common.ResultLabel(err)).Inc()
+	}()
+	return call(ctx)
+}
+
+// doGatewayRequest sends req and decodes a JSON response into out, errors
+// carry the gateway's message as read by errMessage.
+func doGatewayRequest(req *http.Request, out interface{}, errMessage func([]byte) string) error {
+	res, err := gatewayClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 300 {
+		if msg := errMessage(body); msg != "" {
+			return fmt.Errorf("%s: %s", res.Status, msg)
+		}
+		return errors.New(res.Status)
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+)
+
+const paystackAPI = "https://api.paystack.co"
+
+// PaystackGateway initializes Paystack transactions, the guest pays on the
+// hosted checkout page. Paystack charges at once, so it cannot hold deposits
+// for a later capture.
+type PaystackGateway struct {
+	secretKey string
+}
+
+func NewPaystackGateway(secretKey string) *PaystackGateway {
+	return &PaystackGateway{secretKey: secretKey}
+}
+
+func (*PaystackGateway) Name() string { return "paystack" }
+
+type paystackResponse struct {
+	Status  bool            `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (g *PaystackGateway) CreateIntent(ctx context.Context, req PaymentIntentRequest) (PaymentIntent, error) {
+	if req.CaptureLater {
+		return PaymentIntent{}, ErrCaptureUnsupported
+	}
+	body := map[string]interface{}{
+		"reference": req.Reference,
+		"amount":    req.Amount,
+		"currency":  strings.ToUpper(req.Currency),
+		"email":     req.Email,
+		"metadata":  map[string]string{"description": req.Description},
+	}
+	var out struct {
+		AuthorizationURL string `json:"authorization_url"`
+		AccessCode       string `json:"access_code"`
+		Reference        string `json:"reference"`
+	}
+	err := gatewayCall(ctx, g.Name(), "create_intent", func(ctx context.Context) error {
+		return g.do(ctx, http.MethodPost, "/transaction/initialize", body, &out)
+	})
+	if err != nil {
+		return PaymentIntent{}, err
+	}
+	return PaymentIntent{
+		Ref:          out.Reference,
+		Status:       models.PaymentPending,
+		Amount:       req.Amount,
+		ClientSecret: out.AccessCode,
+		CheckoutURL:  out.AuthorizationURL,
+	}, nil
+}
+
+func (g *PaystackGateway) GetIntent(ctx context.Context, ref string) (PaymentIntent, error) {
+	var out struct {
+		Status          string `json:"status"`
+		Amount          int64  `json:"amount"`
+		GatewayResponse string `json:"gateway_response"`
+	}
+	err := gatewayCall(ctx, g.Name(), "get_intent", func(ctx context.Context) error {
+		return g.do(ctx, http.MethodGet, "/transaction/verify/"+url.PathEscape(ref), nil, &out)
+	})
+	if err != nil {
+		return PaymentIntent{}, err
+	}
+	intent := PaymentIntent{Ref: ref, Amount: out.Amount}
+	switch out.Status {
+	case "success":
+		intent.Status, intent.Captured = models.PaymentSucceeded, out.Amount
+	case "failed":
+		intent.Status, intent.Failure = models.PaymentFailed, out.GatewayResponse
+	case "reversed":
+		intent.Status = models.PaymentCancelled
+	default:
+		intent.Status = models.PaymentPending
+	}
+	return intent, nil
+}
+
+func (*PaystackGateway) Capture(context.Context, string, int64) (PaymentIntent, error) {
+	return PaymentIntent{}, ErrCaptureUnsupported
+}
+
+type paystackRefund struct {
+	ID           gatewayID `json:"id"`
+	Status       string    `json:"status"`
+	Amount       int64     `json:"amount"`
+	MerchantNote string    `json:"merchant_note"`
+}
+
+func (r paystackRefund) toResult() RefundResult {
+	return RefundResult{Ref: string(r.ID), Status: paystackRefundStatus(r.Status), Amount: r.Amount}
+}
+
+// Refund takes no idempotency key on Paystack, so key goes in the refund's
+// merchant note and a refund of the transaction already carrying it is returned
+// instead of refunding again.
+func (g *PaystackGateway) Refund(ctx context.Context, ref string, amount int64, key string) (RefundResult, error) {
+	var existing []paystackRefund
+	err := gatewayCall(ctx, g.Name(), "list_refunds", func(ctx context.Context) error {
+		return g.do(ctx, http.MethodGet, "/refund?reference="+url.QueryEscape(ref), nil, &existing)
+	})
+	if err != nil {
+		return RefundResult{}, err
+	}
+	for _, refund := range existing {
+		if key != "" && refund.MerchantNote == key {
+			return refund.toResult(), nil
+		}
+	}
+
+	body := map[string]interface{}{"transaction": ref, "merchant_note": key}
+	if amount > 0 {
+		body["amount"] = amount
+	}
+	var out paystackRefund
+	err = gatewayCall(ctx, g.Name(), "refund", func(ctx context.Context) error {
+		return g.do(ctx, http.MethodPost, "/refund", body, &out)
+	})
+	return out.toResult(), err
+}
+
+func (g *PaystackGateway) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, paystackAPI+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.secretKey)
+	req.Header.Set("Content-Type", "application/json")
+	var res paystackResponse
+	if err := doGatewayRequest(req, &res, paystackError); err != nil {
+		return err
+	}
+	return json.Unmarshal(res.Data, out)
+}
+
+func paystackError(body []byte) string {
+	var res paystackResponse
+	if json.Unmarshal(body, &res) != nil {
+		return ""
+	}
+	return res.Message
+}
+
+func paystackRefundStatus(status string) string {
+	switch status {
+	case "processed":
+		return "succeeded"
+	case "failed":
+		return "failed"
+	}
+	return "pending"
+}
+
+// VerifyWebhook checks x-paystack-signature, the HMAC-SHA512 of the body under
+// the secret key.
+func (g *PaystackGateway) VerifyWebhook(header func(string) string, body []byte) error {
+	if !validHMAC(sha512.New, g.secretKey, body, header("x-paystack-signature")) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ParseWebhook reads charge and refund events. Paystack events carry no id of
+// their own, the event name and the id of its transaction or refund identify them.
+func (*PaystackGateway) ParseWebhook(body []byte) (WebhookEvent, error) {
+	var payload struct {
+		Event string `json:"event"`
+		Data  struct {
+			ID                   gatewayID `json:"id"`
+			Reference            string    `json:"reference"`
+			Status               string    `json:"status"`
+			Amount               int64     `json:"amount"`
+			GatewayResponse      string    `json:"gateway_response"`
+			TransactionReference string    `json:"transaction_reference"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return WebhookEvent{}, err
+	}
+	data := payload.Data
+	event := WebhookEvent{ID: payload.Event + ":" + string(data.ID), Type: payload.Event}
+	switch {
+	case payload.Event == "charge.success":
+		event.PaymentRef = data.Reference
+		event.Intent = &PaymentIntent{Ref: data.Reference, Status: models.PaymentSucceeded, Amount: data.Amount, Captured: data.Amount}
+	case strings.HasPrefix(payload.Event, "refund."):
+		event.PaymentRef = data.TransactionReference
+		event.Refund = &RefundResult{Ref: string(data.ID), Status: paystackRefundStatus(data.Status), Amount: data.Amount}
+	}
+	return event, nil
+}
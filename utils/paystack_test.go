@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func paystackSignature(secret, body string) string {
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Paystack signatures carry no timestamp, so there is no expiry to check; a
+// replayed event is caught by the event id instead.
+func TestPaystackVerifyWebhook(t *testing.T) {
+	const secret = "sk_test_paystack"
+	const body = `{"event":"charge.success","data":{"id":1,"reference":"ref_1"}}`
+	sig := paystackSignature(secret, body)
+	flipped := []byte(sig)
+	flipped[0] ^= 1
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    string
+		wantErr bool
+	}{
+		{"valid", secret, sig, body, false},
+		{"valid upper case hex", secret, strings.ToUpper(sig), body, false},
+		{"tampered body", secret, sig, strings.Replace(body, "ref_1", "ref_2", 1), true},
+		{"tampered signature", secret, string(flipped), body, true},
+		{"truncated signature", secret, sig[:64], body, true},
+		{"wrong secret", secret, paystackSignature("sk_test_other", body), body, true},
+		{"not hex", secret, "not-a-signature", body, true},
+		{"no header", secret, "", body, true},
+		{"no secret configured", "", paystackSignature("", body), body, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := func(name string) string {
+				if name == "x-paystack-signature" {
+					return tt.header
+				}
+				return ""
+			}
+			err := NewPaystackGateway(tt.secret).VerifyWebhook(header, []byte(tt.body))
+			if tt.wantErr && !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("VerifyWebhook = %v, want ErrInvalidSignature", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("VerifyWebhook = %v, want nil", err)
+			}
+		})
+	}
+}
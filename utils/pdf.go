@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 in points, with the margins documents are laid out in
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+)
+
+// PDFCell is text placed at X points from the left margin, right aligned cells
+// end at X instead.
+type PDFCell struct {
+	X          float64
+	Text       string
+	AlignRight bool
+}
+
+// PDFWriter lays out rows of text top to bottom on A4 pages in the standard
+// Helvetica fonts, enough for invoices and receipts without a PDF library.
+// Text is encoded as WinAnsi, characters outside it print as "?".
+type PDFWriter struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func NewPDFWriter() *PDFWriter {
+	w := &PDFWriter{}
+	w.newPage()
+	return w
+}
+
+// ContentWidth is the width between the margins.
+func (*PDFWriter) ContentWidth() float64 {
+	return pdfPageWidth - 2*pdfMargin
+}
+
+func (w *PDFWriter) newPage() {
+	w.pages = append(w.pages, &bytes.Buffer{})
+	w.y = pdfPageHeight - pdfMargin
+}
+
+func (w *PDFWriter) ensure(height float64) {
+	if w.y-height < pdfMargin {
+		w.newPage()
+	}
+}
+
+// Row writes one line of cells in the given font size.
+func (w *PDFWriter) Row(size float64, bold bool, cells ...PDFCell) {
+	lineHeight := size * 1.4
+	w.ensure(lineHeight)
+	w.y -= lineHeight
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	page := w.pages[len(w.pages)-1]
+	for _, cell := range cells {
+		text := winAnsi(cell.Text)
+		x := pdfMargin + cell.X
+		if cell.AlignRight {
+			x -= textWidth(text, size)
+		}
+		fmt.Fprintf(page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, w.y, escapePDF(text))
+	}
+}
+
+// Space moves down by height points.
+func (w *PDFWriter) Space(height float64) {
+	w.ensure(height)
+	w.y -= height
+}
+
+// Rule draws a horizontal line across the page.
+func (w *PDFWriter) Rule() {
+	w.Space(6)
+	fmt.Fprintf(w.pages[len(w.pages)-1], "0.5 w %.2f %.2f m %.2f %.2f l S\n", pdfMargin, w.y, pdfPageWidth-pdfMargin, w.y)
+	w.Space(4)
+}
+
+// Bytes assembles the document.
+func (w *PDFWriter) Bytes() []byte {
+	var out bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// objects 1-4 are fixed, then a page and its content for each page
+	kids := make([]string, len(w.pages))
+	for i := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range w.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// winAnsi keeps Latin-1 characters, which WinAnsi shares, as single bytes.
+func winAnsi(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 256 {
+			b.WriteByte(byte(r))
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func escapePDF(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", "", "\n", " ").Replace(s)
+}
+
+// textWidth approximates the width of Helvetica text, exact for digits and the
+// punctuation of amounts, which is what gets right aligned.
+func textWidth(s string, size float64) float64 {
+	units := 0
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch >= '0' && ch <= '9':
+			units += 556
+		case ch == '.' || ch == ',' || ch == ' ':
+			units += 278
+		case ch == '-':
+			units += 333
+		case ch >= 'A' && ch <= 'Z':
+			units += 667
+		default:
+			units += 500
+		}
+	}
+	return float64(units) * size / 1000
+}
@@ -1,7 +1,7 @@
 package utils
 
 import (
-	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -9,15 +9,22 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
 	"github.com/chiboycalix/hotel-booking-system-backend/responses"
 )
 
 type JWTClaim struct {
 	ID      string `json:"_id"`
+	Role    string `json:"role"`
 	IsAdmin bool   `json:"isAdmin"`
 	jwt.StandardClaims
 }
 
+// IsStaff reports whether the caller works at the hotel (front desk or admin).
+func (c JWTClaim) IsStaff() bool {
+	return c.IsAdmin || c.Role == models.RoleStaff || c.Role == models.RoleAdmin
+}
+
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	return string(bytes), err
@@ -27,9 +34,10 @@ func CheckPasswordHash(hashed, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
 }
 
-func GenerateJWT(id string, isAdmin bool) (string, error) {
+func GenerateJWT(id string, role string, isAdmin bool) (string, error) {
 	claims := &JWTClaim{
 		ID:      id,
+		Role:    role,
 		IsAdmin: isAdmin,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
@@ -40,36 +48,60 @@ func GenerateJWT(id string, isAdmin bool) (string, error) {
 	return token.SignedString([]byte(tokenSecret))
 }
 
-func ValidateToken(tokenString string, secretKey string, c *fiber.Ctx) (JWTClaim, error) {
+// BearerToken reads the Authorization header, with or without the "Bearer " prefix.
+func BearerToken(c *fiber.Ctx) string {
+	header := strings.TrimSpace(c.Get("Authorization"))
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return header
+}
+
+func ValidateToken(tokenString string, secretKey string) (JWTClaim, error) {
+	if tokenString == "" {
+		return JWTClaim{}, responses.Unauthorized("Missing authorization token")
+	}
 	var claims JWTClaim
 	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(secretKey), nil
 	})
-	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			return JWTClaim{}, err
-		}
-		return JWTClaim{}, c.Status(http.StatusBadRequest).
-			JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Unauthorized", Data: &fiber.Map{"error": err.Error()}})
+	if err != nil || !token.Valid {
+		return JWTClaim{}, responses.Unauthorized("Invalid or expired token")
 	}
-	if !token.Valid {
-		return JWTClaim{}, c.Status(http.StatusBadRequest).JSON(responses.APIResponse{Status: http.StatusBadRequest, Message: "Unauthorized", Data: &fiber.Map{"error": "Unauthorized"}})
+	return claims, nil
+}
+
+// ClaimsFromRequest validates the bearer token of the current request and tags
+// the request context with the caller's id for logging.
+func ClaimsFromRequest(c *fiber.Ctx) (JWTClaim, error) {
+	claims, err := ValidateToken(BearerToken(c), common.EnvJWTSecret())
+	if err != nil {
+		return JWTClaim{}, err
 	}
+	c.SetUserContext(common.WithUserID(c.UserContext(), claims.ID))
 	return claims, nil
 }
 
-func IsAdmin(tokenString string, secretKey string, c *fiber.Ctx) (bool, error) {
-	claims, err := ValidateToken(tokenString, secretKey, c)
+// RequireAdmin returns the claims of the caller, or Forbidden when they are not an admin.
+func RequireAdmin(c *fiber.Ctx) (JWTClaim, error) {
+	claims, err := ClaimsFromRequest(c)
 	if err != nil {
-		return false, err
+		return JWTClaim{}, err
+	}
+	if !claims.IsAdmin {
+		return JWTClaim{}, responses.Forbidden("Admin access required")
 	}
-	return claims.IsAdmin, nil
+	return claims, nil
 }
 
-func GetUserID(tokenString string, secretKey string, c *fiber.Ctx) (string, error) {
-	claims, err := ValidateToken(tokenString, secretKey, c)
+// RequireStaff returns the claims of the caller, or Forbidden when they are not staff.
+func RequireStaff(c *fiber.Ctx) (JWTClaim, error) {
+	claims, err := ClaimsFromRequest(c)
 	if err != nil {
-		return "", err
+		return JWTClaim{}, err
+	}
+	if !claims.IsStaff() {
+		return JWTClaim{}, responses.Forbidden("Staff access required")
 	}
-	return claims.ID, nil
-}
\ No newline at end of file
+	return claims, nil
+}
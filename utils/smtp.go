@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+)
+
+// SMTPMailer sends through a plain SMTP server, upgrading to TLS when the
+// server offers STARTTLS. Without a username it sends unauthenticated.
+type SMTPMailer struct {
+	addr string
+	host string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(host string, port int, username, password string) *SMTPMailer {
+	m := &SMTPMailer{addr: fmt.Sprintf("%s:%d", host, port), host: host}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (*SMTPMailer) Name() string { return "smtp" }
+
+// Send hands the message to the server; net/smtp takes no context, so a
+// cancelled ctx only stops messages not yet started.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	body, err := msg.MIME()
+	if err != nil {
+		return err
+	}
+	to := make([]string, len(msg.To))
+	for i, r := range msg.To {
+		to[i] = r.Email
+	}
+	return smtp.SendMail(m.addr, m.auth, msg.From.Email, to, body)
+}
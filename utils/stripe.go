@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chiboycalix/hotel-booking-system-backend/common"
+	"github.com/chiboycalix/hotel-booking-system-backend/models"
+)
+
+const stripeAPI = "https://api.stripe.com/v1"
+
+// StripeGateway talks to Stripe's PaymentIntents API, the guest pays with
+// Stripe's client side SDK using the intent's client secret.
+type StripeGateway struct {
+	secretKey string
+}
+
+func NewStripeGateway(secretKey string) *StripeGateway {
+	return &StripeGateway{secretKey: secretKey}
+}
+
+func (*StripeGateway) Name() string { return "stripe" }
+
+type stripeIntent struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	Amount           int64  `json:"amount"`
+	AmountReceived   int64  `json:"amount_received"`
+	ClientSecret     string `json:"client_secret"`
+	LastPaymentError *struct {
+		Message string `json:"message"`
+	} `json:"last_payment_error"`
+}
+
+func (i stripeIntent) toIntent() PaymentIntent {
+	intent := PaymentIntent{
+		Ref:          i.ID,
+		Amount:       i.Amount,
+		Captured:     i.AmountReceived,
+		ClientSecret: i.ClientSecret,
+	}
+	switch i.Status {
+	case "succeeded":
+		intent.Status = models.PaymentSucceeded
+	case "requires_capture":
+		intent.Status = models.PaymentAuthorized
+	case "canceled":
+		intent.Status = models.PaymentCancelled
+	default:
+		intent.Status = models.PaymentPending
+	}
+	if i.LastPaymentError != nil {
+		intent.Failure = i.LastPaymentError.Message
+		if intent.Status == models.PaymentPending {
+			intent.Status = models.PaymentFailed
+		}
+	}
+	return intent
+}
+
+func (g *StripeGateway) CreateIntent(ctx context.Context, req PaymentIntentRequest) (PaymentIntent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(req.Amount, 10))
+	form.Set("currency", strings.ToLower(req.Currency))
+	if req.Description != "" {
+		form.Set("description", req.Description)
+	}
+	if req.Email != "" {
+		form.Set("receipt_email", req.Email)
+	}
+	form.Set("metadata[reference]", req.Reference)
+	form.Set("automatic_payment_methods[enabled]", "true")
+	if req.CaptureLater {
+		form.Set("capture_method", "manual")
+	}
+	var out stripeIntent
+	err := gatewayCall(ctx, g.Name(), "create_intent", func(ctx context.Context) error {
+		return g.post(ctx, "/payment_intents", form, "intent-"+req.Reference, &out)
+	})
+	return out.toIntent(), err
+}
+
+func (g *StripeGateway) GetIntent(ctx context.Context, ref string) (PaymentIntent, error) {
+	var out stripeIntent
+	err := gatewayCall(ctx, g.Name(), "get_intent", func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, stripeAPI+"/payment_intents/"+url.PathEscape(ref), nil)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(g.secretKey, "")
+		return doGatewayRequest(req, &out, stripeError)
+	})
+	return out.toIntent(), err
+}
+
+func (g *StripeGateway) Capture(ctx context.Context, ref string, amount int64) (PaymentIntent, error) {
+	form := url.Values{}
+	if amount > 0 {
+		form.Set("amount_to_capture", strconv.FormatInt(amount, 10))
+	}
+	var out stripeIntent
+	err := gatewayCall(ctx, g.Name(), "capture", func(ctx context.Context) error {
+		return g.post(ctx, "/payment_intents/"+url.PathEscape(ref)+"/capture", form, "capture-"+ref, &out)
+	})
+	return out.toIntent(), err
+}
+
+func (g *StripeGateway) Refund(ctx context.Context, ref string, amount int64, key string) (RefundResult, error) {
+	form := url.Values{}
+	form.Set("payment_intent", ref)
+	if amount > 0 {
+		form.Set("amount", strconv.FormatInt(amount, 10))
+	}
+	var out struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Amount int64  `json:"amount"`
+	}
+	err := gatewayCall(ctx, g.Name(), "refund", func(ctx context.Context) error {
+		return g.post(ctx, "/refunds", form, key, &out)
+	})
+	return RefundResult{Ref: out.ID, Status: stripeRefundStatus(out.Status), Amount: out.Amount}, err
+}
+
+func (g *StripeGateway) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stripeAPI+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(g.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	return doGatewayRequest(req, out, stripeError)
+}
+
+func stripeError(body []byte) string {
+	var out struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &out) != nil {
+		return ""
+	}
+	return out.Error.Message
+}
+
+// webhookTolerance bounds the age of a signed Stripe event, against replays.
+const webhookTolerance = 5 * time.Minute
+
+// VerifyWebhook checks Stripe-Signature, "t=<unix time>,v1=<hex HMAC-SHA256 of
+// t.body>" under STRIPE_WEBHOOK_SECRET.
+func (*StripeGateway) VerifyWebhook(header func(string) string, body []byte) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return ErrInvalidSignature
+	}
+	signed := append([]byte(timestamp+"."), body...)
+	for _, signature := range signatures {
+		if validHMAC(sha256.New, common.StripeWebhookSecret(), signed, signature) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// ParseWebhook reads payment intent and refund events.
+func (*StripeGateway) ParseWebhook(body []byte) (WebhookEvent, error) {
+	var payload struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return WebhookEvent{}, err
+	}
+	event := WebhookEvent{ID: payload.ID, Type: payload.Type}
+	switch {
+	case strings.HasPrefix(payload.Type, "payment_intent."):
+		var object stripeIntent
+		if err := json.Unmarshal(payload.Data.Object, &object); err != nil {
+			return WebhookEvent{}, err
+		}
+		intent := object.toIntent()
+		event.PaymentRef, event.Intent = intent.Ref, &intent
+	case strings.HasPrefix(payload.Type, "refund.") || payload.Type == "charge.refund.updated":
+		var object struct {
+			ID            string `json:"id"`
+			Amount        int64  `json:"amount"`
+			Status        string `json:"status"`
+			PaymentIntent string `json:"payment_intent"`
+		}
+		if err := json.Unmarshal(payload.Data.Object, &object); err != nil {
+			return WebhookEvent{}, err
+		}
+		event.PaymentRef = object.PaymentIntent
+		event.Refund = &RefundResult{Ref: object.ID, Status: stripeRefundStatus(object.Status), Amount: object.Amount}
+	}
+	return event, nil
+}
+
+func stripeRefundStatus(status string) string {
+	if status != "succeeded" && status != "failed" {
+		return "pending"
+	}
+	return status
+}
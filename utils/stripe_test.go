@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func stripeSignature(secret string, at time.Time, body string) (string, string) {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return timestamp, hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestStripeVerifyWebhook(t *testing.T) {
+	const secret = "whsec_test"
+	const body = `{"id":"evt_1","type":"payment_intent.succeeded"}`
+	now := time.Now()
+	ts, sig := stripeSignature(secret, now, body)
+	oldTS, oldSig := stripeSignature(secret, now.Add(-webhookTolerance-time.Minute), body)
+	futureTS, futureSig := stripeSignature(secret, now.Add(webhookTolerance+time.Minute), body)
+	_, otherSig := stripeSignature("whsec_other", now, body)
+	flipped := []byte(sig)
+	flipped[0] ^= 1
+	lateTS, lateSig := stripeSignature(secret, now.Add(-webhookTolerance+time.Minute), body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    string
+		wantErr bool
+	}{
+		{"valid", secret, "t=" + ts + ",v1=" + sig, body, false},
+		{"valid among several signatures", secret, "t=" + ts + ",v1=" + otherSig + ",v1=" + sig + ",v0=abc", body, false},
+		{"within tolerance", secret, "t=" + lateTS + ",v1=" + lateSig, body, false},
+		{"tampered body", secret, "t=" + ts + ",v1=" + sig, body + " ", true},
+		{"tampered signature", secret, "t=" + ts + ",v1=" + string(flipped), body, true},
+		{"tampered timestamp", secret, "t=" + strconv.FormatInt(now.Unix()+1, 10) + ",v1=" + sig, body, true},
+		{"wrong secret", secret, "t=" + ts + ",v1=" + otherSig, body, true},
+		{"expired", secret, "t=" + oldTS + ",v1=" + oldSig, body, true},
+		{"from the future", secret, "t=" + futureTS + ",v1=" + futureSig, body, true},
+		{"no timestamp", secret, "v1=" + sig, body, true},
+		{"no signature", secret, "t=" + ts, body, true},
+		{"no header", secret, "", body, true},
+		{"no secret configured", "", "t=" + ts + ",v1=" + sig, body, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STRIPE_WEBHOOK_SECRET", tt.secret)
+			header := func(name string) string {
+				if name == "Stripe-Signature" {
+					return tt.header
+				}
+				return ""
+			}
+			err := NewStripeGateway("sk_test").VerifyWebhook(header, []byte(tt.body))
+			if tt.wantErr && !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("VerifyWebhook = %v, want ErrInvalidSignature", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("VerifyWebhook = %v, want nil", err)
+			}
+		})
+	}
+}